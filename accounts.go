@@ -0,0 +1,325 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Account is a stored Bethesda.net account that is not in use. The account in use is the one in the
+// core settings and its token is the stored auth token; switching accounts swaps the two.
+type Account struct {
+	Username string
+	Password string
+	FP       string
+	Token    string
+}
+
+var errAccountNotFound = errors.New("account not found")
+
+func (a *Account) get(ls *LauncherStore) error {
+	ls.checkDataFile(false)
+	if err := unlockCredentials(); err != nil {
+		return err
+	}
+	return ls.View(func(tx DataTx) error {
+		data := tx.Bucket([]byte(bucketAccounts)).Get([]byte(accountKey(a.Username)))
+		if data == nil {
+			return errAccountNotFound
+		}
+		key, err := credentialKey(tx)
+		if err != nil {
+			return err
+		}
+		if err := a.decode(data, key); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error decoding account from datastore during get operation", GetCaller()), "error", err)
+			return err
+		}
+		return nil
+	})
+}
+
+func (a *Account) save(ls *LauncherStore) error {
+	return ls.Update(func(tx DataTx) error {
+		key, err := credentialKey(tx)
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			return &notConfiguredError{emsg: "Save your settings before adding accounts"}
+		}
+		return putAccount(tx, a, key)
+	})
+}
+
+func (a *Account) decode(data, key []byte) error {
+	if err := decodeRecord(data, &a); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding account data", GetCaller()), "error", err)
+		return err
+	}
+	for _, v := range []*string{&a.Username, &a.Password, &a.Token} {
+		dec, err := decrypt(*v, &key)
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error decrypting account credential", GetCaller()), "error", err)
+			return err
+		}
+		*v = dec
+	}
+	return nil
+}
+
+func (a *Account) encode(key []byte) ([]byte, error) {
+	enc := *a
+	for _, v := range []*string{&enc.Username, &enc.Password, &enc.Token} {
+		e, err := encrypt(*v, &key)
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error encrypting account credential", GetCaller()), "error", err)
+			return nil, err
+		}
+		*v = e
+	}
+	data, err := encodeRecord(&enc)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error encoding account data", GetCaller()), "error", err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetAccounts returns the account in use followed by the other stored accounts.
+func GetAccounts() ([]string, string, error) {
+	core := &QCCoreSettings{}
+	if err := Get(core); err != nil {
+		return nil, "", err
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return nil, "", err
+	}
+	defer ls.Close()
+	var names []string
+	if err = ls.View(func(tx DataTx) error {
+		key, err := credentialKey(tx)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(bucketAccounts)).ForEach(func(k, v []byte) error {
+			a := &Account{}
+			if err := a.decode(v, key); err != nil {
+				logger.Errorw(fmt.Sprintf("%s: skipping unreadable account", GetCaller()), "error", err)
+				return nil
+			}
+			names = append(names, a.Username)
+			return nil
+		})
+	}); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error getting stored accounts", GetCaller()), "error", err)
+		return nil, "", err
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	if core.Username != "" {
+		names = append([]string{core.Username}, names...)
+	}
+	return names, core.Username, nil
+}
+
+// AddAccount verifies the login with Bethesda.net and stores it alongside the account in use.
+func AddAccount(username, password string) error {
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
+		return &usageError{emsg: "A username and password must be specified"}
+	}
+	cfg, err := GetConfiguration()
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(cfg.Core.Username, username) || Get(&Account{Username: username}) == nil {
+		return &usageError{emsg: fmt.Sprintf("Account is already stored: %s", username)}
+	}
+	// verification hands the new token over in the same temp vars that a settings save would use
+	savedKey, savedToken := tmpKey, tmpToken
+	err = newLauncherClient(defTimeout).verifyCredentials(username, password)
+	token := tmpToken
+	tmpKey, tmpToken = savedKey, savedToken
+	if err != nil {
+		return err
+	}
+	if cfg.Core.TokenOnly {
+		password = ""
+	}
+	if err = Save(&Account{Username: username, Password: password, FP: cfg.Core.FP, Token: token}); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving account", GetCaller()), "error", err)
+		return err
+	}
+	logger.Infow("account added")
+	return nil
+}
+
+func RemoveAccount(username string) error {
+	cfg, err := GetConfiguration()
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(cfg.Core.Username, username) {
+		return &usageError{emsg: "The account in use cannot be removed. Switch to another account first."}
+	}
+	if err = Get(&Account{Username: username}); err != nil {
+		if err == errAccountNotFound {
+			return &usageError{emsg: fmt.Sprintf("Account is not stored: %s", username)}
+		}
+		return err
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return err
+	}
+	defer ls.Close()
+	if err = ls.Update(func(tx DataTx) error { return deleteAccountRecord(tx, username) }); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error removing account", GetCaller()), "error", err)
+		return err
+	}
+	logger.Infow("account removed")
+	return nil
+}
+
+// SwitchAccount makes a stored account the one in use. The account that was in use is kept in the vault.
+func SwitchAccount(username string) error {
+	cfg, err := getStoredConfiguration()
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(cfg.Core.Username, username) {
+		return nil
+	}
+	next := &Account{Username: username}
+	if err = Get(next); err != nil {
+		if err == errAccountNotFound {
+			return &usageError{emsg: fmt.Sprintf("Account is not stored: %s", username)}
+		}
+		return err
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return err
+	}
+	defer ls.Close()
+	if err = ls.Update(func(tx DataTx) error {
+		b := tx.Bucket([]byte(bucketSettings))
+		key, err := credentialKey(tx)
+		if err != nil {
+			return err
+		}
+		key = append([]byte(nil), key...)
+		if cfg.Core.Username != "" {
+			prev := &Account{Username: cfg.Core.Username, Password: cfg.Core.Password, FP: cfg.Core.FP, Token: cfg.Auth.Token}
+			if err := putAccount(tx, prev, key); err != nil {
+				return err
+			}
+		}
+		if err := deleteAccountRecord(tx, next.Username); err != nil {
+			return err
+		}
+		core := *cfg.Core
+		core.Username, core.Password = next.Username, next.Password
+		if next.FP != "" {
+			core.FP = next.FP
+		}
+		encoded, err := core.encode()
+		if err != nil {
+			return err
+		}
+		if err = b.Put([]byte(keyQCCoreSettings), encoded); err != nil {
+			return err
+		}
+		if err = core.writeSecrets(tx, nil, core.Password, next.Token); err != nil {
+			return err
+		}
+		return writeTokenInfoFor(tx, next.Token, "", time.Time{})
+	}); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error switching account", GetCaller()), "error", err)
+		return err
+	}
+	addLogSecrets(next.Password, next.Token)
+	logger.Infow("account switched")
+	return nil
+}
+
+// ConfigureAccount switches to the account given with -account, if any.
+func ConfigureAccount() error {
+	if ConfAccount == "" {
+		return nil
+	}
+	if err := SwitchAccount(ConfAccount); err != nil {
+		return err
+	}
+	ConfAccount = ""
+	return nil
+}
+
+func putAccount(tx DataTx, a *Account, key []byte) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketAccounts))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating accounts bucket in datastore during save operation", GetCaller()),
+			"error", err)
+		return err
+	}
+	encoded, err := a.encode(key)
+	if err != nil {
+		return err
+	}
+	if err = b.Put([]byte(accountKey(a.Username)), encoded); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving encoded account to datastore", GetCaller()), "error", err)
+		return err
+	}
+	return nil
+}
+
+func deleteAccountRecord(tx DataTx, username string) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketAccounts))
+	if err != nil {
+		return err
+	}
+	return b.Delete([]byte(accountKey(username)))
+}
+
+// reencryptAccounts re-encrypts the stored accounts when the credential key is replaced. An account that
+// cannot be read fails the whole save, so that the key is not replaced under it.
+func reencryptAccounts(tx DataTx, oldKey, newKey []byte) error {
+	b := tx.Bucket([]byte(bucketAccounts))
+	if b == nil || len(oldKey) == 0 || bytes.Equal(oldKey, newKey) {
+		return nil
+	}
+	oldKey = append([]byte(nil), oldKey...)
+	accounts := map[string]*Account{}
+	if err := b.ForEach(func(k, v []byte) error {
+		a := &Account{}
+		if err := a.decode(v, oldKey); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: unable to read account to re-encrypt", GetCaller()), "error", err)
+			return err
+		}
+		accounts[string(k)] = a
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		if err := putAccount(tx, a, newKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accountKey hashes the username so that it isn't stored in the clear.
+func accountKey(username string) string {
+	h := sha256.Sum256([]byte(strings.ToLower(username)))
+	return hex.EncodeToString(h[:])
+}
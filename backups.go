@@ -0,0 +1,231 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	BackupDir             = "backups"
+	maxDataFileBackups    = 10
+	backupTimeFormat      = "20060102-150405.000"
+	backupReasonSave      = "save"
+	backupReasonReset     = "reset"
+	backupReasonRestore   = "restore"
+	backupReasonMigration = "migrate"
+)
+
+type DataFileBackup struct {
+	Name   string    `json:"name"`
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	Size   int64     `json:"size"`
+}
+
+// BackupDataFile takes a snapshot of the data file, through the shared handle if this process has it open.
+func BackupDataFile(reason string) (string, error) {
+	if !isFileStore() || !DataStoreExists() {
+		return "", nil // the memory store has nothing to keep
+	}
+	if ls := openedDataStore(); ls != nil {
+		return ls.backup(reason)
+	}
+	db, err := openDataStore("", true)
+	if err != nil {
+		if err == errDataStoreBusy {
+			return "", err
+		}
+		// most likely damaged, which is exactly when a copy is worth having
+		logger.Errorw(fmt.Sprintf("%s: unable to open data file for backup, copying as-is", GetCaller()), "error", err)
+		return writeBackup(reason, func(w io.Writer) error {
+			f, ferr := os.Open(GetDataFilePath())
+			if ferr != nil {
+				return ferr
+			}
+			defer f.Close()
+			_, ferr = io.Copy(w, f)
+			return ferr
+		})
+	}
+	defer db.Close()
+	return backupFromDB(db, reason)
+}
+
+func (ls *LauncherStore) backup(reason string) (string, error) {
+	if !isFileStore() {
+		return "", nil
+	}
+	return backupFromDB(ls.DataStore, reason)
+}
+
+func backupFromDB(db DataStore, reason string) (string, error) {
+	return writeBackup(reason, db.Snapshot)
+}
+
+func writeBackup(reason string, write func(w io.Writer) error) (string, error) {
+	if err := os.MkdirAll(getBackupDirPath(), 0700); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating backup directory", GetCaller()), "error", err)
+		return "", err
+	}
+	ext := filepath.Ext(DataFile)
+	name := fmt.Sprintf("%s-%s-%s%s", strings.TrimSuffix(DataFile, ext), time.Now().Format(backupTimeFormat), reason, ext)
+	p := filepath.Join(getBackupDirPath(), name)
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating backup file", GetCaller()), "error", err)
+		return "", err
+	}
+	if err = write(f); err != nil {
+		f.Close()
+		DeleteFile(p)
+		logger.Errorw(fmt.Sprintf("%s: error writing backup file", GetCaller()), "error", err)
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		DeleteFile(p)
+		return "", err
+	}
+	logger.Infow("data file backed up", "backup", name, "reason", reason)
+	pruneDataFileBackups()
+	return p, nil
+}
+
+func pruneDataFileBackups() {
+	backups, err := ListDataFileBackups()
+	if err != nil || len(backups) <= maxDataFileBackups {
+		return
+	}
+	for _, b := range backups[maxDataFileBackups:] {
+		if err = DeleteFile(filepath.Join(getBackupDirPath(), b.Name)); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error removing old backup", GetCaller()), "backup", b.Name, "error", err)
+		}
+	}
+}
+
+// ListDataFileBackups returns the available snapshots, newest first.
+func ListDataFileBackups() ([]DataFileBackup, error) {
+	files, err := ioutil.ReadDir(getBackupDirPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var backups []DataFileBackup
+	for _, fi := range files {
+		if b, ok := parseBackupName(fi.Name()); ok && !fi.IsDir() {
+			b.Size = fi.Size()
+			backups = append(backups, b)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+func parseBackupName(name string) (DataFileBackup, bool) {
+	ext := filepath.Ext(DataFile)
+	prefix := strings.TrimSuffix(DataFile, ext) + "-"
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+		return DataFileBackup{}, false
+	}
+	rest := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+	if len(rest) < len(backupTimeFormat)+2 {
+		return DataFileBackup{}, false
+	}
+	t, err := time.ParseInLocation(backupTimeFormat, rest[:len(backupTimeFormat)], time.Local)
+	if err != nil {
+		return DataFileBackup{}, false
+	}
+	return DataFileBackup{Name: name, Time: t, Reason: rest[len(backupTimeFormat)+1:]}, true
+}
+
+// RestoreDataFile replaces the data file with a snapshot, after taking a snapshot of the current file.
+// The shared handle is closed first; it is opened again on the next use.
+func RestoreDataFile(name string) error {
+	if !isFileStore() {
+		return &usageError{emsg: fmt.Sprintf("Backups are not kept for the %s store", StoreMemory)}
+	}
+	if name != filepath.Base(name) {
+		return &usageError{emsg: fmt.Sprintf("Invalid backup name: %s", name)}
+	}
+	if _, ok := parseBackupName(name); !ok {
+		return &usageError{emsg: fmt.Sprintf("Not a %s backup: %s", DataFile, name)}
+	}
+	src := filepath.Join(getBackupDirPath(), name)
+	if !FileExists(src) {
+		return &usageError{emsg: fmt.Sprintf("Backup not found: %s", name)}
+	}
+	if err := checkBackupVersion(src); err != nil {
+		return err
+	}
+	if _, err := BackupDataFile(backupReasonRestore); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error backing up data file before restore", GetCaller()), "error", err)
+		return fmt.Errorf("Unable to back up the current %s before restoring: %s", DataFile, err)
+	}
+	closeDataStore()
+	tmp := GetDataFilePath() + ".tmp"
+	if err := copyBackupFile(src, tmp); err != nil {
+		DeleteFile(tmp)
+		logger.Errorw(fmt.Sprintf("%s: error copying backup", GetCaller()), "error", err)
+		return err
+	}
+	if err := os.Rename(tmp, GetDataFilePath()); err != nil {
+		DeleteFile(tmp)
+		logger.Errorw(fmt.Sprintf("%s: error replacing data file with backup", GetCaller()), "error", err)
+		return err
+	}
+	logger.Infow("data file restored", "backup", name)
+	return nil
+}
+
+func checkBackupVersion(p string) error {
+	db, err := openDataStore(p, true)
+	if err != nil {
+		return fmt.Errorf("Unable to open backup: %s", err)
+	}
+	defer db.Close()
+	var v []byte
+	if err = db.View(func(tx DataTx) error {
+		if b := tx.Bucket([]byte(bucketLastUpdate)); b != nil {
+			v = append([]byte(nil), b.Get([]byte(keyDfVer))...)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("Unable to read backup: %s", err)
+	}
+	if len(v) == 8 && int64(binary.LittleEndian.Uint64(v)) > dataFileVersion {
+		return fmt.Errorf("The backup was made by a newer version of QCLauncher")
+	}
+	return nil // older versions are migrated when the restored file is next loaded
+}
+
+func copyBackupFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func getBackupDirPath() string {
+	return filepath.Join(getExecutingPath(), BackupDir)
+}
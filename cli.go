@@ -0,0 +1,1025 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ExitOK = iota
+	ExitError
+	ExitUsage
+	ExitAuthFailed
+	ExitHashMismatch
+	ExitAlreadyRunning
+	ExitNotConfigured
+)
+
+type cliCommand struct {
+	name  string
+	usage string
+	run   func(fs *flag.FlagSet, args []string) (interface{}, error)
+}
+
+type cliError struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+type cliLaunchResult struct {
+	Launched bool `json:"launched"`
+}
+
+type cliStatusResult struct {
+	Status  string         `json:"status"`
+	Message string         `json:"message"`
+	Outages []ServerOutage `json:"outages,omitempty"`
+	history bool
+}
+
+type cliVerifyFilesResult struct {
+	Match bool   `json:"match"`
+	Files int    `json:"files"`
+	Error string `json:"error,omitempty"`
+}
+
+type cliSetting struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+type cliSettings []cliSetting
+
+type cliBackups []DataFileBackup
+
+type cliConfigValues []*ConfigValue
+
+type cliSettingsFileResult struct {
+	Action      string `json:"action"`
+	File        string `json:"file"`
+	Credentials bool   `json:"credentials"`
+}
+
+type cliRestoreResult struct {
+	Restored string `json:"restored"`
+}
+
+type cliProfile struct {
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+}
+
+type cliProfiles []cliProfile
+
+type cliAccount struct {
+	Username string `json:"username"`
+	Active   bool   `json:"active"`
+}
+
+type cliAccounts []cliAccount
+
+type cliPassphraseResult struct {
+	Set        bool   `json:"set"`
+	Remembered bool   `json:"remembered"`
+	Message    string `json:"message"`
+}
+
+type cliTokenResult struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+type cliTokenInfo struct {
+	Username         string     `json:"username"`
+	SecretStore      string     `json:"secret_store"`
+	Token            string     `json:"token"`
+	IssuedAt         *time.Time `json:"issued_at,omitempty"`
+	VerifiedAt       *time.Time `json:"verified_at,omitempty"`
+	SessionID        string     `json:"session_id,omitempty"`
+	OAuthToken       string     `json:"oauth_token,omitempty"`
+	BeamClientAPIKey string     `json:"beam_client_api_key,omitempty"`
+	BeamToken        []string   `json:"beam_token,omitempty"`
+}
+
+type cliBranch struct {
+	ID      int    `json:"id"`
+	Project int    `json:"project"`
+	Name    string `json:"name"`
+	Build   int    `json:"build"`
+}
+
+type cliBranches []cliBranch
+
+type cliLogLevel struct {
+	Level string `json:"level"`
+}
+
+type cliSupportResult struct {
+	Path string `json:"path"`
+}
+
+type cliVersion struct {
+	Version string `json:"version"`
+	XAppVer string `json:"xAppVer"`
+	XLibVer string `json:"xLibVer"`
+}
+
+var cliCommands []*cliCommand
+
+func init() {
+	// assigned here rather than in the declaration because the help command refers back to the list
+	cliCommands = []*cliCommand{
+		{name: "launch", usage: "launch [-json]", run: cliLaunch},
+		{name: "status", usage: "status [-history] [-n count] [-json]", run: cliStatus},
+		{name: "verify-files", usage: "verify-files [-json]", run: cliVerifyFiles},
+		{name: "config", usage: "config [-passphrase-file file] list|get <key>|set <key> <value>|explain|backups|restore <backup>|export <file>|import <file> [-json]", run: cliConfig},
+		{name: "profiles", usage: "profiles [-from profile] [list|use <name>|create <name>|delete <name>] [-json]", run: cliProfilesCmd},
+		{name: "accounts", usage: "accounts [-password-file file] [list|use <username>|add <username>|remove <username>] [-json]", run: cliAccountsCmd},
+		{name: "passphrase", usage: "passphrase [-current-file file] [-new-file file] status|set|remove|remember|forget [-json]", run: cliPassphrase},
+		{name: "token", usage: "token verify|show [-redacted] [-json]", run: cliToken},
+		{name: "branches", usage: "branches [-json]", run: cliBranchList},
+		{name: "doctor", usage: "doctor [-json]", run: cliDoctor},
+		{name: "loglevel", usage: "loglevel [debug|info|warn|error] [-json]", run: cliLogLevelCmd},
+		{name: "support", usage: "support [-o file.zip] [-lines n] [-json]", run: cliSupportBundle},
+		{name: "version", usage: "version [-json]", run: cliShowVersion},
+		{name: "help", usage: "help", run: cliHelp},
+	}
+}
+
+func RunCommand(args []string) int {
+	ConfHeadless = true
+	AttachParentConsole()
+	var cmd *cliCommand
+	for _, c := range cliCommands {
+		if c.name == args[0] {
+			cmd = c
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n%s", args[0], cliUsage())
+		return ExitUsage
+	}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	jsonOut := fs.Bool("json", false, "Write machine-readable JSON output")
+	result, err := cmd.run(fs, args[1:])
+	code := cliExitCode(err)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: command failed", GetCaller()), "command", cmd.name, "error", err, "code", code)
+		if !*jsonOut {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			if code == ExitUsage {
+				fmt.Fprintf(os.Stderr, "Usage: qclauncher %s\n", cmd.usage)
+			}
+		} else if result == nil {
+			writeJSON(&cliError{Error: err.Error(), Code: code})
+		}
+	}
+	if result == nil {
+		return code
+	}
+	if _, isText := result.(fmt.Stringer); *jsonOut || !isText {
+		writeJSON(result)
+	} else {
+		fmt.Fprintln(os.Stdout, result)
+	}
+	return code
+}
+
+func cliExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case IsErrUsage(err):
+		return ExitUsage
+	case IsErrAuthFailed(err), IsErrLocked(err):
+		return ExitAuthFailed
+	case IsErrHashMismatch(err):
+		return ExitHashMismatch
+	case IsErrAlreadyRunning(err):
+		return ExitAlreadyRunning
+	case IsErrNotConfigured(err):
+		return ExitNotConfigured
+	default:
+		return ExitError
+	}
+}
+
+func cliUsage() string {
+	var b strings.Builder
+	b.WriteString("Usage: qclauncher [flags] <command> [command flags]\n\nCommands:\n")
+	for _, c := range cliCommands {
+		fmt.Fprintf(&b, "  %s\n", c.usage)
+	}
+	fmt.Fprintf(&b, "\nExit codes: %d ok, %d error, %d usage, %d auth failed, %d hash mismatch, %d already running, %d not configured\n",
+		ExitOK, ExitError, ExitUsage, ExitAuthFailed, ExitHashMismatch, ExitAlreadyRunning, ExitNotConfigured)
+	return b.String()
+}
+
+func writeJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error writing JSON output", GetCaller()), "error", err)
+	}
+}
+
+// parseCommandFlags parses the flags of a command, which may come before, between or after its arguments
+// (e.g. config get <key> -json). Anything after "--", and anything that looks like a flag but is not one of
+// the command's (e.g. a negative value), is an argument.
+func parseCommandFlags(fs *flag.FlagSet, args []string) error {
+	var positional []string
+	for i := 0; i < len(args); {
+		a := args[i]
+		if a == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		f, ok := lookupCommandFlag(fs, a)
+		if !ok {
+			positional = append(positional, a)
+			i++
+			continue
+		}
+		n := 1
+		if f != nil && !strings.Contains(a, "=") && !isBoolFlag(f) && i+1 < len(args) {
+			n = 2 // -flag value
+		}
+		if err := fs.Parse(args[i : i+n]); err != nil {
+			return &usageError{emsg: err.Error()}
+		}
+		i += n
+	}
+	if err := fs.Parse(append([]string{"--"}, positional...)); err != nil {
+		return &usageError{emsg: err.Error()}
+	}
+	return nil
+}
+
+func lookupCommandFlag(fs *flag.FlagSet, arg string) (*flag.Flag, bool) {
+	if len(arg) < 2 || arg[0] != '-' {
+		return nil, false
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	if i := strings.IndexByte(name, '='); i != -1 {
+		name = name[:i]
+	}
+	if name == "h" || name == "help" {
+		return nil, true // fs.Parse reports it as a usage error
+	}
+	f := fs.Lookup(name)
+	return f, f != nil
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func lockForCommand() (func(), error) {
+	if err := Lock.Lock(); err != nil {
+		if IsErrAlreadyRunning(err) {
+			return nil, err
+		}
+		return nil, &alreadyRunningError{emsg: fmt.Sprintf("Unable to acquire %s: %s", Lock.Filename(false), err)}
+	}
+	return func() { Lock.Unlock() }, nil
+}
+
+func loadConfigurationForCommand() (*Configuration, error) {
+	if !DataStoreExists() {
+		return nil, &notConfiguredError{emsg: "QCLauncher has not been configured yet. Run QCLauncher and click \"Configure\"."}
+	}
+	if err := ConfigureAccount(); err != nil {
+		return nil, err
+	}
+	return GetConfiguration()
+}
+
+func ConfigureEntitlementAPI() {
+	if ConfUseEntitlementAPI {
+		UseEntitlementAPI = false
+	} else {
+		SetEntitlementAPI()
+	}
+}
+
+func cliLaunch(fs *flag.FlagSet, args []string) (interface{}, error) {
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	unlock, err := lockForCommand()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if _, err := loadConfigurationForCommand(); err != nil {
+		return nil, err
+	}
+	ConfigureEntitlementAPI()
+	if err := Launch(); err != nil {
+		return nil, err
+	}
+	return &cliLaunchResult{Launched: true}, nil
+}
+
+func cliStatus(fs *flag.FlagSet, args []string) (interface{}, error) {
+	history := fs.Bool("history", false, "Also list recently recorded QC server outages")
+	n := fs.Int("n", 10, "Maximum number of outages to list with -history")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	res, err := newLauncherClient(defTimeout).getServerStatus()
+	cur := newServerStatusRecord(res, err)
+	result := &cliStatusResult{Status: cur.Status, Message: cur.Message, history: *history}
+	if !*history {
+		return result, nil
+	}
+	records, err := GetServerStatusHistory()
+	if err != nil {
+		return nil, err
+	}
+	result.Outages = GetServerOutages(records)
+	if *n > 0 && len(result.Outages) > *n {
+		result.Outages = result.Outages[len(result.Outages)-*n:]
+	}
+	return result, nil
+}
+
+func (r *cliStatusResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "QC servers: %s (%s)", r.Status, r.Message)
+	if !r.history {
+		return b.String()
+	}
+	if len(r.Outages) == 0 {
+		b.WriteString("\nNo outages recorded.")
+		return b.String()
+	}
+	b.WriteString("\nRecent outages:")
+	for _, o := range r.Outages {
+		end, dur := "ongoing", time.Since(o.Start)
+		if !o.Ongoing {
+			end, dur = o.End.Format(time.RFC3339), o.End.Sub(o.Start)
+		}
+		fmt.Fprintf(&b, "\n  %-11s %s -> %s (%s)", o.Status, o.Start.Format(time.RFC3339), end, dur.Round(time.Second))
+	}
+	return b.String()
+}
+
+func cliVerifyFiles(fs *flag.FlagSet, args []string) (interface{}, error) {
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if _, err := loadConfigurationForCommand(); err != nil {
+		return nil, err
+	}
+	info, err := newLauncherClient(defTimeout).getQCUpdateInfo()
+	if err != nil {
+		return nil, err
+	}
+	h := []FileHash{}
+	for _, fh := range info.Hashes {
+		h = append(h, FileHash{File: strings.Replace(fh.File, "/", "\\", -1), Hash: fh.Hash})
+	}
+	result := &cliVerifyFilesResult{Match: true, Files: len(h)}
+	if err := compareHashes(h); err != nil {
+		result.Match, result.Error = false, err.Error()
+		return result, err
+	}
+	return result, nil
+}
+
+func (r *cliVerifyFilesResult) String() string {
+	if r.Match {
+		return fmt.Sprintf("OK: %d QC file(s) match the latest version from Bethesda", r.Files)
+	}
+	return fmt.Sprintf("MISMATCH: %s", r.Error)
+}
+
+func cliConfig(fs *flag.FlagSet, args []string) (interface{}, error) {
+	passFile := fs.String("passphrase-file", "", "File containing the passphrase protecting exported credentials")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	op := fs.Arg(0)
+	switch {
+	case op == "list" && fs.NArg() == 1:
+		cfg, err := loadConfigurationForCommand()
+		if err != nil {
+			return nil, err
+		}
+		var settings cliSettings
+		for _, k := range getSettingKeys() {
+			settings = append(settings, cliSetting{Key: k.name, Value: k.get(cfg), Description: k.desc})
+		}
+		return settings, nil
+	case op == "get" && fs.NArg() == 2:
+		k, err := getSettingKey(fs.Arg(1))
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := loadConfigurationForCommand()
+		if err != nil {
+			return nil, err
+		}
+		return &cliSetting{Key: k.name, Value: k.get(cfg)}, nil
+	case op == "set" && fs.NArg() == 3:
+		k, err := getSettingKey(fs.Arg(1))
+		if err != nil {
+			return nil, err
+		}
+		if k.readOnly {
+			return nil, &usageError{emsg: fmt.Sprintf("%s cannot be changed from the command line", k.name)}
+		}
+		unlock, err := lockForCommand()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		if _, err = loadConfigurationForCommand(); err != nil {
+			return nil, err
+		}
+		// overrides from the environment or config file must not be saved along with the new value
+		cfg, err := getStoredConfiguration()
+		if err != nil {
+			return nil, err
+		}
+		if err = k.set(cfg, fs.Arg(2)); err != nil {
+			return nil, err
+		}
+		if err = k.save(cfg); err != nil {
+			return nil, err
+		}
+		return &cliSetting{Key: k.name, Value: k.get(cfg)}, nil
+	case op == "explain" && fs.NArg() == 1:
+		var cfg *Configuration
+		if DataStoreExists() {
+			var err error
+			if cfg, err = GetConfiguration(); err != nil {
+				return nil, err
+			}
+		}
+		return cliConfigValues(ExplainConfig(cfg)), nil
+	case op == "backups" && fs.NArg() == 1:
+		backups, err := ListDataFileBackups()
+		if err != nil {
+			return nil, err
+		}
+		return cliBackups(backups), nil
+	case op == "restore" && fs.NArg() == 2:
+		unlock, err := lockForCommand()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		if err = RestoreDataFile(fs.Arg(1)); err != nil {
+			return nil, err
+		}
+		return &cliRestoreResult{Restored: fs.Arg(1)}, nil
+	case op == "export" && fs.NArg() == 2:
+		passphrase, err := readPassphraseFile(*passFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = ExportSettings(fs.Arg(1), passphrase); err != nil {
+			return nil, err
+		}
+		return &cliSettingsFileResult{Action: "exported", File: fs.Arg(1), Credentials: passphrase != ""}, nil
+	case op == "import" && fs.NArg() == 2:
+		passphrase, err := readPassphraseFile(*passFile)
+		if err != nil {
+			return nil, err
+		}
+		unlock, err := lockForCommand()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		if _, err = ImportSettings(fs.Arg(1), passphrase); err != nil {
+			return nil, err
+		}
+		return &cliSettingsFileResult{Action: "imported", File: fs.Arg(1),
+			Credentials: passphrase != "" && SettingsExportHasCredentials(fs.Arg(1))}, nil
+	default:
+		return nil, &usageError{emsg: "Expected list, get <key>, set <key> <value>, explain, backups, restore <backup>, export <file> or import <file>"}
+	}
+}
+
+func (c cliConfigValues) String() string {
+	var s strings.Builder
+	for i, v := range c {
+		if i > 0 {
+			s.WriteString("\n")
+		}
+		source := v.Source
+		if v.From != "" {
+			source = fmt.Sprintf("%s (%s)", v.Source, v.From)
+		}
+		fmt.Fprintf(&s, "%-34s %-30s %s", v.Key, v.Value, source)
+	}
+	return s.String()
+}
+
+func (b cliBackups) String() string {
+	if len(b) == 0 {
+		return "No backups"
+	}
+	var s strings.Builder
+	for i, v := range b {
+		if i > 0 {
+			s.WriteString("\n")
+		}
+		fmt.Fprintf(&s, "%-48s %s  before %s", v.Name, v.Time.Format("2006-01-02 15:04:05"), v.Reason)
+	}
+	return s.String()
+}
+
+func (r *cliSettingsFileResult) String() string {
+	if r.Credentials {
+		return fmt.Sprintf("Settings and credentials %s: %s", r.Action, r.File)
+	}
+	return fmt.Sprintf("Settings %s: %s", r.Action, r.File)
+}
+
+func readPassphraseFile(p string) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", &usageError{emsg: fmt.Sprintf("Unable to read file: %s", err)}
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func (r *cliRestoreResult) String() string {
+	return fmt.Sprintf("Restored %s from %s", DataFile, r.Restored)
+}
+
+func (s *cliSetting) String() string {
+	return s.Value
+}
+
+func (s cliSettings) String() string {
+	var b strings.Builder
+	for i, v := range s {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%-32s %s", v.Key, v.Value)
+	}
+	return b.String()
+}
+
+func cliProfilesCmd(fs *flag.FlagSet, args []string) (interface{}, error) {
+	from := fs.String("from", "", "Profile to copy settings from when creating a profile (default: the profile in use)")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if !DataStoreExists() {
+		return nil, &notConfiguredError{emsg: "QCLauncher has not been configured yet. Run QCLauncher and click \"Configure\"."}
+	}
+	op := fs.Arg(0)
+	if op != "" && op != "list" {
+		if fs.NArg() != 2 {
+			return nil, &usageError{emsg: "Expected list, use <name>, create <name> or delete <name>"}
+		}
+		unlock, err := lockForCommand()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		name := fs.Arg(1)
+		switch op {
+		case "use":
+			err = SetActiveProfile(name)
+		case "create":
+			if *from == "" {
+				if _, *from, err = GetProfiles(); err != nil {
+					return nil, err
+				}
+			}
+			err = CreateProfile(name, *from)
+		case "delete":
+			err = DeleteProfile(name)
+		default:
+			err = &usageError{emsg: "Expected list, use <name>, create <name> or delete <name>"}
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if fs.NArg() > 1 {
+		return nil, &usageError{emsg: "Too many arguments"}
+	}
+	names, active, err := GetProfiles()
+	if err != nil {
+		return nil, err
+	}
+	var profiles cliProfiles
+	for _, n := range names {
+		profiles = append(profiles, cliProfile{Name: n, Active: n == active})
+	}
+	return profiles, nil
+}
+
+func (p cliProfiles) String() string {
+	var b strings.Builder
+	for i, v := range p {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		marker := " "
+		if v.Active {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, "%s %s", marker, v.Name)
+	}
+	return b.String()
+}
+
+func cliAccountsCmd(fs *flag.FlagSet, args []string) (interface{}, error) {
+	passFile := fs.String("password-file", "", "File containing the password of the account to add")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if !DataStoreExists() {
+		return nil, &notConfiguredError{emsg: "QCLauncher has not been configured yet. Run QCLauncher and click \"Configure\"."}
+	}
+	op := fs.Arg(0)
+	if op != "" && op != "list" {
+		if fs.NArg() != 2 {
+			return nil, &usageError{emsg: "Expected list, use <username>, add <username> or remove <username>"}
+		}
+		unlock, err := lockForCommand()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		username := fs.Arg(1)
+		switch op {
+		case "use":
+			err = SwitchAccount(username)
+		case "add":
+			if *passFile == "" {
+				return nil, &usageError{emsg: "The password must be given with -password-file"}
+			}
+			var password string
+			if password, err = readPassphraseFile(*passFile); err != nil {
+				return nil, err
+			}
+			err = AddAccount(username, password)
+		case "remove":
+			err = RemoveAccount(username)
+		default:
+			err = &usageError{emsg: "Expected list, use <username>, add <username> or remove <username>"}
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if fs.NArg() > 1 {
+		return nil, &usageError{emsg: "Too many arguments"}
+	}
+	names, active, err := GetAccounts()
+	if err != nil {
+		return nil, err
+	}
+	var accounts cliAccounts
+	for _, n := range names {
+		accounts = append(accounts, cliAccount{Username: n, Active: n == active})
+	}
+	return accounts, nil
+}
+
+func (a cliAccounts) String() string {
+	var b strings.Builder
+	for i, v := range a {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		marker := " "
+		if v.Active {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, "%s %s", marker, v.Username)
+	}
+	return b.String()
+}
+
+func cliToken(fs *flag.FlagSet, args []string) (interface{}, error) {
+	redacted := fs.Bool("redacted", false, "Show a fingerprint of each credential instead of its value")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	sub := fs.Arg(0)
+	if fs.NArg() != 1 || (sub != "verify" && sub != "show") {
+		return nil, &usageError{emsg: "Expected verify or show"}
+	}
+	unlock, err := lockForCommand()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	cfg, err := loadConfigurationForCommand()
+	if err != nil {
+		return nil, err
+	}
+	if sub == "show" {
+		return newCLITokenInfo(cfg, *redacted), nil
+	}
+	if cfg.Auth.Token == "" {
+		return &cliTokenResult{Error: "No authentication token is stored"}, &authFailedError{emsg: "No authentication token is stored"}
+	}
+	vreq := &verifyRequest{}
+	if err = vreq.build(getVerifyEndpoint()); err != nil {
+		return nil, err
+	}
+	if _, err = newLauncherClient(defTimeout).send(vreq); err != nil {
+		return &cliTokenResult{Error: err.Error()}, err
+	}
+	return &cliTokenResult{Valid: true}, nil
+}
+
+func cliPassphrase(fs *flag.FlagSet, args []string) (interface{}, error) {
+	currentFile := fs.String("current-file", "", "File containing the master passphrase in use")
+	newFile := fs.String("new-file", "", "File containing the new master passphrase")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 1 {
+		return nil, &usageError{emsg: "Expected status, set, remove, remember or forget"}
+	}
+	if !DataStoreExists() {
+		return nil, &notConfiguredError{emsg: "QCLauncher has not been configured yet. Run QCLauncher and click \"Configure\"."}
+	}
+	set, err := HasMasterPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	result := &cliPassphraseResult{}
+	switch fs.Arg(0) {
+	case "status":
+	case "set", "remove":
+		unlock, err := lockForCommand()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		var current, passphrase string
+		if set {
+			if current, err = readPassphraseOrPrompt(*currentFile, "Current master passphrase: "); err != nil {
+				return nil, err
+			}
+		}
+		if fs.Arg(0) == "set" {
+			if passphrase, err = readPassphraseOrPrompt(*newFile, "New master passphrase: "); err != nil {
+				return nil, err
+			}
+			if *newFile == "" {
+				again, err := readConsolePassphrase("Confirm new master passphrase: ")
+				if err != nil {
+					return nil, err
+				}
+				if again != passphrase {
+					return nil, &usageError{emsg: "The passphrases do not match"}
+				}
+			}
+		}
+		if err = SetMasterPassphrase(current, passphrase); err != nil {
+			return nil, err
+		}
+		if passphrase != "" {
+			result.Message = fmt.Sprintf("Backups made before now in the %s folder are not protected by the master passphrase", BackupDir)
+		}
+		set = passphrase != ""
+	case "remember":
+		if err = RememberMasterPassphrase(); err != nil {
+			return nil, err
+		}
+	case "forget":
+		ClearUnlockCache()
+	default:
+		return nil, &usageError{emsg: "Expected status, set, remove, remember or forget"}
+	}
+	result.Set = set
+	result.Remembered = set && FileExists(getUnlockCachePath())
+	return result, nil
+}
+
+func readPassphraseOrPrompt(p, prompt string) (string, error) {
+	if p != "" {
+		return readPassphraseFile(p)
+	}
+	passphrase, err := readConsolePassphrase(prompt)
+	if err != nil {
+		return "", &usageError{emsg: fmt.Sprintf("Unable to read the passphrase: %s", err)}
+	}
+	return passphrase, nil
+}
+
+func (r *cliPassphraseResult) String() string {
+	var s string
+	switch {
+	case !r.Set:
+		s = "No master passphrase is set"
+	case r.Remembered:
+		s = "A master passphrase is set and remembered until you sign out of Windows"
+	default:
+		s = "A master passphrase is set"
+	}
+	if r.Message != "" {
+		s += "\n" + r.Message
+	}
+	return s
+}
+
+func (r *cliTokenResult) String() string {
+	if r.Valid {
+		return "Token is valid"
+	}
+	return fmt.Sprintf("Token is not valid: %s", r.Error)
+}
+
+func newCLITokenInfo(cfg *Configuration, redacted bool) *cliTokenInfo {
+	show := func(v string) string {
+		if !redacted || v == "" {
+			return v
+		}
+		return fmt.Sprintf("%s (sha256 %s, %d chars)", redactedValue, tokenHash(v)[:8], len(v))
+	}
+	at := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	auth := cfg.Auth
+	info := &cliTokenInfo{
+		Username:         cfg.Core.Username,
+		SecretStore:      cfg.Core.SecretStore,
+		Token:            show(auth.Token),
+		IssuedAt:         at(auth.IssuedAt),
+		VerifiedAt:       at(auth.VerifiedAt),
+		SessionID:        auth.SessionID,
+		OAuthToken:       show(auth.Services.OAuthToken),
+		BeamClientAPIKey: show(auth.Services.BeamClientAPIKey),
+	}
+	for _, t := range auth.Services.BeamToken {
+		info.BeamToken = append(info.BeamToken, show(t))
+	}
+	return info
+}
+
+func (r *cliTokenInfo) String() string {
+	var b strings.Builder
+	none := func(v string) string {
+		if v == "" {
+			return "(none)"
+		}
+		return v
+	}
+	when := func(t *time.Time) string {
+		if t == nil {
+			return "(unknown)"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	}
+	line := func(label, v string) { fmt.Fprintf(&b, "%-22s%s\n", label+":", v) }
+	line("Account", none(r.Username))
+	line("Saved in", none(r.SecretStore))
+	line("Token", none(r.Token))
+	line("Issued", when(r.IssuedAt))
+	line("Last verified", when(r.VerifiedAt))
+	line("Session ID", none(r.SessionID))
+	line("OAuth token", none(r.OAuthToken))
+	line("Beam client API key", none(r.BeamClientAPIKey))
+	if len(r.BeamToken) == 0 {
+		line("Beam tokens", "(none)")
+	}
+	for i, t := range r.BeamToken {
+		line(fmt.Sprintf("Beam token %d", i+1), t)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func cliBranchList(fs *flag.FlagSet, args []string) (interface{}, error) {
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if _, err := loadConfigurationForCommand(); err != nil {
+		return nil, err
+	}
+	ConfigureEntitlementAPI()
+	lc := newLauncherClient(defTimeout)
+	var branches cliBranches
+	if UseEntitlementAPI {
+		info, err := lc.getEntitlementInfo()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range info.Branches {
+			branches = append(branches, cliBranch{ID: b.ID, Project: b.Project, Name: b.Name, Build: b.Build})
+		}
+	} else {
+		info, err := lc.getBuildInfo()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range info.Branches {
+			branches = append(branches, cliBranch{ID: b.ID, Project: b.Project, Name: b.Name, Build: b.BuildID})
+		}
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].ID < branches[j].ID })
+	return branches, nil
+}
+
+func (b cliBranches) String() string {
+	var sb strings.Builder
+	for i, v := range b {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "%-8d project %-4d build %-10d %s", v.ID, v.Project, v.Build, v.Name)
+	}
+	return sb.String()
+}
+
+func cliDoctor(fs *flag.FlagSet, args []string) (interface{}, error) {
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	report := RunDoctor()
+	if report.Failed() {
+		return report, errors.New("One or more diagnostic checks failed")
+	}
+	return report, nil
+}
+
+func cliLogLevelCmd(fs *flag.FlagSet, args []string) (interface{}, error) {
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	switch fs.NArg() {
+	case 0:
+		if level, ok := getRequestedLogLevel(); ok {
+			return &cliLogLevel{Level: level}, nil
+		}
+		return &cliLogLevel{Level: GetLogLevel()}, nil
+	case 1:
+		if err := RequestLogLevel(fs.Arg(0)); err != nil {
+			return nil, err
+		}
+		return &cliLogLevel{Level: GetLogLevel()}, nil
+	default:
+		return nil, &usageError{emsg: "Too many arguments"}
+	}
+}
+
+func (l *cliLogLevel) String() string {
+	return fmt.Sprintf("Log level: %s", l.Level)
+}
+
+func cliSupportBundle(fs *flag.FlagSet, args []string) (interface{}, error) {
+	out := fs.String("o", "", "Write the support bundle to this file instead of the QCLauncher folder")
+	lines := fs.Int("lines", DefSupportLogLines, "Number of log lines to include")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	p, err := CreateSupportBundle(*out, *lines)
+	if err != nil {
+		return nil, err
+	}
+	return &cliSupportResult{Path: p}, nil
+}
+
+func (r *cliSupportResult) String() string {
+	return fmt.Sprintf("Support bundle written to %s. Attach it to your issue at https://github.com/syncore/qclauncher/issues", r.Path)
+}
+
+func cliShowVersion(fs *flag.FlagSet, args []string) (interface{}, error) {
+	if err := parseCommandFlags(fs, args); err != nil {
+		return nil, err
+	}
+	return &cliVersion{Version: fmt.Sprintf("%.2f", version), XAppVer: ConfXAppVer, XLibVer: ConfXLibVer}, nil
+}
+
+func (v *cliVersion) String() string {
+	return fmt.Sprintf("QCLauncher %s (x-cdp-app-ver %s, x-cdp-lib-ver %s)", v.Version, v.XAppVer, v.XLibVer)
+}
+
+func cliHelp(fs *flag.FlagSet, args []string) (interface{}, error) {
+	fmt.Fprint(os.Stdout, cliUsage())
+	return nil, nil
+}
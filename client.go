@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,6 +19,12 @@ type launcherClient struct {
 	*http.Client
 }
 
+// tokenRecheckAfter is how long a verified token is trusted before it is verified again.
+const tokenRecheckAfter = 5 * time.Minute
+
+// authMu keeps the background token check and a launch from logging in at the same time.
+var authMu sync.Mutex
+
 func newLauncherClient(timeout int) *launcherClient {
 	return &launcherClient{
 		&http.Client{Timeout: time.Duration(timeout) * time.Second},
@@ -122,6 +129,7 @@ func (lc *launcherClient) getGameCode(projectID int) (*GameCodeResponse, error)
 	}
 	res, err := lc.send(req)
 	if gameCodeResponse, ok := res.(GameCodeResponse); ok {
+		addLogSecrets(gameCodeResponse.Gamecode)
 		return &gameCodeResponse, nil
 	} else if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error parsing game code response", GetCaller()), "error", err, "data", res)
@@ -188,6 +196,9 @@ func (lc *launcherClient) getLauncherUpdateInfo() (*UpdateLauncherResponse, erro
 
 func (lc *launcherClient) checkServerStatus() {
 	status, err := lc.getServerStatus()
+	if rerr := recordServerStatus(newServerStatusRecord(status, err)); rerr != nil {
+		logger.Errorw(fmt.Sprintf("%s: error recording server status", GetCaller()), "error", rerr)
+	}
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error checking server status", GetCaller()), "error", err)
 		return
@@ -197,51 +208,165 @@ func (lc *launcherClient) checkServerStatus() {
 	}
 }
 
+// authenticate makes sure there is a token that Bethesda.net accepts before launching. A token that was
+// verified recently is trusted as-is; a stale one is replaced by logging in again within the same attempt.
 func (lc *launcherClient) authenticate(cfg *Configuration) error {
-	// Verify
-	if cfg.Auth.Token != "" {
-		vreq := &verifyRequest{}
-		if err := vreq.build(getVerifyEndpoint()); err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error building verify request", GetCaller()), "error", err)
-			return err
-		}
-		vres, err := lc.send(vreq)
-		if IsErrAuthFailed(err) {
-			logger.Error(fmt.Sprintf("%s: stale authentication token. clearing token for next attempt.", GetCaller()))
-			if cerr := clearAuthToken(); cerr != nil {
-				logger.Errorw(fmt.Sprintf("%s: unable to clear stale authentication token, data file will need to be reset", GetCaller()),
-					"error", cerr)
-				DeleteConfiguration(true)
-				return cerr
-			}
-			return &authFailedError{emsg: "Bethesda server authentication error. Please try launching again."}
-		}
-		if _, ok := vres.(AuthResponse); !ok {
-			logger.Errorw(fmt.Sprintf("%s: unexpected verify response type", GetCaller()), "error", err, "data", vres)
-			return errors.New("Received an unexpected response during authentication")
+	return lc.authenticateWithin(cfg, tokenRecheckAfter)
+}
+
+// authenticateWithin is authenticate, trusting a token that was verified within maxAge.
+func (lc *launcherClient) authenticateWithin(cfg *Configuration, maxAge time.Duration) error {
+	authMu.Lock()
+	defer authMu.Unlock()
+	// the background check may have replaced the token since cfg was loaded
+	auth := &TokenAuth{}
+	if err := Get(auth); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading auth token", GetCaller()), "error", err)
+		return err
+	}
+	cfg.Auth = auth
+	if auth.Token == "" {
+		if cfg.Core.TokenOnly && cfg.Core.Password == "" {
+			return lc.reauthenticate(cfg)
 		}
-		if err != nil {
+		return lc.login("")
+	}
+	if time.Since(auth.VerifiedAt) < maxAge {
+		logger.Debugw("skipping verify of recently verified auth token", "verified", auth.VerifiedAt)
+		return nil
+	}
+	err := lc.verifyToken()
+	if !IsErrAuthFailed(err) {
+		return err
+	}
+	logger.Infow("stale authentication token, logging in again", "issued", auth.IssuedAt, "verified", auth.VerifiedAt,
+		"session", auth.SessionID)
+	if cerr := clearAuthToken(); cerr != nil {
+		// e.g. the data file is busy; the token is verified again on the next attempt
+		logger.Errorw(fmt.Sprintf("%s: unable to clear stale authentication token", GetCaller()), "error", cerr)
+		return cerr
+	}
+	if cfg.Core.TokenOnly && cfg.Core.Password == "" {
+		return lc.reauthenticate(cfg)
+	}
+	return lc.login("")
+}
+
+// serviceTokens returns the OAuth and Beam tokens that came with the saved auth token, for endpoints that
+// need them. Bethesda.net only refreshes them along with the auth token, so the token is verified again
+// (or replaced by logging in) if they are missing or were not refreshed within tokenRecheckAfter.
+func (lc *launcherClient) serviceTokens(cfg *Configuration) (*ServiceTokens, error) {
+	auth := &TokenAuth{}
+	if err := Get(auth); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading service tokens", GetCaller()), "error", err)
+		return nil, err
+	}
+	if auth.Token != "" && !auth.Services.empty() && time.Since(auth.VerifiedAt) < tokenRecheckAfter {
+		return &auth.Services, nil
+	}
+	if err := lc.authenticateWithin(cfg, 0); err != nil {
+		return nil, err
+	}
+	if err := Get(auth); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading service tokens", GetCaller()), "error", err)
+		return nil, err
+	}
+	if auth.Services.empty() {
+		return nil, errors.New("Bethesda.net did not return any service tokens")
+	}
+	return &auth.Services, nil
+}
+
+// verifyToken checks the saved token with Bethesda.net, which marks it as verified.
+func (lc *launcherClient) verifyToken() error {
+	vreq := &verifyRequest{}
+	if err := vreq.build(getVerifyEndpoint()); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error building verify request", GetCaller()), "error", err)
+		return err
+	}
+	vres, err := lc.send(vreq)
+	if err != nil {
+		if !IsErrAuthFailed(err) {
 			logger.Errorw(fmt.Sprintf("%s: error receiving verify response", GetCaller()), "error", err, "data", vres)
-			return err
 		}
-	} else {
-		// Auth
-		areq := &authRequest{}
-		if err := areq.build(getAuthEndpoint()); err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error building auth request", GetCaller()), "error", err)
-			return err
+		return err
+	}
+	if _, ok := vres.(AuthResponse); !ok {
+		logger.Errorw(fmt.Sprintf("%s: unexpected verify response type", GetCaller()), "data", vres)
+		return errors.New("Received an unexpected response during authentication")
+	}
+	return nil
+}
+
+// checkAuthToken verifies the saved token in the background when the launcher opens, so that a stale
+// token is replaced before Play is clicked. In token-only mode the password is asked for at launch instead.
+func checkAuthToken() {
+	cfg, err := GetConfiguration()
+	if err != nil || cfg.Auth.Token == "" {
+		return
+	}
+	if cfg.Core.TokenOnly && cfg.Core.Password == "" {
+		authMu.Lock()
+		defer authMu.Unlock()
+		if err = newLauncherClient(defTimeout).verifyToken(); IsErrAuthFailed(err) {
+			logger.Info("auth token is stale; the password will be asked for at launch")
 		}
-		ares, err := lc.send(areq)
-		if _, ok := ares.(AuthResponse); !ok {
-			logger.Errorw(fmt.Sprintf("%s: unexpected auth response type", GetCaller()), "error", err, "data", ares)
-			return formatUnexpectedResponse("performing authentication")
+		return
+	}
+	if err = newLauncherClient(defTimeout).authenticate(cfg); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error checking auth token in background", GetCaller()), "error", err)
+		return
+	}
+	logger.Debug("auth token checked in background")
+}
+
+// login authenticates with the saved account. password replaces the saved password if it is given.
+func (lc *launcherClient) login(password string) error {
+	areq := &authRequest{Password: password}
+	if err := areq.build(getAuthEndpoint()); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error building auth request", GetCaller()), "error", err)
+		return err
+	}
+	ares, err := lc.send(areq)
+	if IsErrAuthFailed(err) {
+		return err
+	}
+	if _, ok := ares.(AuthResponse); !ok {
+		logger.Errorw(fmt.Sprintf("%s: unexpected auth response type", GetCaller()), "error", err, "data", ares)
+		return formatUnexpectedResponse("performing authentication")
+	}
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error receiving auth response", GetCaller()), "error", err, "data", ares)
+		return err
+	}
+	return nil
+}
+
+// reauthenticate asks for the password in token-only mode, when there is no usable token. The password is
+// only used to get a new token and is not saved.
+func (lc *launcherClient) reauthenticate(cfg *Configuration) error {
+	for {
+		password, ok := askAccountPassword(cfg.Core.Username)
+		if !ok {
+			return &authFailedError{emsg: "Your Bethesda.net login has expired. Your password is needed to log in again."}
 		}
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error receiving auth response", GetCaller()), "error", err, "data", ares)
+		addLogSecrets(password)
+		err := lc.login(password)
+		if !IsErrAuthFailed(err) || ConfHeadless {
 			return err
 		}
+		ShowErrorMsg("Log In", "Login failed. Please check your password and try again.", nil)
 	}
-	return nil
+}
+
+func askAccountPassword(username string) (string, bool) {
+	if ConfHeadless {
+		password, err := readConsolePassphrase(fmt.Sprintf("Bethesda.net password for %s: ", username))
+		return password, err == nil && password != ""
+	}
+	password, ok := askPassphrase(nil, "Log In",
+		fmt.Sprintf("Your Bethesda.net login has expired. Enter the password for %s:", username), false)
+	return password, ok && password != ""
 }
 
 func (lc *launcherClient) verifyCredentials(user, password string) error {
@@ -267,7 +392,24 @@ func (lc *launcherClient) verifyCredentials(user, password string) error {
 	return nil
 }
 
+// send sends req. If the server rejects the fingerprint it was sent with, the fingerprint chain is run
+// again and req is sent once more with the replacement.
 func (lc *launcherClient) send(req localRequest) (interface{}, error) {
+	response, err := lc.sendOnce(req)
+	if !IsErrFPRejected(err) {
+		return response, err
+	}
+	if ferr := replaceRejectedFP(err.(*fpRejectedError).fp); ferr != nil {
+		return nil, ferr
+	}
+	if err = req.build(req.getParams().endpointAddr); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error rebuilding request with replacement fingerprint", GetCaller()), "error", err)
+		return nil, err
+	}
+	return lc.sendOnce(req)
+}
+
+func (lc *launcherClient) sendOnce(req localRequest) (response interface{}, err error) {
 	p := req.getParams()
 	var br io.Reader
 	if req.needsContent() {
@@ -284,13 +426,17 @@ func (lc *launcherClient) send(req localRequest) (interface{}, error) {
 		return nil, err
 	}
 	hr.Header = p.header
+	te := newRequestTranscriptEntry(hr)
+	defer func() { recordRequest(te, err) }()
 	res, err := lc.Do(hr)
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error sending request", GetCaller()), "error", err, "data", hr)
 		return nil, err
 	}
 	defer res.Body.Close()
+	te.StatusCode = res.StatusCode
 	b, err := ioutil.ReadAll(res.Body)
+	te.ResponseBytes = len(b)
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error reading response body", GetCaller()), "error", err, "data", string(b))
 		return nil, err
@@ -302,16 +448,27 @@ func (lc *launcherClient) send(req localRequest) (interface{}, error) {
 				GetCaller(), p.endpointAddr))
 			return nil, &authFailedError{emsg: "User authentication failed"}
 		}
+		fp := hr.Header[hkeyXSrcFp]
+		if res.StatusCode == http.StatusForbidden && len(fp) != 0 && fp[0] != "" && isFPRejection(b) {
+			logger.Error(fmt.Sprintf("%s: got forbidden response, hardware fingerprint was rejected (%s)", GetCaller(),
+				p.endpointAddr))
+			return nil, &fpRejectedError{emsg: "Bethesda.net rejected the hardware fingerprint", fp: fp[0]}
+		}
 		logger.Errorw(fmt.Sprintf("%s: got non-OK status code", GetCaller()), "error", err, "statusCode", res.StatusCode)
 		return nil, fmt.Errorf("send: Non-OK status code received: %d", res.StatusCode)
 	}
 	rd := &remoteResponseData{ResponseType: req.expectedResponse()}
+	if isSignedResponse(rd.ResponseType) {
+		if b, rd.LastKnownGood, err = lc.checkSignedResponse(rd.ResponseType, p.endpointAddr, b); err != nil {
+			return nil, err
+		}
+	}
 	err = json.Unmarshal(b, &rd.Data)
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error unmarshaling resposne body into model", GetCaller()), "error", err, "data", string(b))
 		return nil, err
 	}
-	response, err := parseRemoteResponseData(rd)
+	response, err = parseRemoteResponseData(rd)
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error parsing remote response data", GetCaller()), "error", err, "data", string(rd.Data))
 		return nil, err
@@ -11,6 +11,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/syncore/qclauncher"
 )
@@ -22,18 +23,32 @@ func init() {
 	flag.StringVar(&qclauncher.ConfXAppVer, "xappver", qclauncher.XAppDefVer, "Manually specify app version for request header")
 	flag.StringVar(&qclauncher.ConfXLibVer, "xlibver", qclauncher.XLibDefVer, "Manually specify lib version for request header")
 	flag.StringVar(&qclauncher.ConfXSrcFp, "fp", qclauncher.XSrcFpDef, "Manually specify Bethesda hardware fingerprint for request header")
+	flag.StringVar(&qclauncher.ConfFPChain, "fpchain", qclauncher.FPChainDef, "Where to look for the hardware fingerprint, in order: override (-fp), cache, blff, file (-fpfile)")
+	flag.StringVar(&qclauncher.ConfFPFile, "fpfile", "", "File containing the hardware fingerprint, as blff JSON output or the bare value")
+	flag.StringVar(&qclauncher.ConfFPTransport, "fptransport", "", "How the fingerprint extraction tool sends its result: pipe (default on Windows), unix or tcp")
 	flag.StringVar(&qclauncher.ConfAppendCustomArgs, "customargs", "", "Append the specified args to the launch args")
+	flag.StringVar(&qclauncher.ConfProfile, "profile", "", "Use the named settings profile instead of the selected one")
+	flag.StringVar(&qclauncher.ConfAccount, "account", "", "Switch to the stored Bethesda.net account with this username")
 	flag.Int64Var(&qclauncher.ConfUpdateInterval, "updateinterval", 86400, "Time in seconds between checking for launcher updates") // 24 hours (86400)
+	flag.Int64Var(&qclauncher.ConfStatusInterval, "statusinterval", 300, "Time in seconds between QC server status checks while QCLauncher is open (0 disables)")
 	flag.BoolVar(&qclauncher.ConfSkipUpdates, "skipupdates", false, "Skip checking for QC and launcher updates")
 	flag.BoolVar(&qclauncher.ConfEnforceHash, "enforcehash", true, "Enforce QC game hash checking (disabling is not recommended)")
 	flag.IntVar(&qclauncher.ConfMaxFPS, "maxfps", 0, "Max value to limit FPS to (experimental)")
 	flag.BoolVar(&qclauncher.ConfShowMainWindow, "show", false, "Restore the QCLauncher main UI window")
 	flag.BoolVar(&qclauncher.ConfUseEntitlementAPI, "entitlement", false, "Use Bethesda.net entitlement API")
+	flag.StringVar(&qclauncher.ConfMasterPassFile, "master-passphrase-file", "", "File containing the master passphrase, for commands run from scripts")
+	flag.StringVar(&qclauncher.ConfStore, "store", qclauncher.StoreBolt, "Where to keep settings: bolt (data.qcl), json (data.json) or memory (not saved)")
 }
 
 func main() {
 	flag.Parse()
+	qclauncher.LoadLayeredConfig(flag.CommandLine)
 	qclauncher.Setup()
+	if flag.NArg() > 0 {
+		code := qclauncher.RunCommand(flag.Args())
+		qclauncher.CloseDataStore()
+		os.Exit(code)
+	}
 	execMain()
 }
 
@@ -45,6 +60,7 @@ func execMain() {
 		return
 	}
 	defer qclauncher.Lock.Unlock()
+	defer qclauncher.CloseDataStore()
 	mainlogger := qclauncher.NewLogger()
 	running, _, _, _, namepids, err := qclauncher.IsProcessRunning(qclauncher.QCExe)
 	if err != nil {
@@ -58,11 +74,28 @@ func execMain() {
 			return
 		}
 	}
-	if !qclauncher.FileExists(qclauncher.GetDataFilePath()) {
+	if !qclauncher.DataStoreExists() {
 		qclauncher.LoadUI(qclauncher.GetEmptyConfiguration())
 		return
 	}
+	if err := qclauncher.ConfigureAccount(); err != nil {
+		mainlogger.Errorw(fmt.Sprintf("%s: error switching account", qclauncher.GetCaller()), "error", err)
+		qclauncher.ShowFatalErrorMsg("Error", fmt.Sprintf("Unable to switch account: %s", err), nil)
+		return
+	}
 	cfg, err := qclauncher.GetConfiguration()
+	// restore the newest good backup rather than resetting
+	if qclauncher.IsErrCorrupted(err) {
+		if !qclauncher.RecoverDataFile() {
+			return
+		}
+		cfg, err = qclauncher.GetConfiguration()
+	}
+	// -profile named a profile that does not exist, or the passphrase prompt was dismissed: nothing to reset
+	if qclauncher.IsErrUsage(err) || qclauncher.IsErrLocked(err) || qclauncher.IsErrAuthFailed(err) {
+		qclauncher.ShowErrorMsg("Error", err.Error(), nil)
+		return
+	}
 	if err != nil {
 		qclauncher.ShowErrorMsg("Error", "An error occurred when retrieving your settings. Resetting.", nil)
 		qclauncher.DeleteConfiguration(false)
@@ -73,11 +106,7 @@ func execMain() {
 		// param of type UpdateLauncher to this call throws no error
 		_ = qclauncher.CheckUpdate(qclauncher.ConfEnforceHash, qclauncher.UpdateLauncher)
 	}
-	if qclauncher.ConfUseEntitlementAPI {
-		qclauncher.UseEntitlementAPI = false
-	} else {
-		qclauncher.SetEntitlementAPI()
-	}
+	qclauncher.ConfigureEntitlementAPI()
 	if qclauncher.ConfShowMainWindow {
 		qclauncher.LoadUI(cfg)
 		return
@@ -0,0 +1,129 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+// qclsign signs the documents that QCLauncher downloads from qc.syncore.org. Each document is published
+// with a detached signature next to it (e.g. qcl_latest_version.json.sig) holding the base64 ed25519
+// signature of the exact bytes served.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	signatureExt = ".sig"
+	usage        = `usage:
+  qclsign genkey <private key file>
+  qclsign sign <private key file> <file>...
+  qclsign verify <base64 public key> <file>...
+
+genkey prints the public key to put in remotePublicKey (signing.go). The private key file must be kept secret.`
+)
+
+func main() {
+	flag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch args[0] {
+	case "genkey":
+		err = genKey(args[1])
+	case "sign":
+		err = sign(args[1], args[2:])
+	case "verify":
+		err = verify(args[1], args[2:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "qclsign: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func genKey(p string) error {
+	if _, err := os.Stat(p); err == nil {
+		return fmt.Errorf("%s already exists", p)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(p, []byte(base64.StdEncoding.EncodeToString(priv)+"\n"), 0600); err != nil {
+		return err
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(pub))
+	return nil
+}
+
+func sign(keyFile string, files []string) error {
+	if len(files) == 0 {
+		return errors.New("no files to sign")
+	}
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	priv, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return fmt.Errorf("%s is not a qclsign private key", keyFile)
+	}
+	for _, f := range files {
+		doc, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		sig := ed25519.Sign(ed25519.PrivateKey(priv), doc)
+		if err = ioutil.WriteFile(f+signatureExt, []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("signed %s\n", f)
+	}
+	return nil
+}
+
+func verify(pubKey string, files []string) error {
+	if len(files) == 0 {
+		return errors.New("no files to verify")
+	}
+	pub, err := base64.StdEncoding.DecodeString(pubKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New("invalid public key")
+	}
+	failed := 0
+	for _, f := range files {
+		doc, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(f + signatureExt)
+		if err != nil {
+			return err
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || !ed25519.Verify(ed25519.PublicKey(pub), doc, sig) {
+			fmt.Printf("INVALID %s\n", f)
+			failed++
+			continue
+		}
+		fmt.Printf("OK %s\n", f)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d file(s) failed verification", failed)
+	}
+	return nil
+}
@@ -10,7 +10,6 @@ import (
 
 const (
 	LogFile            = "qclauncher.log"
-	DataFile           = "data.qcl"
 	LockFile           = "qcl.lock"
 	ShowMainWindowFlag = "show"
 	XAppDefVer         = "1.43.3"
@@ -23,14 +22,21 @@ const (
 )
 
 var (
+	DataFile              = "data.qcl" // depends on the store (see setStoreBackend)
 	ConfLocal             bool
 	ConfDebug             bool
 	ConfAppendCustomArgs  string
+	ConfProfile           string
+	ConfAccount           string
 	ConfLocalAddr         string
 	ConfXAppVer           string
 	ConfXLibVer           string
 	ConfXSrcFp            string
+	ConfFPChain           string
+	ConfFPFile            string
+	ConfFPTransport       string
 	ConfUpdateInterval    int64
+	ConfStatusInterval    int64
 	ConfSkipUpdates       bool
 	ConfEnforceHash       bool
 	ConfMaxFPS            int
@@ -38,11 +44,19 @@ var (
 	ConfBaseBi            string
 	ConfShowMainWindow    bool
 	ConfUseEntitlementAPI bool
+	ConfHeadless          bool
+	ConfStore             string
+	ConfMasterPassFile    string
 	Lock                  *Single
 )
 
 func Setup() {
+	if ConfXSrcFp != XSrcFpDef {
+		addLogSecrets(ConfXSrcFp)
+	}
 	setLogger()
+	logConfigProblems()
+	setStoreBackend()
 	setLock()
 	setBaseAddr()
 	setVersionInfo()
@@ -0,0 +1,165 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	ConfigFile          = "qclauncher.toml"
+	configEnvPrefix     = "QCL_"
+	configSourceFlag    = "flag"
+	configSourceEnv     = "environment"
+	configSourceFile    = "config file"
+	configSourceStored  = "stored"
+	configSourceDefault = "default"
+)
+
+// ConfigValue is an effective option or setting and the layer it came from.
+type ConfigValue struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	From   string `json:"from,omitempty"`
+}
+
+var (
+	configFlags    *flag.FlagSet
+	configSources  = map[string]*ConfigValue{}
+	configFileVals = map[string]string{}
+	configProblems []string
+)
+
+// LoadLayeredConfig fills in the options that were not given on the command line, first from QCL_*
+// environment variables and then from qclauncher.toml next to the exe. It must be called after the
+// flags are parsed and before Setup.
+func LoadLayeredConfig(fs *flag.FlagSet) {
+	configFlags = fs
+	configFileVals = readConfigFile(getConfigFilePath())
+	for k := range configFileVals {
+		if fs.Lookup(k) == nil {
+			if sk, err := getSettingKey(k); err != nil || sk.readOnly {
+				configProblems = append(configProblems, fmt.Sprintf("%s: unknown option: %s", ConfigFile, k))
+			}
+		}
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	fs.VisitAll(func(f *flag.Flag) {
+		cv := &ConfigValue{Key: f.Name, Source: configSourceDefault}
+		if given[f.Name] {
+			cv.Source, cv.From = configSourceFlag, "-"+f.Name
+		} else if v, source, from, ok := lookupConfigLayer(f.Name); ok {
+			if err := fs.Set(f.Name, v); err != nil {
+				configProblems = append(configProblems, fmt.Sprintf("%s: invalid value for %s: %s", from, f.Name, v))
+			} else {
+				cv.Source, cv.From = source, from
+			}
+		}
+		configSources[f.Name] = cv
+	})
+}
+
+func logConfigProblems() {
+	for _, p := range configProblems {
+		logger.Warnw("ignoring configuration value", "problem", p)
+	}
+}
+
+// lookupConfigLayer returns the value of an option or setting from the environment or the config file.
+func lookupConfigLayer(key string) (value, source, from string, ok bool) {
+	env := configEnvName(key)
+	if v, found := os.LookupEnv(env); found {
+		return v, configSourceEnv, env, true
+	}
+	if v, found := configFileVals[strings.ToLower(key)]; found {
+		return v, configSourceFile, ConfigFile, true
+	}
+	return "", "", "", false
+}
+
+// applyConfigOverrides applies stored settings given in the environment or config file. They are never saved.
+func applyConfigOverrides(cfg *Configuration) {
+	for _, k := range getSettingKeys() {
+		if k.readOnly {
+			continue
+		}
+		v, _, from, ok := lookupConfigLayer(k.name)
+		if !ok {
+			continue
+		}
+		if err := k.set(cfg, v); err != nil {
+			logger.Warnw(fmt.Sprintf("%s: ignoring invalid setting override", GetCaller()), "setting", k.name, "from", from,
+				"error", err)
+		}
+	}
+}
+
+// ExplainConfig lists every option, and every setting when cfg is not nil, with the layer its value came from.
+func ExplainConfig(cfg *Configuration) []*ConfigValue {
+	var values []*ConfigValue
+	if configFlags != nil {
+		configFlags.VisitAll(func(f *flag.Flag) {
+			cv := *configSources[f.Name]
+			cv.Value = f.Value.String()
+			if f.Name == "fp" {
+				cv.Value = truncateSecret(cv.Value, supportFpPrefixLen)
+			}
+			values = append(values, &cv)
+		})
+	}
+	if cfg == nil {
+		return values
+	}
+	for _, k := range getSettingKeys() {
+		cv := &ConfigValue{Key: k.name, Value: k.get(cfg), Source: configSourceStored}
+		if _, source, from, ok := lookupConfigLayer(k.name); ok && !k.readOnly {
+			cv.Source, cv.From = source, from
+		}
+		values = append(values, cv)
+	}
+	return values
+}
+
+func readConfigFile(p string) map[string]string {
+	vals := map[string]string{}
+	if !FileExists(p) {
+		return vals
+	}
+	var raw map[string]interface{}
+	if _, err := toml.DecodeFile(p, &raw); err != nil {
+		configProblems = append(configProblems, fmt.Sprintf("%s: %s", ConfigFile, err))
+		return vals
+	}
+	for k, v := range raw {
+		section, isTable := v.(map[string]interface{})
+		if !isTable {
+			vals[strings.ToLower(k)] = fmt.Sprint(v)
+			continue
+		}
+		for name, sv := range section {
+			if _, nested := sv.(map[string]interface{}); nested {
+				configProblems = append(configProblems, fmt.Sprintf("%s: unexpected table: %s.%s", ConfigFile, k, name))
+				continue
+			}
+			vals[strings.ToLower(k+"."+name)] = fmt.Sprint(sv)
+		}
+	}
+	return vals
+}
+
+func configEnvName(key string) string {
+	return configEnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+func getConfigFilePath() string {
+	return filepath.Join(getExecutingPath(), ConfigFile)
+}
@@ -5,13 +5,17 @@ package qclauncher
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
-
-	bolt "github.com/coreos/bbolt"
+	"io"
+	"strings"
+	"sync"
 )
 
+// LauncherStore is the data file handle shared by the whole process; see newLauncherDataStore.
 type LauncherStore struct {
-	*bolt.DB
+	DataStore
+	checked bool // the data file version was checked (and migrated) since it was opened
 }
 
 type Storable interface {
@@ -19,29 +23,144 @@ type Storable interface {
 	save(*LauncherStore) error
 }
 
+// DataStore holds the launcher's buckets of keys and values. The methods follow bolt's, which is the
+// default backend; an Update that returns an error leaves the store unchanged.
+type DataStore interface {
+	View(fn func(tx DataTx) error) error
+	Update(fn func(tx DataTx) error) error
+	// Snapshot writes a consistent copy of the whole store in the backend's file format (for backups).
+	Snapshot(w io.Writer) error
+	Close() error
+}
+
+type DataTx interface {
+	Bucket(name []byte) DataBucket // nil if the bucket does not exist
+	CreateBucketIfNotExists(name []byte) (DataBucket, error)
+}
+
+// DataBucket keys are ordered byte-wise. Values returned by Get are only valid during the transaction.
+type DataBucket interface {
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	ForEach(fn func(k, v []byte) error) error
+	Cursor() DataCursor
+}
+
+type DataCursor interface {
+	First() (key, value []byte)
+	Last() (key, value []byte)
+	Next() (key, value []byte)
+}
+
+type storeBackend interface {
+	fileName() string // "" if nothing is written to disk
+	sealed() bool     // records carry integrity checks (see integrity.go)
+	open(p string, readOnly bool) (DataStore, error)
+	exists(p string) bool
+	remove(p string) error
+	encode(v interface{}) ([]byte, error)
+	decode(data []byte, v interface{}) error
+}
+
 const (
-	dataFileVersion           int64 = 4
+	StoreBolt                       = "bolt"
+	StoreJSON                       = "json"
+	StoreMemory                     = "memory"
+	dataFileVersion           int64 = 10
 	bucketSettings                  = "sb"
 	bucketLastUpdate                = "lub"
+	bucketServerStatus              = "ssb"
+	bucketProfiles                  = "pb"
+	bucketAccounts                  = "ab"
+	bucketSecrets                   = "scb"
+	bucketRemote                    = "rsb"
+	bucketIntegrity                 = "ib"
 	keyQCCoreSettings               = "core"
 	keyQCExperimentalSettings       = "exp"
 	keyLauncherSettings             = "lch"
-	keyTokenAuth                    = "atkn"
+	keyTokenAuth                    = "atkn" // before version 7
+	keyTokenInfo                    = "atki"
 	keyTokenKey                     = "rndenc"
 	keyLastUpdateQC                 = "luqc"
 	keyLastUpdateLauncher           = "lulc"
 	keyDfVer                        = "dfver"
+	keyActiveProfile                = "actp"
+	keyMasterLock                   = "mlk"
+	keyIntegrity                    = "ik"
 )
 
 var (
-	dataFileIncompatible = fmt.Sprintf(
-		"Your %s file is from an old version of QCLauncher and is not supported by this version. You must restart QCLauncher to reset your settings.",
+	dataFileTooNew          = fmt.Sprintf("Your %s file is from a newer version of QCLauncher. Please update QCLauncher.", DataFile)
+	dataFileMigrationFailed = fmt.Sprintf(
+		"Unable to upgrade your %s file from an older version of QCLauncher. The file was not changed. Delete it and restart QCLauncher to start over.",
 		DataFile)
-	tmpToken string
-	tmpKey   *[]byte
-	tmpFp    string
+	tmpToken     string
+	tmpSessionID string
+	tmpKey       *[]byte
+	tmpFp        string
+
+	errDataStoreBusy = errors.New("the data store is in use by another program")
+	storeBackends    = map[string]storeBackend{
+		StoreBolt:   &boltBackend{},
+		StoreJSON:   &jsonBackend{},
+		StoreMemory: &memoryBackend{},
+	}
+	// every bucket that holds records, which are sealed and verified; bucketIntegrity holds the key they are
+	// checked with. A new bucket must be added here.
+	dataBuckets = []string{bucketSettings, bucketLastUpdate, bucketServerStatus, bucketProfiles, bucketAccounts,
+		bucketSecrets, bucketRemote}
+	activeStore   = storeBackends[StoreBolt]
+	sharedStore   *LauncherStore
+	sharedStoreMu sync.Mutex
 )
 
+// setStoreBackend selects the backend given with -store.
+func setStoreBackend() {
+	b, ok := storeBackends[strings.ToLower(ConfStore)]
+	if !ok {
+		logger.Error(fmt.Sprintf("%s: unknown store: %s", GetCaller(), ConfStore))
+		ShowFatalErrorMsg("Error", fmt.Sprintf("Unknown settings store: %s. Use %s, %s or %s.", ConfStore, StoreBolt, StoreJSON,
+			StoreMemory), nil)
+		return
+	}
+	activeStore = b
+	if f := b.fileName(); f != "" {
+		DataFile = f
+	}
+}
+
+// DataStoreExists reports whether settings have been saved.
+func DataStoreExists() bool {
+	return activeStore.exists(GetDataFilePath())
+}
+
+func deleteDataStore() error {
+	return activeStore.remove(GetDataFilePath())
+}
+
+// openDataStore opens the data store at p, or the data file if p is empty. It gives up with errDataStoreBusy
+// if another program has the file open.
+func openDataStore(p string, readOnly bool) (DataStore, error) {
+	if p == "" {
+		p = GetDataFilePath()
+	}
+	return activeStore.open(p, readOnly)
+}
+
+// encodeRecord and decodeRecord convert stored records with the active backend's format.
+func encodeRecord(v interface{}) ([]byte, error) {
+	return activeStore.encode(v)
+}
+
+func decodeRecord(data []byte, v interface{}) error {
+	return activeStore.decode(data, v)
+}
+
+func isFileStore() bool {
+	return activeStore.fileName() != ""
+}
+
 func Save(s Storable) error {
 	ls, err := newLauncherDataStore()
 	if err != nil {
@@ -62,22 +181,90 @@ func Get(s Storable) error {
 	return s.get(ls)
 }
 
+// newLauncherDataStore returns the process's data file handle, opening it the first time. The handle stays
+// open until closeDataStore; Close on the returned store does nothing.
 func newLauncherDataStore() (*LauncherStore, error) {
-	db, err := bolt.Open(GetDataFilePath(), 0600, nil)
+	sharedStoreMu.Lock()
+	defer sharedStoreMu.Unlock()
+	if sharedStore != nil {
+		return sharedStore, nil
+	}
+	db, err := openDataStore("", false)
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error opening data file", GetCaller()), "error", err)
 		if db != nil {
 			db.Close()
 		}
+		if err == errDataStoreBusy {
+			ShowFatalErrorMsg("Error", fmt.Sprintf("Unable to open file: %s. It is in use by another copy of QCLauncher.",
+				DataFile), nil)
+			return nil, err
+		}
 		ShowFatalErrorMsg("Error", fmt.Sprintf("Unable to open file: %s. If %s exists, then delete it and try restarting QCLauncher.",
 			DataFile, DataFile), nil)
 		return nil, err
 	}
-	return &LauncherStore{db}, db.Update(func(tx *bolt.Tx) error {
+	if err = createBuckets(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	sharedStore = &LauncherStore{DataStore: db}
+	return sharedStore, nil
+}
+
+// Close keeps the shared handle open for the next caller.
+func (ls *LauncherStore) Close() error {
+	return nil
+}
+
+// reopen makes ls the shared handle again after the data file was replaced under it (see RestoreDataFile),
+// so that callers holding ls keep working.
+func (ls *LauncherStore) reopen() error {
+	fresh, err := newLauncherDataStore()
+	if err != nil {
+		return err
+	}
+	sharedStoreMu.Lock()
+	defer sharedStoreMu.Unlock()
+	*ls = *fresh
+	sharedStore = ls
+	return nil
+}
+
+// openedDataStore returns the shared handle, or nil if it is not open.
+func openedDataStore() *LauncherStore {
+	sharedStoreMu.Lock()
+	defer sharedStoreMu.Unlock()
+	return sharedStore
+}
+
+// closeDataStore closes the shared handle. It must be called before the data file is deleted or replaced.
+func closeDataStore() error {
+	defer setMasterKey(nil) // a restored file may have another passphrase
+	sharedStoreMu.Lock()
+	defer sharedStoreMu.Unlock()
+	if sharedStore == nil {
+		return nil
+	}
+	err := sharedStore.DataStore.Close()
+	sharedStore = nil
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error closing data file", GetCaller()), "error", err)
+	}
+	return err
+}
+
+// CloseDataStore releases the data file when QCLauncher exits.
+func CloseDataStore() {
+	closeDataStore()
+}
+
+func createBuckets(db DataStore) error {
+	return db.Update(func(tx DataTx) error {
 		_, dberr := tx.CreateBucketIfNotExists([]byte(bucketSettings))
 		if dberr != nil {
 			logger.Errorw(fmt.Sprintf("%s: error creating settings bucket", GetCaller()), "error", dberr)
-			if dberr = DeleteFile(GetDataFilePath()); dberr != nil {
+			if dberr = deleteDataStore(); dberr != nil {
 				logger.Errorw(fmt.Sprintf("%s: error deleting datafile during failed settings bucket creation", GetCaller()),
 					"error", dberr)
 			}
@@ -86,59 +273,83 @@ func newLauncherDataStore() (*LauncherStore, error) {
 		_, dberr = tx.CreateBucketIfNotExists([]byte(bucketLastUpdate))
 		if dberr != nil {
 			logger.Errorw(fmt.Sprintf("%s: error creating update time info bucket", GetCaller()), "error", dberr)
-			dberr = DeleteFile(GetDataFilePath())
+			dberr = deleteDataStore()
 			if dberr != nil {
 				logger.Errorw(fmt.Sprintf("%s: error deleting datafile during update time bucket creation", GetCaller()),
 					"error", dberr)
 			}
 			return dberr
 		}
+		_, dberr = tx.CreateBucketIfNotExists([]byte(bucketServerStatus))
+		if dberr != nil {
+			logger.Errorw(fmt.Sprintf("%s: error creating server status bucket", GetCaller()), "error", dberr)
+			return dberr
+		}
+		_, dberr = tx.CreateBucketIfNotExists([]byte(bucketProfiles))
+		if dberr != nil {
+			logger.Errorw(fmt.Sprintf("%s: error creating profiles bucket", GetCaller()), "error", dberr)
+			return dberr
+		}
+		_, dberr = tx.CreateBucketIfNotExists([]byte(bucketAccounts))
+		if dberr != nil {
+			logger.Errorw(fmt.Sprintf("%s: error creating accounts bucket", GetCaller()), "error", dberr)
+			return dberr
+		}
+		if dberr = sealNewDataFile(tx); dberr != nil {
+			logger.Errorw(fmt.Sprintf("%s: error creating integrity key", GetCaller()), "error", dberr)
+			return dberr
+		}
 		return nil
 	})
 }
 
 func (ls *LauncherStore) checkDataFile(skipVersionCheck bool) {
-	if !FileExists(GetDataFilePath()) {
+	if !DataStoreExists() {
 		logger.Error(fmt.Sprintf("%s: data file does not exist", GetCaller()))
 		ShowFatalErrorMsg("Error", fmt.Sprintf("Your %s file is missing. Try re-running QCLauncher.", DataFile), nil)
 		return
 	}
-	if skipVersionCheck {
+	if skipVersionCheck || ls.checked {
 		return
 	}
 	var v []byte
-	if err := ls.View(func(tx *bolt.Tx) error {
+	if err := ls.View(func(tx DataTx) error {
 		b := tx.Bucket([]byte(bucketLastUpdate))
 		v = b.Get([]byte(keyDfVer))
 		return nil
 	}); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error getting data file version from datastore", GetCaller()), "error", err)
-		if ls != nil && ls.DB != nil {
-			ls.Close()
+		if IsErrCorrupted(err) {
+			ls.recoverDataFile()
+			return
 		}
 		DeleteConfiguration(true)
 		ShowFatalErrorMsg("Error", "Could not determine data file version. Please restart QCLauncher to reset your settings.", nil)
 		return
 	}
-	if len(v) == 0 {
-		logger.Error(fmt.Sprintf("%s: error getting data file version from datastore (may be an old version of %s)", GetCaller(),
-			DataFile))
-		if ls != nil && ls.DB != nil {
-			ls.Close()
-		}
-		DeleteConfiguration(true)
-		ShowFatalErrorMsg("Error", dataFileIncompatible, nil)
+	var savedVer int64 // unversioned files are from before versioning was added
+	if len(v) == 8 {
+		savedVer = int64(binary.LittleEndian.Uint64(v))
+	}
+	if savedVer == dataFileVersion {
+		ls.checked = ls.checkIntegrity()
 		return
 	}
-	savedVer := int64(binary.LittleEndian.Uint64(v))
-	if savedVer != dataFileVersion {
-		logger.Error(fmt.Sprintf("%s: data file version incompatibility found. Detected: %d, needed: %d", GetCaller(),
+	if savedVer > dataFileVersion {
+		logger.Error(fmt.Sprintf("%s: data file is from a newer version of QCLauncher. Detected: %d, supported: %d", GetCaller(),
 			savedVer, dataFileVersion))
-		if ls != nil && ls.DB != nil {
-			ls.Close()
-		}
-		DeleteConfiguration(true)
-		ShowFatalErrorMsg("Error", dataFileIncompatible, nil)
+		closeDataStore()
+		ShowFatalErrorMsg("Error", dataFileTooNew, nil)
+		return
+	}
+	backup, err := ls.migrate(savedVer)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error migrating data file from version %d to %d", GetCaller(), savedVer, dataFileVersion),
+			"error", err)
+		closeDataStore()
+		ShowFatalErrorMsg("Error", dataFileMigrationFailed, nil)
 		return
 	}
+	logger.Infow("data file migration complete", "from", savedVer, "to", dataFileVersion, "backup", backup)
+	ls.checked = ls.checkIntegrity()
 }
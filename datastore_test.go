@@ -0,0 +1,277 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+type testRecord struct {
+	bucket, key string
+	value       []byte
+}
+
+var testRecords = []testRecord{
+	{bucketSettings, keyQCCoreSettings, []byte(`{"FilePath":"C:\\qc.exe","Language":"en"}`)},
+	{bucketSettings, keyLauncherSettings, []byte{0x0d, 0xff, 0x81, 0x03, 0x01}},
+	{bucketLastUpdate, keyDfVer, []byte{8, 0, 0, 0, 0, 0, 0, 0}},
+	{bucketAccounts, string([]byte{0x00, 0x9f, 0xfe}), []byte("binary key")},
+	{bucketProfiles, "duel", []byte(`["a","b"]`)},
+}
+
+var errTestRollback = errors.New("rolled back")
+
+// forEachBackend runs fn against an empty store of every backend.
+func forEachBackend(t *testing.T, fn func(t *testing.T, b storeBackend, p string, db DataStore)) {
+	for _, name := range []string{StoreBolt, StoreJSON, StoreMemory} {
+		t.Run(name, func(t *testing.T) {
+			b := storeBackends[name]
+			useBackend(t, b)
+			p := filepath.Join(t.TempDir(), "data")
+			db, err := b.open(p, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			fn(t, b, p, db)
+		})
+	}
+}
+
+func putTestRecords(t *testing.T, db DataStore) {
+	t.Helper()
+	if err := db.Update(func(tx DataTx) error {
+		for _, r := range testRecords {
+			b, err := tx.CreateBucketIfNotExists([]byte(r.bucket))
+			if err != nil {
+				return err
+			}
+			if err = b.Put([]byte(r.key), r.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkTestRecords(t *testing.T, db DataStore) {
+	t.Helper()
+	if err := db.View(func(tx DataTx) error {
+		for _, r := range testRecords {
+			b := tx.Bucket([]byte(r.bucket))
+			if b == nil {
+				t.Errorf("bucket %s is missing", r.bucket)
+				continue
+			}
+			if v := b.Get([]byte(r.key)); !bytes.Equal(v, r.value) {
+				t.Errorf("%s/%q: expected %q, got %q", r.bucket, r.key, r.value, v)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b storeBackend, p string, db DataStore) {
+		putTestRecords(t, db)
+		checkTestRecords(t, db)
+		if err := db.Update(func(tx DataTx) error {
+			return tx.Bucket([]byte(bucketProfiles)).Delete([]byte("duel"))
+		}); err != nil {
+			t.Fatal(err)
+		}
+		db.View(func(tx DataTx) error {
+			if v := tx.Bucket([]byte(bucketProfiles)).Get([]byte("duel")); v != nil {
+				t.Errorf("deleted value is still stored: %q", v)
+			}
+			return nil
+		})
+	})
+}
+
+func TestStoreUpdateRollback(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b storeBackend, p string, db DataStore) {
+		putTestRecords(t, db)
+		err := db.Update(func(tx DataTx) error {
+			sb := tx.Bucket([]byte(bucketSettings))
+			if err := sb.Put([]byte(keyQCCoreSettings), []byte("changed")); err != nil {
+				return err
+			}
+			if err := sb.Put([]byte("new"), []byte("added")); err != nil {
+				return err
+			}
+			if err := tx.Bucket([]byte(bucketProfiles)).Delete([]byte("duel")); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucketSecrets)); err != nil {
+				return err
+			}
+			return errTestRollback
+		})
+		if err != errTestRollback {
+			t.Fatalf("expected the Update's error, got %v", err)
+		}
+		checkTestRecords(t, db)
+		db.View(func(tx DataTx) error {
+			if v := tx.Bucket([]byte(bucketSettings)).Get([]byte("new")); v != nil {
+				t.Errorf("value added by a failed Update is stored: %q", v)
+			}
+			if tx.Bucket([]byte(bucketSecrets)) != nil {
+				t.Error("bucket created by a failed Update exists")
+			}
+			return nil
+		})
+	})
+}
+
+func TestStoreViewIsReadOnly(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b storeBackend, p string, db DataStore) {
+		putTestRecords(t, db)
+		db.View(func(tx DataTx) error {
+			if err := tx.Bucket([]byte(bucketSettings)).Put([]byte("new"), []byte("added")); err == nil {
+				t.Error("Put succeeded in a View")
+			}
+			if err := tx.Bucket([]byte(bucketSettings)).Delete([]byte(keyQCCoreSettings)); err == nil {
+				t.Error("Delete succeeded in a View")
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucketSecrets)); err == nil {
+				t.Error("CreateBucketIfNotExists succeeded in a View")
+			}
+			return nil
+		})
+		checkTestRecords(t, db)
+	})
+}
+
+func TestStoreMissingBucket(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b storeBackend, p string, db DataStore) {
+		db.View(func(tx DataTx) error {
+			if b := tx.Bucket([]byte(bucketSecrets)); b != nil {
+				t.Errorf("expected a nil bucket, got %#v", b)
+			}
+			return nil
+		})
+	})
+}
+
+func TestStoreCursorOrder(t *testing.T) {
+	keys := []string{"a", "B", "ab", "\x00", "\xff", "b"}
+	ordered := []string{"\x00", "B", "a", "ab", "b", "\xff"}
+	forEachBackend(t, func(t *testing.T, b storeBackend, p string, db DataStore) {
+		if err := db.Update(func(tx DataTx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte(bucketServerStatus))
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if err = b.Put([]byte(k), []byte(k)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		db.View(func(tx DataTx) error {
+			var got []string
+			c := tx.Bucket([]byte(bucketServerStatus)).Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				if !bytes.Equal(k, v) {
+					t.Errorf("cursor returned %q for %q", v, k)
+				}
+				got = append(got, string(k))
+			}
+			if len(got) != len(ordered) {
+				t.Fatalf("expected %q, got %q", ordered, got)
+			}
+			for i := range got {
+				if got[i] != ordered[i] {
+					t.Fatalf("expected %q, got %q", ordered, got)
+				}
+			}
+			if k, _ := c.Last(); string(k) != ordered[len(ordered)-1] {
+				t.Errorf("expected the last key to be %q, got %q", ordered[len(ordered)-1], k)
+			}
+			var each []string
+			tx.Bucket([]byte(bucketServerStatus)).ForEach(func(k, v []byte) error {
+				each = append(each, string(k))
+				return nil
+			})
+			if len(each) != len(ordered) || each[0] != ordered[0] {
+				t.Errorf("ForEach returned %q", each)
+			}
+			return nil
+		})
+	})
+}
+
+func TestStoreSnapshotRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b storeBackend, p string, db DataStore) {
+		putTestRecords(t, db)
+		buf := &bytes.Buffer{}
+		if err := db.Snapshot(buf); err != nil {
+			t.Fatal(err)
+		}
+		if b.fileName() == "" {
+			// memory snapshots are in the JSON format, as there is no file to restore them to
+			tree, err := readStoreTree(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range testRecords {
+				if v := tree[r.bucket][r.key]; !bytes.Equal(v, r.value) {
+					t.Errorf("%s/%q: expected %q in the snapshot, got %q", r.bucket, r.key, r.value, v)
+				}
+			}
+			return
+		}
+		snap := p + ".snapshot"
+		if err := ioutil.WriteFile(snap, buf.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+		restored, err := b.open(snap, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer restored.Close()
+		checkTestRecords(t, restored)
+	})
+}
+
+func TestDataStoreSharedHandle(t *testing.T) {
+	useMemoryStore(t, nil)
+	t.Cleanup(func() { closeDataStore() })
+	first, err := newLauncherDataStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+	first.Close()
+	second, err := newLauncherDataStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first || openedDataStore() != first {
+		t.Fatal("Close released the shared handle")
+	}
+	closeDataStore()
+	if openedDataStore() != nil {
+		t.Fatal("closeDataStore kept the handle open")
+	}
+	third, err := newLauncherDataStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first {
+		t.Fatal("a closed handle was handed out again")
+	}
+}
@@ -0,0 +1,110 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// boltBackend keeps the settings in data.qcl with gob-encoded records.
+type boltBackend struct {
+	gobCodec
+}
+
+type gobCodec struct{}
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+type boltBucket struct {
+	*bolt.Bucket
+}
+
+func (b *boltBackend) fileName() string {
+	return "data.qcl"
+}
+
+func (b *boltBackend) sealed() bool {
+	return true
+}
+
+func (b *boltBackend) open(p string, readOnly bool) (DataStore, error) {
+	db, err := bolt.Open(p, 0600, &bolt.Options{ReadOnly: readOnly, Timeout: 2 * time.Second})
+	if err == bolt.ErrTimeout {
+		return nil, errDataStoreBusy
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db}, nil
+}
+
+func (b *boltBackend) exists(p string) bool {
+	return FileExists(p)
+}
+
+func (b *boltBackend) remove(p string) error {
+	return DeleteFile(p)
+}
+
+func (gobCodec) encode(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) decode(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(v)
+}
+
+func (s *boltStore) View(fn func(tx DataTx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error { return fn(&boltTx{tx}) })
+}
+
+func (s *boltStore) Update(fn func(tx DataTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error { return fn(&boltTx{tx}) })
+}
+
+func (s *boltStore) Snapshot(w io.Writer) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func (t *boltTx) Bucket(name []byte) DataBucket {
+	b := t.tx.Bucket(name)
+	if b == nil {
+		return nil // not a non-nil interface holding a nil *bolt.Bucket
+	}
+	return &boltBucket{b}
+}
+
+func (t *boltTx) CreateBucketIfNotExists(name []byte) (DataBucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return &boltBucket{b}, nil
+}
+
+func (b *boltBucket) Cursor() DataCursor {
+	return b.Bucket.Cursor()
+}
@@ -0,0 +1,211 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// jsonBackend keeps the settings in data.json as readable JSON records. Binary keys are written as
+// "base64:<key>" and values that are not records (e.g. the credential key) as base64 strings.
+type jsonBackend struct{}
+
+type jsonStore struct {
+	p        string
+	readOnly bool
+}
+
+const jsonBinaryKeyPrefix = "base64:"
+
+var jsonStoreMu sync.RWMutex // the file is read and replaced whole, so writers must not overlap
+
+func (b *jsonBackend) fileName() string {
+	return "data.json"
+}
+
+// sealed is false so that data.json stays readable and can be edited by hand.
+func (b *jsonBackend) sealed() bool {
+	return false
+}
+
+func (b *jsonBackend) open(p string, readOnly bool) (DataStore, error) {
+	if readOnly && !FileExists(p) {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	return &jsonStore{p: p, readOnly: readOnly}, nil
+}
+
+func (b *jsonBackend) exists(p string) bool {
+	return FileExists(p)
+}
+
+func (b *jsonBackend) remove(p string) error {
+	return DeleteFile(p)
+}
+
+func (b *jsonBackend) encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (b *jsonBackend) decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (s *jsonStore) View(fn func(tx DataTx) error) error {
+	jsonStoreMu.RLock()
+	defer jsonStoreMu.RUnlock()
+	tree, err := s.read()
+	if err != nil {
+		return err
+	}
+	return fn(&treeTx{tree: tree, readOnly: true})
+}
+
+func (s *jsonStore) Update(fn func(tx DataTx) error) error {
+	if s.readOnly {
+		return errStoreReadOnly
+	}
+	jsonStoreMu.Lock()
+	defer jsonStoreMu.Unlock()
+	tree, err := s.read()
+	if err != nil {
+		return err
+	}
+	if err = fn(&treeTx{tree: tree}); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err = writeStoreTree(buf, tree); err != nil {
+		return err
+	}
+	// written next to the file and renamed over it so that a crash can't leave half a file
+	tmp := s.p + ".tmp"
+	if err = ioutil.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.p); err != nil {
+		DeleteFile(tmp)
+		return err
+	}
+	return nil
+}
+
+func (s *jsonStore) Snapshot(w io.Writer) error {
+	jsonStoreMu.RLock()
+	defer jsonStoreMu.RUnlock()
+	tree, err := s.read()
+	if err != nil {
+		return err
+	}
+	return writeStoreTree(w, tree)
+}
+
+func (s *jsonStore) Close() error {
+	return nil
+}
+
+func (s *jsonStore) read() (storeTree, error) {
+	data, err := ioutil.ReadFile(s.p)
+	if os.IsNotExist(err) {
+		return storeTree{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readStoreTree(data)
+}
+
+func writeStoreTree(w io.Writer, tree storeTree) error {
+	out := map[string]map[string]json.RawMessage{}
+	for name, values := range tree {
+		out[name] = map[string]json.RawMessage{}
+		for k, v := range values {
+			key := k
+			if !isPlainJSONKey(k) {
+				key = jsonBinaryKeyPrefix + base64.StdEncoding.EncodeToString([]byte(k))
+			}
+			if isJSONRecord(v) {
+				out[name][key] = json.RawMessage(v)
+				continue
+			}
+			encoded, err := json.Marshal(base64.StdEncoding.EncodeToString(v))
+			if err != nil {
+				return err
+			}
+			out[name][key] = encoded
+		}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func readStoreTree(data []byte) (storeTree, error) {
+	in := map[string]map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("not a valid %s file: %s", DataFile, err)
+	}
+	tree := storeTree{}
+	for name, values := range in {
+		tree[name] = map[string][]byte{}
+		for key, raw := range values {
+			k := key
+			if strings.HasPrefix(key, jsonBinaryKeyPrefix) {
+				dk, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(key, jsonBinaryKeyPrefix))
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid key: %s", name, key)
+				}
+				k = string(dk)
+			}
+			raw = bytes.TrimSpace(raw)
+			if len(raw) > 0 && raw[0] == '"' {
+				var s string
+				if err := json.Unmarshal(raw, &s); err != nil {
+					return nil, fmt.Errorf("%s: invalid value for %s", name, key)
+				}
+				v, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid value for %s", name, key)
+				}
+				tree[name][k] = v
+				continue
+			}
+			compact := new(bytes.Buffer)
+			if err := json.Compact(compact, raw); err != nil {
+				return nil, fmt.Errorf("%s: invalid value for %s", name, key)
+			}
+			tree[name][k] = compact.Bytes()
+		}
+	}
+	return tree, nil
+}
+
+func isPlainJSONKey(k string) bool {
+	if k == "" || strings.HasPrefix(k, jsonBinaryKeyPrefix) {
+		return false
+	}
+	for _, r := range k {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isJSONRecord reports whether v is a record written by the JSON codec rather than raw bytes.
+func isJSONRecord(v []byte) bool {
+	return len(v) > 0 && (v[0] == '{' || v[0] == '[') && json.Valid(v)
+}
@@ -0,0 +1,191 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+// storeTree is the contents of a memory or JSON store: buckets by name, then values by key.
+type storeTree map[string]map[string][]byte
+
+type treeTx struct {
+	tree     storeTree
+	readOnly bool
+}
+
+type treeBucket struct {
+	values   map[string][]byte
+	readOnly bool
+}
+
+type treeCursor struct {
+	b    *treeBucket
+	keys []string
+	pos  int
+}
+
+var errStoreReadOnly = errors.New("the transaction is read-only")
+
+func (t storeTree) copy() storeTree {
+	c := storeTree{}
+	for name, values := range t {
+		c[name] = map[string][]byte{}
+		for k, v := range values {
+			c[name][k] = v // values are never modified in place, only replaced
+		}
+	}
+	return c
+}
+
+func (t *treeTx) Bucket(name []byte) DataBucket {
+	values, ok := t.tree[string(name)]
+	if !ok {
+		return nil
+	}
+	return &treeBucket{values: values, readOnly: t.readOnly}
+}
+
+func (t *treeTx) CreateBucketIfNotExists(name []byte) (DataBucket, error) {
+	if b := t.Bucket(name); b != nil {
+		return b, nil
+	}
+	if t.readOnly {
+		return nil, errStoreReadOnly
+	}
+	if len(name) == 0 {
+		return nil, errors.New("bucket name required")
+	}
+	t.tree[string(name)] = map[string][]byte{}
+	return t.Bucket(name), nil
+}
+
+func (b *treeBucket) Get(key []byte) []byte {
+	return b.values[string(key)]
+}
+
+func (b *treeBucket) Put(key, value []byte) error {
+	if b.readOnly {
+		return errStoreReadOnly
+	}
+	if len(key) == 0 {
+		return errors.New("key required")
+	}
+	b.values[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (b *treeBucket) Delete(key []byte) error {
+	if b.readOnly {
+		return errStoreReadOnly
+	}
+	delete(b.values, string(key))
+	return nil
+}
+
+func (b *treeBucket) ForEach(fn func(k, v []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *treeBucket) Cursor() DataCursor {
+	keys := make([]string, 0, len(b.values))
+	for k := range b.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // byte-wise, like bolt
+	return &treeCursor{b: b, keys: keys}
+}
+
+func (c *treeCursor) at(pos int) ([]byte, []byte) {
+	c.pos = pos
+	if pos < 0 || pos >= len(c.keys) {
+		return nil, nil
+	}
+	return []byte(c.keys[pos]), c.b.values[c.keys[pos]]
+}
+
+func (c *treeCursor) First() ([]byte, []byte) {
+	return c.at(0)
+}
+
+func (c *treeCursor) Last() ([]byte, []byte) {
+	return c.at(len(c.keys) - 1)
+}
+
+func (c *treeCursor) Next() ([]byte, []byte) {
+	return c.at(c.pos + 1)
+}
+
+// memoryBackend keeps the settings in memory until QCLauncher exits, which is useful for testing.
+type memoryBackend struct {
+	gobCodec
+}
+
+type memoryStore struct{}
+
+var (
+	memoryTree storeTree // nil until something is saved
+	memoryMu   sync.RWMutex
+)
+
+func (b *memoryBackend) fileName() string {
+	return ""
+}
+
+func (b *memoryBackend) sealed() bool {
+	return false // nothing outlives the process to be damaged
+}
+
+func (b *memoryBackend) open(p string, readOnly bool) (DataStore, error) {
+	return &memoryStore{}, nil
+}
+
+func (b *memoryBackend) exists(p string) bool {
+	memoryMu.RLock()
+	defer memoryMu.RUnlock()
+	return memoryTree != nil
+}
+
+func (b *memoryBackend) remove(p string) error {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+	memoryTree = nil
+	return nil
+}
+
+func (s *memoryStore) View(fn func(tx DataTx) error) error {
+	memoryMu.RLock()
+	defer memoryMu.RUnlock()
+	return fn(&treeTx{tree: memoryTree, readOnly: true})
+}
+
+func (s *memoryStore) Update(fn func(tx DataTx) error) error {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+	tree := memoryTree.copy()
+	if err := fn(&treeTx{tree: tree}); err != nil {
+		return err
+	}
+	memoryTree = tree
+	return nil
+}
+
+func (s *memoryStore) Snapshot(w io.Writer) error {
+	memoryMu.RLock()
+	defer memoryMu.RUnlock()
+	return writeStoreTree(w, memoryTree)
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,348 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	doctorPass          = "PASS"
+	doctorWarn          = "WARN"
+	doctorFail          = "FAIL"
+	doctorSkip          = "SKIP"
+	maxClockSkewWarn    = time.Minute
+	maxClockSkewFail    = 5 * time.Minute
+	doctorUpdateBaseURL = "https://qc.syncore.org"
+	doctorCheckDataFile = "Data file"
+)
+
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+type DoctorReport struct {
+	Time    time.Time     `json:"time"`
+	Version string        `json:"version"`
+	Checks  []DoctorCheck `json:"checks"`
+}
+
+type doctor struct {
+	report     *DoctorReport
+	cfg        *Configuration
+	serverTime time.Time
+}
+
+// RunDoctor runs every diagnostic check. It never modifies the data file, lock file or QC install.
+func RunDoctor() *DoctorReport {
+	d := &doctor{report: &DoctorReport{Time: time.Now(), Version: fmt.Sprintf("%.2f", version)}}
+	dataFileOK := d.checkDataFile()
+	d.checkLockFile()
+	d.checkConfigLayers()
+	d.checkEndpoints()
+	if dataFileOK {
+		d.loadConfiguration()
+	}
+	d.checkFingerprintAndToken()
+	d.checkQCInstall()
+	d.checkSteam()
+	d.checkClock()
+	for _, c := range d.report.Checks {
+		if c.Result == doctorFail {
+			logger.Errorw(fmt.Sprintf("%s: diagnostic check failed", GetCaller()), "check", c.Name, "detail", c.Detail)
+		}
+	}
+	return d.report
+}
+
+func (r *DoctorReport) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Result == doctorFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *DoctorReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "QCLauncher %s diagnostics (%s)\n", r.Version, r.Time.Format(time.RFC1123))
+	for _, c := range r.Checks {
+		fmt.Fprintf(&b, "\n[%s] %s", c.Result, c.Name)
+		if c.Detail != "" {
+			fmt.Fprintf(&b, ": %s", c.Detail)
+		}
+		if c.Hint != "" {
+			fmt.Fprintf(&b, "\n       Fix: %s", c.Hint)
+		}
+	}
+	return b.String()
+}
+
+func (d *doctor) add(name, result, detail, hint string) {
+	d.report.Checks = append(d.report.Checks, DoctorCheck{Name: name, Result: result, Detail: detail, Hint: hint})
+}
+
+func (d *doctor) checkDataFile() bool {
+	const name = doctorCheckDataFile
+	p := GetDataFilePath()
+	if !DataStoreExists() {
+		d.add(name, doctorFail, fmt.Sprintf("%s does not exist", p), "Run QCLauncher and click \"Configure\" to create it.")
+		return false
+	}
+	// read directly so that an old version is reported instead of migrated (see checkDataFile)
+	var db DataStore
+	if ls := openedDataStore(); ls != nil {
+		db = ls.DataStore
+	} else {
+		rdb, err := openDataStore(p, true)
+		if err != nil {
+			d.add(name, doctorFail, fmt.Sprintf("Unable to open %s: %s", DataFile, err),
+				fmt.Sprintf("Close any other running copy of QCLauncher and try again. If it still fails, delete %s and re-configure.", DataFile))
+			return false
+		}
+		defer rdb.Close()
+		db = rdb
+	}
+	var v []byte
+	if err := db.View(func(tx DataTx) error {
+		if b := tx.Bucket([]byte(bucketLastUpdate)); b != nil {
+			v = append([]byte(nil), b.Get([]byte(keyDfVer))...)
+		}
+		return nil
+	}); err != nil {
+		d.add(name, doctorFail, fmt.Sprintf("Unable to read %s: %s", DataFile, err),
+			fmt.Sprintf("The file is damaged. Delete %s and re-configure.", DataFile))
+		return false
+	}
+	var saved int64
+	if len(v) == 8 {
+		saved = int64(binary.LittleEndian.Uint64(v))
+	}
+	if saved > dataFileVersion {
+		d.add(name, doctorFail, fmt.Sprintf("Data file version is %d, this QCLauncher supports up to %d", saved, dataFileVersion),
+			"The file was written by a newer QCLauncher. Update QCLauncher.")
+		return false
+	}
+	if saved < dataFileVersion {
+		d.add(name, doctorWarn, fmt.Sprintf("Data file version is %d and will be upgraded to %d the next time settings are loaded",
+			saved, dataFileVersion), "Start QCLauncher once to upgrade it, then run the diagnostics again to check your settings.")
+		return false
+	}
+	if bad, err := verifyDataFile(db); err != nil || len(bad) > 0 {
+		detail := fmt.Sprintf("%d record(s) failed the integrity check: %s", len(bad), strings.Join(bad, ", "))
+		if err != nil {
+			detail = fmt.Sprintf("Unable to check integrity: %s", err)
+		}
+		d.add(name, doctorFail, detail, fmt.Sprintf(
+			"The file is damaged or was changed outside QCLauncher. The newest good backup from the %s folder is restored the next time settings are loaded.",
+			BackupDir))
+		return false
+	}
+	d.add(name, doctorPass, fmt.Sprintf("%s (version %d)", p, dataFileVersion), "")
+	return true
+}
+
+func (d *doctor) checkLockFile() {
+	const name = "Lock file"
+	p := Lock.Filename(true)
+	if !FileExists(p) {
+		d.add(name, doctorPass, "Not present", "")
+		return
+	}
+	if Lock.file != nil {
+		d.add(name, doctorPass, "Held by this QCLauncher", "")
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		d.add(name, doctorWarn, fmt.Sprintf("Unable to determine executable name: %s", err), "")
+		return
+	}
+	_, _, count, _, _, err := IsProcessRunning(filepath.Base(exe))
+	if err != nil {
+		d.add(name, doctorWarn, fmt.Sprintf("Unable to enumerate processes: %s", err), "")
+		return
+	}
+	if count > 1 { // this process is one of them
+		d.add(name, doctorPass, "Held by another running QCLauncher", "")
+		return
+	}
+	d.add(name, doctorFail, fmt.Sprintf("%s exists but no other QCLauncher is running", p),
+		fmt.Sprintf("Delete %s from the QCLauncher folder.", Lock.Filename(false)))
+}
+
+func (d *doctor) checkEndpoints() {
+	client := &http.Client{Timeout: time.Duration(defTimeout) * time.Second}
+	for _, base := range []string{ConfBaseSvc, ConfBaseBi, doctorUpdateBaseURL} {
+		u, err := url.Parse(base)
+		if err != nil {
+			d.add(fmt.Sprintf("Endpoint %s", base), doctorFail, err.Error(), "Check the -localaddr flag value.")
+			continue
+		}
+		name := fmt.Sprintf("Endpoint %s", u.Host)
+		addrs, err := net.LookupHost(u.Hostname())
+		if err != nil {
+			d.add(name, doctorFail, fmt.Sprintf("DNS lookup failed: %s", err),
+				fmt.Sprintf("Check your internet connection and DNS settings, and that %s is not blocked in your hosts file.", u.Hostname()))
+			continue
+		}
+		start := time.Now()
+		res, err := client.Get(base)
+		if err != nil {
+			d.add(name, doctorFail, fmt.Sprintf("Resolved to %s but no answer: %s", strings.Join(addrs, ", "), err),
+				fmt.Sprintf("Make sure a firewall, proxy or antivirus is not blocking qclauncher.exe from reaching %s.", u.Host))
+			continue
+		}
+		res.Body.Close()
+		if t, perr := http.ParseTime(res.Header.Get("Date")); perr == nil && d.serverTime.IsZero() {
+			d.serverTime = t.Add(time.Since(start) / 2)
+		}
+		// any HTTP response means the host is reachable; the base addresses themselves are not API resources
+		d.add(name, doctorPass, fmt.Sprintf("HTTP %d in %s", res.StatusCode, time.Since(start).Round(time.Millisecond)), "")
+	}
+}
+
+func (d *doctor) checkConfigLayers() {
+	hint := "Fix or remove the values listed. Run \"qclauncher config explain\" to see where each value comes from."
+	switch {
+	case len(configProblems) > 0:
+		d.add("Configuration", doctorWarn, strings.Join(configProblems, "; "), hint)
+	case FileExists(getConfigFilePath()):
+		d.add("Configuration", doctorPass, fmt.Sprintf("%s sets %d value(s)", ConfigFile, len(configFileVals)), "")
+	default:
+		d.add("Configuration", doctorPass, fmt.Sprintf("No %s", ConfigFile), "")
+	}
+}
+
+func (d *doctor) loadConfiguration() {
+	cfg, err := GetConfiguration()
+	if err != nil {
+		d.add("Settings", doctorFail, fmt.Sprintf("Unable to read saved settings: %s", err),
+			"Open the settings window and click \"Save All\" to re-save them.")
+		return
+	}
+	d.cfg = cfg
+}
+
+func (d *doctor) checkFingerprintAndToken() {
+	if d.cfg == nil {
+		d.add("Fingerprint", doctorSkip, "Settings unavailable", "")
+		d.add("Authentication token", doctorSkip, "Settings unavailable", "")
+		return
+	}
+	switch {
+	case isFPOverride():
+		d.add("Fingerprint", doctorPass, "Specified with -fp", "")
+	case d.cfg.Core.FP == "":
+		d.add("Fingerprint", doctorFail, "No Bethesda hardware fingerprint is stored",
+			"Open the settings window and click \"Save All\" to extract it from the Bethesda Launcher again, or pass it with -fp or -fpfile.")
+		d.add("Authentication token", doctorSkip, "Requires a fingerprint", "")
+		return
+	default:
+		d.add("Fingerprint", doctorPass, fmt.Sprintf("Present (%d characters)", len(d.cfg.Core.FP)), "")
+	}
+	if d.cfg.Auth.Token == "" {
+		d.add("Authentication token", doctorWarn, "No token is stored", "A new one is requested automatically on the next launch.")
+		return
+	}
+	fp := d.cfg.Core.FP
+	if isFPOverride() {
+		fp = ConfXSrcFp
+	}
+	req := &tokenCheckRequest{fp: fp}
+	if err := req.build(getVerifyEndpoint()); err != nil {
+		d.add("Authentication token", doctorFail, fmt.Sprintf("Unable to build verify request: %s", err), "")
+		return
+	}
+	// sent once: a rejected fingerprint is reported rather than replaced
+	if _, err := newLauncherClient(defTimeout).sendOnce(req); err != nil {
+		hint := "Check the endpoint results above; the Bethesda servers may be unreachable."
+		if IsErrAuthFailed(err) {
+			hint = "Launch QC once to request a new token. If that fails, re-enter your password in the settings window."
+		} else if IsErrFPRejected(err) {
+			hint = "Launch QC once to find and save a fingerprint that Bethesda.net accepts."
+		}
+		d.add("Authentication token", doctorFail, fmt.Sprintf("Verification failed: %s", err), hint)
+		return
+	}
+	d.add("Authentication token", doctorPass, "Verified with Bethesda", "")
+}
+
+func (d *doctor) checkQCInstall() {
+	if d.cfg == nil {
+		d.add("QC install", doctorSkip, "Settings unavailable", "")
+		d.add("QC file hashes", doctorSkip, "Settings unavailable", "")
+		return
+	}
+	if !FileExists(d.cfg.Core.FilePath) {
+		d.add("QC install", doctorFail, fmt.Sprintf("%s does not exist", d.cfg.Core.FilePath),
+			fmt.Sprintf("Set the location of %s in the settings window.", QCExe))
+		d.add("QC file hashes", doctorSkip, "QC is not installed at the configured location", "")
+		return
+	}
+	d.add("QC install", doctorPass, d.cfg.Core.FilePath, "")
+	info, err := newLauncherClient(defTimeout).getQCUpdateInfo()
+	if err != nil {
+		d.add("QC file hashes", doctorWarn, fmt.Sprintf("Unable to get the latest hashes: %s", err),
+			"Check the qc.syncore.org endpoint result above.")
+		return
+	}
+	h := []FileHash{}
+	for _, fh := range info.Hashes {
+		h = append(h, FileHash{File: strings.Replace(fh.File, "/", "\\", -1), Hash: fh.Hash})
+	}
+	if err = compareHashes(h); err != nil {
+		hint := "Make sure QC is fully installed, then run the Bethesda Launcher to repair it."
+		if IsErrHashMismatch(err) {
+			hint = "Run the Bethesda Launcher to update Quake Champions."
+		}
+		d.add("QC file hashes", doctorFail, err.Error(), hint)
+		return
+	}
+	d.add("QC file hashes", doctorPass, fmt.Sprintf("%d file(s) match the latest version", len(h)), "")
+}
+
+func (d *doctor) checkSteam() {
+	if p := getSteamInstallPath(); p != "" {
+		d.add("Steam", doctorPass, p, "")
+		return
+	}
+	// Steam is optional; it is only needed for adding QC as a non-Steam game
+	d.add("Steam", doctorWarn, "Steam was not found in the registry",
+		"Install Steam (or repair its installation) if you want to add QC as a non-Steam game for the overlay.")
+}
+
+func (d *doctor) checkClock() {
+	const name = "System clock"
+	if d.serverTime.IsZero() {
+		d.add(name, doctorSkip, "No server time available", "")
+		return
+	}
+	skew := time.Since(d.serverTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	detail := fmt.Sprintf("Off by %s from server time", skew.Round(time.Second))
+	hint := "Sync your clock in Windows: Settings > Time & language > Date & time > Sync now."
+	switch {
+	case skew > maxClockSkewFail:
+		d.add(name, doctorFail, detail, hint)
+	case skew > maxClockSkewWarn:
+		d.add(name, doctorWarn, detail, hint)
+	default:
+		d.add(name, doctorPass, detail, "")
+	}
+}
@@ -9,6 +9,7 @@ const (
 	updateQCEndpoint            = "https://qc.syncore.org/launcher/v2/checkforupdate"
 	updateLauncherEndpoint      = "https://qc.syncore.org/qcl_latest_version.json"
 	entitlementCheckAPIEndpoint = "https://qc.syncore.org/entitlement_api_check.json"
+	optionsCatalogEndpoint      = "https://qc.syncore.org/qcoptions.json"
 )
 
 func getAuthEndpoint() string {
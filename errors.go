@@ -15,6 +15,35 @@ type authFailedError struct {
 	emsg string
 }
 
+type notConfiguredError struct {
+	emsg string
+}
+
+type usageError struct {
+	emsg string
+}
+
+type signatureError struct {
+	emsg string
+}
+
+type lockedError struct {
+	emsg string
+}
+
+type corruptedError struct {
+	emsg string
+}
+
+type fpUnavailableError struct {
+	emsg string
+}
+
+type fpRejectedError struct {
+	emsg string
+	fp   string
+}
+
 func (e *hashMismatchError) Error() string {
 	return e.emsg
 }
@@ -27,6 +56,34 @@ func (e *authFailedError) Error() string {
 	return e.emsg
 }
 
+func (e *notConfiguredError) Error() string {
+	return e.emsg
+}
+
+func (e *usageError) Error() string {
+	return e.emsg
+}
+
+func (e *signatureError) Error() string {
+	return e.emsg
+}
+
+func (e *lockedError) Error() string {
+	return e.emsg
+}
+
+func (e *corruptedError) Error() string {
+	return e.emsg
+}
+
+func (e *fpUnavailableError) Error() string {
+	return e.emsg
+}
+
+func (e *fpRejectedError) Error() string {
+	return e.emsg
+}
+
 func IsErrAlreadyRunning(err error) bool {
 	if _, ok := err.(*alreadyRunningError); ok {
 		return true
@@ -47,3 +104,52 @@ func IsErrAuthFailed(err error) bool {
 	}
 	return false
 }
+
+func IsErrNotConfigured(err error) bool {
+	if _, ok := err.(*notConfiguredError); ok {
+		return true
+	}
+	return false
+}
+
+func IsErrUsage(err error) bool {
+	if _, ok := err.(*usageError); ok {
+		return true
+	}
+	return false
+}
+
+func IsErrSignature(err error) bool {
+	if _, ok := err.(*signatureError); ok {
+		return true
+	}
+	return false
+}
+
+func IsErrLocked(err error) bool {
+	if _, ok := err.(*lockedError); ok {
+		return true
+	}
+	return false
+}
+
+func IsErrCorrupted(err error) bool {
+	if _, ok := err.(*corruptedError); ok {
+		return true
+	}
+	return false
+}
+
+func IsErrFPUnavailable(err error) bool {
+	if _, ok := err.(*fpUnavailableError); ok {
+		return true
+	}
+	return false
+}
+
+func IsErrFPRejected(err error) bool {
+	if _, ok := err.(*fpRejectedError); ok {
+		return true
+	}
+	return false
+}
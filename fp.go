@@ -4,7 +4,7 @@
 package qclauncher
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -12,40 +12,63 @@ import (
 	"os/exec"
 	"path/filepath"
 
-	"github.com/Microsoft/go-winio"
+	"github.com/google/uuid"
 	"github.com/syncore/qclauncher/resources"
 )
 
-const pipePrefix = "\\\\.\\pipe\\"
-const pipeName = "blffqcl"
 const fpAttempts = 4
 
-var extractArgs = []string{fmt.Sprintf("-p=%s", pipeName), fmt.Sprintf("-r=%d", fpAttempts)}
+// fpExtractor runs the fingerprint extraction tool, which sends its result to address over t.
+type fpExtractor func(t fpTransport, address string) error
 
-//var extractArgs = []string{fmt.Sprintf("-p=%s", pipeName), "-t", "-f=testfp.json", fmt.Sprintf("-r=%d", fpAttempts)}
-
-type fpChanResult struct {
-	fp  []byte
-	err error
-}
+// runFPExtractor is blff, or a fake for running extraction without it
+var runFPExtractor fpExtractor = extractFp
 
 type bnlFingerprint struct {
 	FP *string `json:"fp"`
 }
 
 func getBNLFingerprint() (string, error) {
-	fpChan := make(chan fpChanResult)
-	go readFromPipe(fpChan)
-	if err := extractFp(); err != nil {
+	t, err := newFPTransport()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error choosing FP transport", GetCaller()), "error", err)
 		return "", err
 	}
-	result := <-fpChan
-	rfp, rerr := result.fp, result.err
-	if rerr != nil {
-		return "", rerr
+	l, address, err := t.listen()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error listening for FP extraction tool", GetCaller()), "transport", t.name(),
+			"error", err)
+		return "", err
 	}
+	defer l.Close()
+	type result struct {
+		msg *fpMessage
+		err error
+	}
+	rc := make(chan result, 1)
+	exited := make(chan struct{})
+	go func() {
+		msg, err := acceptFPMessage(l, exited)
+		rc <- result{msg, err}
+	}()
+	xerr := runFPExtractor(t, address)
+	close(exited)
+	r := <-rc
+	if r.err != nil {
+		if xerr != nil {
+			return "", xerr
+		}
+		logger.Errorw(fmt.Sprintf("%s: error receiving FP from extraction tool", GetCaller()), "transport", t.name(),
+			"error", r.err)
+		return "", r.err
+	}
+	if xerr != nil {
+		// the message arrived, so the tool's own error (e.g. while cleaning up) doesn't matter
+		logger.Infow("FP extraction tool failed after sending its result", "error", xerr)
+	}
+	logger.Debugw("received FP message", "transport", t.name(), "version", r.msg.version, "bytes", len(r.msg.payload))
 	bnl := &bnlFingerprint{}
-	if err := json.Unmarshal(rfp, bnl); err != nil {
+	if err := json.Unmarshal(r.msg.payload, bnl); err != nil {
 		return "", err
 	}
 	if bnl.FP == nil {
@@ -53,62 +76,39 @@ func getBNLFingerprint() (string, error) {
 		logger.Errorf("%s: %s", GetCaller(), err)
 		return "", fmt.Errorf("%s", err)
 	}
-	tmpFp = *bnl.FP // set until it can be written to storage
 	return *bnl.FP, nil
 }
 
-func readFromPipe(c chan fpChanResult) {
-	lp, err := winio.ListenPipe(pipePrefix+pipeName, &winio.PipeConfig{
-		MessageMode:      true,
-		InputBufferSize:  64,
-		OutputBufferSize: 64,
-	})
-	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error creating named pipe", GetCaller()), "error", err)
-		c <- fpChanResult{fp: []byte{}, err: err}
-		return
-	}
-	defer lp.Close()
-	pipe, err := lp.Accept()
-	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error accepting named pipe connection", GetCaller()), "error", err)
-		c <- fpChanResult{fp: []byte{}, err: err}
-		return
-	}
-	defer pipe.Close()
-	result, err := ioutil.ReadAll(bufio.NewReader(pipe))
-	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error reading from named pipe", GetCaller()), "error", err)
-		c <- fpChanResult{fp: []byte{}, err: err}
-		return
-	}
-	logger.Debugf("readFromPipe: Read %d bytes. FP (raw): %+x output: %s", len(result), result, string(result))
-	logger.Debugw("readFromPipe", "result", string(result))
-	c <- fpChanResult{fp: result, err: nil}
-}
-
-func extractFp() error {
+func extractFp(t fpTransport, address string) error {
 	// for executable source code see https://github.com/syncore/blff or qclauncher\resources\bin_src\
 	a, err := resources.Asset("../../resources/bin/blff/blff.exe") // "../../resources/bin/blff/blffconsole.exe"
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error reading FP extraction tool asset", GetCaller()), "error", err)
 		return err
 	}
-	outName := filepath.Join(getExecutingPath(), "ExtractBNLauncherFP.exe")
+	// a name of its own, so that a launch running at the same time does not overwrite or delete it
+	outName := filepath.Join(getExecutingPath(), fmt.Sprintf("ExtractBNLauncherFP-%s.exe", uuid.New().String()))
 	if err = ioutil.WriteFile(outName, a, 0644); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error extracting FP extraction tool", GetCaller()), "error", err)
 		return err
 	}
-	blff := exec.Command(outName, extractArgs...)
+	defer func() {
+		if err := os.Remove(outName); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error occurred while cleaning up FP extraction tool", GetCaller()), "error", err)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), fpAcceptTimeout)
+	defer cancel()
+	args := append(t.extractorArgs(address), fmt.Sprintf("-r=%d", fpAttempts))
+	blff := exec.CommandContext(ctx, outName, args...)
 	logger.Debugf("extractFp: Executing blff (%s) and awaiting completion...", outName)
 	if err = blff.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("the fingerprint extraction tool did not finish within %s", fpAcceptTimeout)
+		}
 		logger.Errorw(fmt.Sprintf("%s: error occurred while running FP extraction tool", GetCaller()), "error", err)
 		return err
 	}
-	if err = os.Remove(outName); err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error occurred while cleaning up FP extraction tool", GetCaller()), "error", err)
-		return err
-	}
 	if err = os.Remove(filepath.Join(getExecutingPath(), "blff_error.log")); err != nil && !os.IsNotExist(err) {
 		logger.Errorw(fmt.Sprintf("%s: error occurred while cleaning up FP extraction tool error log", GetCaller()), "error", err)
 	}
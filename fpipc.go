@@ -0,0 +1,225 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fpTransport is how blff sends the fingerprint back to QCLauncher. Each run listens on a new endpoint, so
+// that two launches at once do not collide.
+type fpTransport interface {
+	name() string
+	listen() (l net.Listener, address string, err error)
+	dial(address string) (net.Conn, error)
+	// extractorArgs tells blff where to connect
+	extractorArgs(address string) []string
+}
+
+// unixSocketTransport listens on a Unix domain socket in the temp folder (Windows 10 1803+, Wine, Linux).
+type unixSocketTransport struct{}
+
+// tcpTransport listens on a random loopback port.
+type tcpTransport struct{}
+
+// An fpFrame is fpFrameMagic, a version byte, the big-endian uint32 length of the payload and the payload,
+// which for version 1 is blff's JSON. blff versions that predate framing write the bare JSON, which is read
+// as version 0.
+const (
+	FPTransportPipe    = "pipe"
+	FPTransportUnix    = "unix"
+	FPTransportTCP     = "tcp"
+	fpFrameMagic       = "QCLF"
+	fpFrameVersion     = 1
+	fpFrameHeaderSize  = len(fpFrameMagic) + 1 + 4
+	fpMaxPayload       = 64 * 1024
+	fpReadTimeout      = 30 * time.Second
+	fpEndpointPrefix   = "blffqcl-"
+	fpUnixSocketSuffix = ".sock"
+)
+
+var (
+	// fpAcceptTimeout is also how long blff may run
+	fpAcceptTimeout = 3 * time.Minute
+	fpExitGrace     = 5 * time.Second
+)
+
+type fpMessage struct {
+	version int
+	payload []byte
+}
+
+func newFPTransport() (fpTransport, error) {
+	kind := ConfFPTransport
+	if kind == "" {
+		kind = defaultFPTransport()
+	}
+	switch kind {
+	case FPTransportPipe:
+		return newNamedPipeTransport()
+	case FPTransportUnix:
+		return &unixSocketTransport{}, nil
+	case FPTransportTCP:
+		return &tcpTransport{}, nil
+	default:
+		return nil, fmt.Errorf("unknown fingerprint transport: %s", kind)
+	}
+}
+
+func defaultFPTransport() string {
+	if runtime.GOOS == "windows" {
+		return FPTransportPipe
+	}
+	return FPTransportUnix
+}
+
+func fpEndpointName() string {
+	return fpEndpointPrefix + uuid.New().String()
+}
+
+func (t *unixSocketTransport) name() string { return FPTransportUnix }
+
+func (t *unixSocketTransport) listen() (net.Listener, string, error) {
+	p := filepath.Join(os.TempDir(), fpEndpointName()+fpUnixSocketSuffix)
+	l, err := net.Listen("unix", p)
+	if err != nil {
+		return nil, "", err
+	}
+	return l, p, nil
+}
+
+func (t *unixSocketTransport) dial(address string) (net.Conn, error) {
+	return net.DialTimeout("unix", address, fpReadTimeout)
+}
+
+func (t *unixSocketTransport) extractorArgs(address string) []string {
+	return []string{fmt.Sprintf("-u=%s", address)}
+}
+
+func (t *tcpTransport) name() string { return FPTransportTCP }
+
+func (t *tcpTransport) listen() (net.Listener, string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	return l, l.Addr().String(), nil
+}
+
+func (t *tcpTransport) dial(address string) (net.Conn, error) {
+	return net.DialTimeout("tcp", address, fpReadTimeout)
+}
+
+func (t *tcpTransport) extractorArgs(address string) []string {
+	return []string{fmt.Sprintf("-a=%s", address)}
+}
+
+// acceptFPMessage waits for blff to connect to l and reads its message. It gives up after fpAcceptTimeout,
+// or fpExitGrace after exited is closed, so that it does not wait forever for a blff that died.
+func acceptFPMessage(l net.Listener, exited <-chan struct{}) (*fpMessage, error) {
+	type accepted struct {
+		conn net.Conn
+		err  error
+	}
+	ac := make(chan accepted, 1)
+	go func() {
+		conn, err := l.Accept()
+		ac <- accepted{conn, err}
+	}()
+	timeout := time.NewTimer(fpAcceptTimeout)
+	defer timeout.Stop()
+	var grace <-chan time.Time
+	for {
+		select {
+		case a := <-ac:
+			if a.err != nil {
+				return nil, a.err
+			}
+			defer a.conn.Close()
+			if err := a.conn.SetReadDeadline(time.Now().Add(fpReadTimeout)); err != nil {
+				logger.Debugw("unable to set fingerprint read deadline", "error", err)
+			}
+			return readFPMessage(a.conn)
+		case <-exited:
+			exited, grace = nil, time.After(fpExitGrace)
+		case <-grace:
+			l.Close()
+			return nil, errors.New("the fingerprint extraction tool exited without connecting")
+		case <-timeout.C:
+			l.Close()
+			return nil, fmt.Errorf("timed out after %s waiting for the fingerprint extraction tool to connect", fpAcceptTimeout)
+		}
+	}
+}
+
+func readFPMessage(r io.Reader) (*fpMessage, error) {
+	header := make([]byte, fpFrameHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if n < fpFrameHeaderSize || !bytes.HasPrefix(header, []byte(fpFrameMagic)) {
+		// unframed message from a blff that predates framing
+		rest, err := ioutil.ReadAll(io.LimitReader(r, fpMaxPayload))
+		if err != nil {
+			return nil, err
+		}
+		return &fpMessage{version: 0, payload: append(header[:n], rest...)}, nil
+	}
+	version := int(header[len(fpFrameMagic)])
+	if version == 0 || version > fpFrameVersion {
+		return nil, fmt.Errorf("unsupported fingerprint message version %d", version)
+	}
+	size := binary.BigEndian.Uint32(header[len(fpFrameMagic)+1:])
+	if size > fpMaxPayload {
+		return nil, fmt.Errorf("fingerprint message is too large (%d bytes)", size)
+	}
+	payload := make([]byte, size)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return &fpMessage{version: version, payload: payload}, nil
+}
+
+func writeFPMessage(w io.Writer, payload []byte) error {
+	if len(payload) > fpMaxPayload {
+		return fmt.Errorf("fingerprint message is too large (%d bytes)", len(payload))
+	}
+	frame := make([]byte, fpFrameHeaderSize, fpFrameHeaderSize+len(payload))
+	copy(frame, fpFrameMagic)
+	frame[len(fpFrameMagic)] = fpFrameVersion
+	binary.BigEndian.PutUint32(frame[len(fpFrameMagic)+1:], uint32(len(payload)))
+	_, err := w.Write(append(frame, payload...))
+	return err
+}
+
+// fakeFPExtractor stands in for blff: it connects the way blff does and sends fp, so that extraction can be
+// run without Windows or the Bethesda Launcher.
+func fakeFPExtractor(fp string) fpExtractor {
+	return func(t fpTransport, address string) error {
+		conn, err := t.dial(address)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		payload, err := json.Marshal(&bnlFingerprint{FP: &fp})
+		if err != nil {
+			return err
+		}
+		return writeFPMessage(conn, payload)
+	}
+}
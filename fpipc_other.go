@@ -0,0 +1,13 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+//go:build !windows
+// +build !windows
+
+package qclauncher
+
+import "errors"
+
+func newNamedPipeTransport() (fpTransport, error) {
+	return nil, errors.New("named pipes are only available on Windows; use -fptransport unix or tcp")
+}
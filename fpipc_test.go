@@ -0,0 +1,148 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fpFrame(version byte, size uint32, payload []byte) []byte {
+	frame := append([]byte(fpFrameMagic), version, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(frame[len(fpFrameMagic)+1:], size)
+	return append(frame, payload...)
+}
+
+func TestReadFPMessageFramed(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := writeFPMessage(buf, []byte(`{"fp":"abc"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// anything after the frame is not part of the message
+	buf.WriteString("trailing")
+	msg, err := readFPMessage(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.version != fpFrameVersion || string(msg.payload) != `{"fp":"abc"}` {
+		t.Errorf("unexpected message: version %d, %q", msg.version, msg.payload)
+	}
+}
+
+func TestReadFPMessageLegacy(t *testing.T) {
+	// the second is shorter than a frame header
+	for _, payload := range []string{`{"fp":"abcdef0123456789"}`, `{}`} {
+		msg, err := readFPMessage(strings.NewReader(payload))
+		if err != nil {
+			t.Fatalf("%s: %s", payload, err)
+		}
+		if msg.version != 0 || string(msg.payload) != payload {
+			t.Errorf("%s: unexpected message: version %d, %q", payload, msg.version, msg.payload)
+		}
+	}
+}
+
+func TestReadFPMessageTooLarge(t *testing.T) {
+	_, err := readFPMessage(bytes.NewReader(fpFrame(fpFrameVersion, fpMaxPayload+1, nil)))
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("expected an oversize frame to be rejected, got %v", err)
+	}
+	if err = writeFPMessage(&bytes.Buffer{}, make([]byte, fpMaxPayload+1)); err == nil {
+		t.Error("expected an oversize payload not to be written")
+	}
+}
+
+func TestReadFPMessageBadVersion(t *testing.T) {
+	for _, version := range []byte{0, fpFrameVersion + 1} {
+		_, err := readFPMessage(bytes.NewReader(fpFrame(version, 2, []byte(`{}`))))
+		if err == nil || !strings.Contains(err.Error(), "version") {
+			t.Errorf("version %d: expected the frame to be rejected, got %v", version, err)
+		}
+	}
+}
+
+func TestReadFPMessageTruncated(t *testing.T) {
+	if _, err := readFPMessage(bytes.NewReader(fpFrame(fpFrameVersion, 10, []byte(`{}`)))); err == nil {
+		t.Error("expected a frame shorter than its length to be rejected")
+	}
+}
+
+// useFPTimeouts shortens the time acceptFPMessage waits for the length of the test.
+func useFPTimeouts(t *testing.T, accept, grace time.Duration) {
+	prevAccept, prevGrace := fpAcceptTimeout, fpExitGrace
+	fpAcceptTimeout, fpExitGrace = accept, grace
+	t.Cleanup(func() { fpAcceptTimeout, fpExitGrace = prevAccept, prevGrace })
+}
+
+func listenLoopback(t *testing.T) net.Listener {
+	t.Helper()
+	l, _, err := (&tcpTransport{}).listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestAcceptFPMessageExitWithoutConnect(t *testing.T) {
+	useFPTimeouts(t, time.Minute, 10*time.Millisecond)
+	exited := make(chan struct{})
+	close(exited)
+	_, err := acceptFPMessage(listenLoopback(t), exited)
+	if err == nil || !strings.Contains(err.Error(), "exited without connecting") {
+		t.Errorf("expected the tool's exit to end the wait, got %v", err)
+	}
+}
+
+func TestAcceptFPMessageTimeout(t *testing.T) {
+	useFPTimeouts(t, 10*time.Millisecond, time.Minute)
+	_, err := acceptFPMessage(listenLoopback(t), make(chan struct{}))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected the wait to time out, got %v", err)
+	}
+}
+
+func TestAcceptFPMessageAfterExit(t *testing.T) {
+	// a message that is sent just before the tool exits is still read
+	useFPTimeouts(t, time.Minute, time.Minute)
+	l := listenLoopback(t)
+	exited := make(chan struct{})
+	if err := fakeFPExtractor("abc")(&tcpTransport{}, l.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	close(exited)
+	msg, err := acceptFPMessage(l, exited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.version != fpFrameVersion || string(msg.payload) != `{"fp":"abc"}` {
+		t.Errorf("unexpected message: version %d, %q", msg.version, msg.payload)
+	}
+}
+
+func TestGetBNLFingerprintFakeExtractor(t *testing.T) {
+	useNopLogger()
+	transports := []string{FPTransportTCP}
+	if runtime.GOOS != "windows" {
+		transports = append(transports, FPTransportUnix)
+	}
+	prevTransport, prevExtractor := ConfFPTransport, runFPExtractor
+	t.Cleanup(func() { ConfFPTransport, runFPExtractor = prevTransport, prevExtractor })
+	runFPExtractor = fakeFPExtractor("0123456789abcdef")
+	for _, kind := range transports {
+		ConfFPTransport = kind
+		fp, err := getBNLFingerprint()
+		if err != nil {
+			t.Fatalf("%s: %s", kind, err)
+		}
+		if fp != "0123456789abcdef" {
+			t.Errorf("%s: unexpected fingerprint %q", kind, fp)
+		}
+	}
+}
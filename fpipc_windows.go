@@ -0,0 +1,44 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+const pipePrefix = `\\.\pipe\`
+
+// namedPipeTransport listens on a Windows named pipe, the only transport that every blff version supports.
+type namedPipeTransport struct{}
+
+func newNamedPipeTransport() (fpTransport, error) {
+	return &namedPipeTransport{}, nil
+}
+
+func (t *namedPipeTransport) name() string { return FPTransportPipe }
+
+func (t *namedPipeTransport) listen() (net.Listener, string, error) {
+	name := fpEndpointName()
+	l, err := winio.ListenPipe(pipePrefix+name, &winio.PipeConfig{
+		MessageMode:      true,
+		InputBufferSize:  fpMaxPayload,
+		OutputBufferSize: fpMaxPayload,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return l, name, nil
+}
+
+func (t *namedPipeTransport) dial(address string) (net.Conn, error) {
+	timeout := fpReadTimeout
+	return winio.DialPipe(pipePrefix+address, &timeout)
+}
+
+func (t *namedPipeTransport) extractorArgs(address string) []string {
+	return []string{fmt.Sprintf("-p=%s", address)}
+}
@@ -0,0 +1,241 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// FPProvider is one place the x-src-fp hardware fingerprint can come from. Get returns an error saying why
+// it has none.
+type FPProvider interface {
+	Name() string
+	Get() (string, error)
+}
+
+const (
+	FPProviderOverride = "override"
+	FPProviderCache    = "cache"
+	FPProviderBlff     = "blff"
+	FPProviderFile     = "file"
+	FPChainDef         = "override,cache,blff,file"
+)
+
+// overrideFPProvider returns the fingerprint given with -fp.
+type overrideFPProvider struct{}
+
+// cacheFPProvider returns the fingerprint found earlier in this run, or the saved one.
+type cacheFPProvider struct{}
+
+// blffFPProvider extracts the fingerprint from the Bethesda Launcher with the embedded blff tool.
+type blffFPProvider struct{}
+
+// fileFPProvider reads the fingerprint from the file given with -fpfile: either blff's JSON output or
+// the bare value.
+type fileFPProvider struct {
+	path string
+}
+
+// fakeFPProvider returns a fixed fingerprint or error, so that the chain can be run without Windows or
+// the Bethesda Launcher.
+type fakeFPProvider struct {
+	name string
+	fp   string
+	err  error
+}
+
+var (
+	// fpMu guards tmpFp and rejectedFPs. It is not held while providers run, as they can prompt for the
+	// master passphrase, wait for the data file or run blff.
+	fpMu        sync.Mutex
+	rejectedFPs = map[string]bool{}
+	// testFPChain replaces the configured chain when it is set
+	testFPChain []FPProvider
+)
+
+func (p *overrideFPProvider) Name() string { return FPProviderOverride }
+
+func (p *overrideFPProvider) Get() (string, error) {
+	if !isFPOverride() {
+		return "", errors.New("no -fp option was given")
+	}
+	return ConfXSrcFp, nil
+}
+
+func (p *cacheFPProvider) Name() string { return FPProviderCache }
+
+func (p *cacheFPProvider) Get() (string, error) {
+	fpMu.Lock()
+	fp := tmpFp
+	fpMu.Unlock()
+	if fp != "" {
+		return fp, nil
+	}
+	if !DataStoreExists() {
+		return "", errors.New("no settings are saved yet")
+	}
+	cfg, err := GetConfiguration()
+	if err != nil {
+		return "", fmt.Errorf("unable to read the saved settings: %s", err)
+	}
+	if cfg.Core.FP == "" {
+		return "", errors.New("no fingerprint is saved")
+	}
+	return cfg.Core.FP, nil
+}
+
+func (p *blffFPProvider) Name() string { return FPProviderBlff }
+
+func (p *blffFPProvider) Get() (string, error) {
+	return getBNLFingerprint()
+}
+
+func (p *fileFPProvider) Name() string { return FPProviderFile }
+
+func (p *fileFPProvider) Get() (string, error) {
+	if p.path == "" {
+		return "", errors.New("no -fpfile option was given")
+	}
+	data, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return "", err
+	}
+	fp := strings.TrimSpace(string(data))
+	if strings.HasPrefix(fp, "{") {
+		bnl := &bnlFingerprint{}
+		if err = json.Unmarshal(data, bnl); err != nil {
+			return "", fmt.Errorf("unable to read %s: %s", p.path, err)
+		}
+		if bnl.FP == nil {
+			return "", fmt.Errorf("%s has no fp value", p.path)
+		}
+		fp = *bnl.FP
+	}
+	if fp == "" {
+		return "", fmt.Errorf("%s is empty", p.path)
+	}
+	return fp, nil
+}
+
+func (p *fakeFPProvider) Name() string { return p.name }
+
+func (p *fakeFPProvider) Get() (string, error) {
+	return p.fp, p.err
+}
+
+// fpChain returns the providers named in -fpchain, in order. Unknown names are skipped.
+func fpChain() []FPProvider {
+	if testFPChain != nil {
+		return testFPChain
+	}
+	names := ConfFPChain
+	if names == "" {
+		names = FPChainDef
+	}
+	var chain []FPProvider
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case FPProviderOverride:
+			chain = append(chain, &overrideFPProvider{})
+		case FPProviderCache:
+			chain = append(chain, &cacheFPProvider{})
+		case FPProviderBlff:
+			chain = append(chain, &blffFPProvider{})
+		case FPProviderFile:
+			chain = append(chain, &fileFPProvider{path: ConfFPFile})
+		case "":
+		default:
+			logger.Warnw("ignoring unknown fingerprint provider", "provider", name)
+		}
+	}
+	return chain
+}
+
+// resolveFP returns the first fingerprint in the chain that the server has not rejected, and the provider
+// it came from. A fingerprint that did not come from -fp is kept so that it is saved with the settings.
+func resolveFP() (string, string, error) {
+	var reasons []string
+	for _, p := range fpChain() {
+		fp, err := p.Get()
+		if err == nil && fp == "" {
+			err = errors.New("no fingerprint was found")
+		}
+		if err == nil && isRejectedFP(fp) {
+			err = errors.New("the fingerprint was rejected by Bethesda.net")
+		}
+		if err != nil {
+			logger.Debugw("fingerprint provider failed", "provider", p.Name(), "reason", err.Error())
+			reasons = append(reasons, fmt.Sprintf("%s: %s", p.Name(), err))
+			continue
+		}
+		addLogSecrets(fp)
+		if p.Name() != FPProviderOverride {
+			fpMu.Lock()
+			tmpFp = fp
+			fpMu.Unlock()
+		}
+		return fp, p.Name(), nil
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "no providers are configured")
+	}
+	err := &fpUnavailableError{emsg: fmt.Sprintf("Unable to get the Bethesda hardware fingerprint (%s)", strings.Join(reasons, "; "))}
+	logger.Errorw(fmt.Sprintf("%s: every fingerprint provider failed", GetCaller()), "error", err)
+	return "", "", err
+}
+
+func isRejectedFP(fp string) bool {
+	fpMu.Lock()
+	defer fpMu.Unlock()
+	return rejectedFPs[fp]
+}
+
+// replaceRejectedFP runs the chain again without the fingerprint the server rejected, and saves what it
+// finds in its place.
+func replaceRejectedFP(rejected string) error {
+	fpMu.Lock()
+	rejectedFPs[rejected] = true
+	if tmpFp == rejected {
+		tmpFp = ""
+	}
+	fpMu.Unlock()
+	fp, source, err := resolveFP()
+	if err != nil {
+		return err
+	}
+	logger.Infow("replaced rejected fingerprint", "provider", source)
+	if source == FPProviderOverride || source == FPProviderCache || !DataStoreExists() {
+		return nil
+	}
+	return storeFP(fp)
+}
+
+func storeFP(fp string) error {
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return err
+	}
+	defer ls.Close()
+	if err = ls.Update(func(tx DataTx) error {
+		core, err := readCoreRecord(tx)
+		if err != nil || core == nil {
+			return err
+		}
+		core.FP = fp
+		encoded, err := core.encode()
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(bucketSettings)).Put([]byte(keyQCCoreSettings), encoded)
+	}); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving replacement fingerprint", GetCaller()), "error", err)
+		return err
+	}
+	return nil
+}
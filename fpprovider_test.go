@@ -0,0 +1,120 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// useFPChain runs resolveFP with chain, and nothing found or rejected yet, for the length of the test.
+func useFPChain(t *testing.T, chain ...FPProvider) {
+	useNopLogger()
+	prevChain, prevFp, prevRejected := testFPChain, tmpFp, rejectedFPs
+	testFPChain, tmpFp, rejectedFPs = chain, "", map[string]bool{}
+	t.Cleanup(func() { testFPChain, tmpFp, rejectedFPs = prevChain, prevFp, prevRejected })
+}
+
+func TestFPChainFromConfig(t *testing.T) {
+	useNopLogger()
+	prev := ConfFPChain
+	t.Cleanup(func() { ConfFPChain = prev })
+	for chain, want := range map[string]string{
+		"":                   FPChainDef,
+		"file, CACHE,,bogus": "file,cache",
+		"blff":               "blff",
+	} {
+		ConfFPChain = chain
+		var names []string
+		for _, p := range fpChain() {
+			names = append(names, p.Name())
+		}
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("%q: expected %s, got %s", chain, want, got)
+		}
+	}
+}
+
+func TestResolveFPOrder(t *testing.T) {
+	useFPChain(t,
+		&fakeFPProvider{name: FPProviderOverride, err: errors.New("no -fp option was given")},
+		&fakeFPProvider{name: FPProviderCache, fp: "cached"},
+		&fakeFPProvider{name: FPProviderBlff, fp: "extracted"})
+	fp, source, err := resolveFP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp != "cached" || source != FPProviderCache {
+		t.Errorf("expected the first fingerprint found, got %q from %s", fp, source)
+	}
+	if tmpFp != "cached" {
+		t.Errorf("the fingerprint was not kept for saving: %q", tmpFp)
+	}
+}
+
+func TestResolveFPOverrideIsNotKept(t *testing.T) {
+	useFPChain(t, &fakeFPProvider{name: FPProviderOverride, fp: "given"})
+	if fp, _, err := resolveFP(); err != nil || fp != "given" {
+		t.Fatalf("expected the override, got %q %v", fp, err)
+	}
+	if tmpFp != "" {
+		t.Errorf("the -fp fingerprint was kept for saving: %q", tmpFp)
+	}
+}
+
+func TestResolveFPReasons(t *testing.T) {
+	useFPChain(t,
+		&fakeFPProvider{name: FPProviderOverride, err: errors.New("no -fp option was given")},
+		&fakeFPProvider{name: FPProviderCache},
+		&fakeFPProvider{name: FPProviderFile, fp: "rejected"})
+	rejectedFPs["rejected"] = true
+	_, _, err := resolveFP()
+	if !IsErrFPUnavailable(err) {
+		t.Fatalf("expected the fingerprint to be unavailable, got %v", err)
+	}
+	for _, reason := range []string{
+		"override: no -fp option was given",
+		"cache: no fingerprint was found",
+		"file: the fingerprint was rejected by Bethesda.net",
+	} {
+		if !strings.Contains(err.Error(), reason) {
+			t.Errorf("expected the error to give the reason %q: %s", reason, err)
+		}
+	}
+	testFPChain = []FPProvider{}
+	if _, _, err = resolveFP(); err == nil || !strings.Contains(err.Error(), "no providers are configured") {
+		t.Errorf("expected an empty chain to be reported, got %v", err)
+	}
+}
+
+func TestReplaceRejectedFP(t *testing.T) {
+	useMemoryStore(t, nil)
+	putRaw(t, bucketSettings, keyQCCoreSettings, &QCCoreSettings{FilePath: `C:\qc.exe`, FP: "old"})
+	useFPChain(t,
+		&fakeFPProvider{name: FPProviderCache, fp: "old"},
+		&fakeFPProvider{name: FPProviderFile, fp: "new"})
+	tmpFp = "old"
+	if err := replaceRejectedFP("old"); err != nil {
+		t.Fatal(err)
+	}
+	if !rejectedFPs["old"] || tmpFp != "new" {
+		t.Errorf("the rejected fingerprint was not replaced: rejected %v, using %q", rejectedFPs, tmpFp)
+	}
+	core := &QCCoreSettings{}
+	if !getRaw(t, bucketSettings, keyQCCoreSettings, core) || core.FP != "new" || core.FilePath != `C:\qc.exe` {
+		t.Errorf("the replacement was not saved: %+v", core)
+	}
+	// the cache only has the rejected fingerprint, so it is skipped from now on
+	if fp, source, err := resolveFP(); err != nil || fp != "new" || source != FPProviderFile {
+		t.Errorf("expected the replacement, got %q from %s (%v)", fp, source, err)
+	}
+}
+
+func TestReplaceRejectedFPNoneLeft(t *testing.T) {
+	useFPChain(t, &fakeFPProvider{name: FPProviderBlff, fp: "old"})
+	if err := replaceRejectedFP("old"); !IsErrFPUnavailable(err) {
+		t.Errorf("expected no replacement to be found, got %v", err)
+	}
+}
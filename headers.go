@@ -61,7 +61,10 @@ type localRequestExtraHeaders struct {
 }
 
 type requestHeaderAuth struct{ headerMapping }
-type requestHeaderVerify struct{ headerMapping }
+type requestHeaderVerify struct {
+	headerMapping
+	fp string // sent as-is instead of running the fingerprint chain, if set
+}
 type requestHeaderBuildInfo struct{ headerMapping }
 type requestHeaderEntitlementInfo struct{ headerMapping }
 type requestHeaderBranchInfo struct{ headerMapping }
@@ -102,12 +105,15 @@ func (h *requestHeaderVerify) build() error {
 		logger.Errorw(fmt.Sprintf("%s: error building verify header", GetCaller()), "error", err)
 		return err
 	}
+	if h.fp != "" {
+		headers.values[hkeyXSrcFp] = []string{h.fp}
+	}
 	h.headerMapping = headers
 	return nil
 }
 
 func (h requestHeaderVerify) getExtra() localRequestExtraHeaders {
-	return localRequestExtraHeaders{xcdp: true, auth: true, launcher: false, fp: true}
+	return localRequestExtraHeaders{xcdp: true, auth: true, launcher: false, fp: h.fp == ""}
 }
 
 func (h requestHeaderVerify) getBase() (headers map[string][]string) {
@@ -310,29 +316,12 @@ func getAll(h localRequestHeader) (headerMapping, error) {
 		all[hkeyXCdpLibVer] = []string{ConfXLibVer}
 	}
 	if e.fp {
-		fp := ""
-		if isFPOverride() {
-			all[hkeyXSrcFp] = []string{ConfXSrcFp}
-		} else {
-			if tmpFp != "" {
-				fp = tmpFp
-			} else {
-				if FileExists(GetDataFilePath()) {
-					cfg, err := GetConfiguration()
-					if err != nil {
-						logger.Errorw(fmt.Sprintf("%s: error getting configuration for fp lookup when getting all request headers",
-							GetCaller()), "error", err)
-						return headerMapping{}, err
-					}
-					fp = cfg.Core.FP
-				} else {
-					err := fmt.Errorf("No FP value was present when getting all request headers")
-					logger.Errorw(fmt.Sprintf("%s: error getting all request headers", GetCaller()), "error", err)
-					return headerMapping{}, err
-				}
-			}
-			all[hkeyXSrcFp] = []string{fp}
+		fp, _, err := resolveFP()
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error getting fp when getting all request headers", GetCaller()), "error", err)
+			return headerMapping{}, err
 		}
+		all[hkeyXSrcFp] = []string{fp}
 	}
 	if e.auth {
 		cfg, err := GetConfiguration()
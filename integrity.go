@@ -0,0 +1,446 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Every value in data.qcl is stored behind an HMAC-SHA256 of its bucket, key and value, keyed with a
+// random key kept in the file's integrity bucket. From version 10 the key is kept encrypted with DPAPI, so
+// it can only be read by the same Windows account on the same PC: a record edited with another program
+// cannot be sealed again without it. A file can still be replaced with one from before version 8, which is
+// migrated like any other. Files written before version 8 have no key until their migration seals them,
+// and stores whose backend is not sealed never get one.
+
+// sealedTx checks the values read through it and seals the values written through it.
+type sealedTx struct {
+	tx  DataTx
+	key []byte
+	bad []string
+}
+
+type sealedBucket struct {
+	b    DataBucket
+	name string
+	tx   *sealedTx
+}
+
+type sealedCursor struct {
+	c DataCursor
+	b *sealedBucket
+}
+
+const (
+	integrityKeySize              = 32
+	integrityKeyEntropy           = "qclauncher-integrity:"
+	integrityVersion        int64 = 8  // the data file version that added the checks
+	remoteSealVersion       int64 = 9  // the data file version that added bucketRemote to the checks
+	integrityProtectVersion int64 = 10 // the data file version that encrypted the key with DPAPI
+)
+
+// integrityKeyCache is the last key decrypted, so that DPAPI is not called for every transaction.
+var integrityKeyCache struct {
+	sync.Mutex
+	protected, key []byte
+}
+
+func (ls *LauncherStore) View(fn func(tx DataTx) error) error {
+	return ls.DataStore.View(func(tx DataTx) error { return withSealedTx(tx, fn) })
+}
+
+func (ls *LauncherStore) Update(fn func(tx DataTx) error) error {
+	return ls.DataStore.Update(func(tx DataTx) error { return withSealedTx(tx, fn) })
+}
+
+func withSealedTx(tx DataTx, fn func(tx DataTx) error) error {
+	key, err := readIntegrityKey(tx)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: unable to read the integrity key", GetCaller()), "error", err)
+		return &corruptedError{emsg: fmt.Sprintf("Your %s file is damaged or was changed outside QCLauncher", DataFile)}
+	}
+	if key == nil {
+		return fn(tx)
+	}
+	st := &sealedTx{tx: tx, key: key}
+	// a damaged record reads as nil, so fn may fail because of it
+	err = fn(st)
+	if len(st.bad) > 0 {
+		logger.Errorw(fmt.Sprintf("%s: records failed the integrity check", GetCaller()), "records", st.bad)
+		return &corruptedError{emsg: fmt.Sprintf("Your %s file is damaged or was changed outside QCLauncher", DataFile)}
+	}
+	return err
+}
+
+func hasIntegrityKey(tx DataTx) bool {
+	b := tx.Bucket([]byte(bucketIntegrity))
+	return b != nil && b.Get([]byte(keyIntegrity)) != nil
+}
+
+// readIntegrityKey returns nil if the file has no integrity key, and an error if its key cannot be
+// decrypted, e.g. because the file comes from another Windows account.
+func readIntegrityKey(tx DataTx) ([]byte, error) {
+	b := tx.Bucket([]byte(bucketIntegrity))
+	if b == nil {
+		return nil, nil
+	}
+	stored := b.Get([]byte(keyIntegrity))
+	if stored == nil {
+		return nil, nil
+	}
+	if len(stored) == integrityKeySize && readDataFileVersion(tx) < integrityProtectVersion {
+		return append([]byte(nil), stored...), nil // encrypted by its migration
+	}
+	integrityKeyCache.Lock()
+	defer integrityKeyCache.Unlock()
+	if bytes.Equal(stored, integrityKeyCache.protected) {
+		return integrityKeyCache.key, nil
+	}
+	key, err := dpapiUnprotect(stored, []byte(integrityKeyEntropy))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != integrityKeySize {
+		return nil, fmt.Errorf("integrity key has the wrong size (%d bytes)", len(key))
+	}
+	integrityKeyCache.protected, integrityKeyCache.key = append([]byte(nil), stored...), key
+	return key, nil
+}
+
+func putIntegrityKey(tx DataTx, key []byte) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketIntegrity))
+	if err != nil {
+		return err
+	}
+	protected, err := dpapiProtect(key, []byte(integrityKeyEntropy))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(keyIntegrity), protected)
+}
+
+func createIntegrityKey(tx DataTx) ([]byte, error) {
+	key := make([]byte, integrityKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, putIntegrityKey(tx, key)
+}
+
+// isUnsealed reports whether a value is stored as-is: the version is read before anything else, including
+// by older QCLaunchers and by the backup and diagnostics code.
+func isUnsealed(bucket string, k []byte) bool {
+	return bucket == bucketLastUpdate && string(k) == keyDfVer
+}
+
+func recordMAC(key []byte, bucket string, k, v []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	for _, part := range [][]byte{[]byte(bucket), k} {
+		l := make([]byte, 4)
+		binary.BigEndian.PutUint32(l, uint32(len(part)))
+		m.Write(l)
+		m.Write(part)
+	}
+	m.Write(v)
+	return m.Sum(nil)
+}
+
+func sealValue(key []byte, bucket string, k, v []byte) []byte {
+	if isUnsealed(bucket, k) {
+		return v
+	}
+	return append(recordMAC(key, bucket, k, v), v...)
+}
+
+func openValue(key []byte, bucket string, k, sealed []byte) ([]byte, bool) {
+	if isUnsealed(bucket, k) {
+		return sealed, true
+	}
+	if len(sealed) < sha256.Size {
+		return nil, false
+	}
+	v := sealed[sha256.Size:]
+	return v, hmac.Equal(sealed[:sha256.Size], recordMAC(key, bucket, k, v))
+}
+
+func (t *sealedTx) Bucket(name []byte) DataBucket {
+	b := t.tx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	return &sealedBucket{b: b, name: string(name), tx: t}
+}
+
+func (t *sealedTx) CreateBucketIfNotExists(name []byte) (DataBucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sealedBucket{b: b, name: string(name), tx: t}, nil
+}
+
+// open returns nil for a value that fails the check; the transaction then fails with a corruptedError.
+func (b *sealedBucket) open(k, sealed []byte) []byte {
+	if sealed == nil {
+		return nil
+	}
+	v, ok := openValue(b.tx.key, b.name, k, sealed)
+	if !ok {
+		b.tx.bad = append(b.tx.bad, fmt.Sprintf("%s/%q", b.name, k))
+		return nil
+	}
+	return v
+}
+
+func (b *sealedBucket) Get(key []byte) []byte {
+	return b.open(key, b.b.Get(key))
+}
+
+func (b *sealedBucket) Put(key, value []byte) error {
+	return b.b.Put(key, sealValue(b.tx.key, b.name, key, value))
+}
+
+func (b *sealedBucket) Delete(key []byte) error {
+	return b.b.Delete(key)
+}
+
+func (b *sealedBucket) ForEach(fn func(k, v []byte) error) error {
+	return b.b.ForEach(func(k, v []byte) error {
+		if v = b.open(k, v); v == nil {
+			return nil
+		}
+		return fn(k, v)
+	})
+}
+
+func (b *sealedBucket) Cursor() DataCursor {
+	return &sealedCursor{c: b.b.Cursor(), b: b}
+}
+
+func (c *sealedCursor) First() ([]byte, []byte) {
+	k, v := c.c.First()
+	return k, c.b.open(k, v)
+}
+
+func (c *sealedCursor) Last() ([]byte, []byte) {
+	k, v := c.c.Last()
+	return k, c.b.open(k, v)
+}
+
+func (c *sealedCursor) Next() ([]byte, []byte) {
+	k, v := c.c.Next()
+	return k, c.b.open(k, v)
+}
+
+// sealDataFile adds the integrity key and seals every value of a file written before version 8.
+func sealDataFile(tx DataTx) error {
+	if !activeStore.sealed() || hasIntegrityKey(tx) {
+		return nil
+	}
+	key, err := createIntegrityKey(tx)
+	if err != nil {
+		return err
+	}
+	for _, name := range dataBuckets {
+		b := tx.Bucket([]byte(name))
+		if b == nil {
+			continue
+		}
+		values := map[string][]byte{}
+		if err = b.ForEach(func(k, v []byte) error {
+			values[string(k)] = append([]byte(nil), v...)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for k, v := range values {
+			if err = b.Put([]byte(k), sealValue(key, name, []byte(k), v)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sealRemoteResponses seals the values that version 8 left out of bucketRemote. They are cached copies of
+// signed documents, whose signatures are checked again when they are read, so they are sealed as found.
+func sealRemoteResponses(tx DataTx) error {
+	st, ok := tx.(*sealedTx)
+	if !ok {
+		return nil // no integrity key: sealed along with everything else by sealDataFile, or not a sealed backend
+	}
+	b := st.tx.Bucket([]byte(bucketRemote))
+	if b == nil {
+		return nil
+	}
+	values := map[string][]byte{}
+	if err := b.ForEach(func(k, v []byte) error {
+		if _, ok := openValue(st.key, bucketRemote, k, v); !ok {
+			values[string(k)] = append([]byte(nil), v...)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for k, v := range values {
+		if err := b.Put([]byte(k), sealValue(st.key, bucketRemote, []byte(k), v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protectIntegrityKey encrypts the key that versions 8 and 9 stored as-is.
+func protectIntegrityKey(tx DataTx) error {
+	st, ok := tx.(*sealedTx)
+	if !ok {
+		return nil // no integrity key, or it was just created encrypted by sealDataFile
+	}
+	return putIntegrityKey(st.tx, st.key)
+}
+
+// sealNewDataFile gives a file that has nothing in it yet its integrity key, so that it is sealed from
+// the first save.
+func sealNewDataFile(tx DataTx) error {
+	if !activeStore.sealed() || hasIntegrityKey(tx) {
+		return nil
+	}
+	if lb := tx.Bucket([]byte(bucketLastUpdate)); lb != nil && lb.Get([]byte(keyDfVer)) != nil {
+		return nil
+	}
+	for _, name := range dataBuckets {
+		if b := tx.Bucket([]byte(name)); b != nil {
+			if k, _ := b.Cursor().First(); k != nil {
+				return nil // written before version 8; sealed by its migration
+			}
+		}
+	}
+	_, err := createIntegrityKey(tx)
+	return err
+}
+
+// verifyDataFile returns the records of db that fail the integrity check.
+func verifyDataFile(db DataStore) ([]string, error) {
+	var bad []string
+	err := db.View(func(tx DataTx) error {
+		key, err := readIntegrityKey(tx)
+		if err != nil {
+			logger.Infow("unable to read the integrity key", "error", err)
+			bad = append(bad, fmt.Sprintf("%s/%s", bucketIntegrity, keyIntegrity))
+			return nil
+		}
+		if key == nil {
+			if activeStore.sealed() && readDataFileVersion(tx) >= integrityVersion {
+				bad = append(bad, fmt.Sprintf("%s/%s", bucketIntegrity, keyIntegrity)) // removed
+			}
+			return nil
+		}
+		version := readDataFileVersion(tx)
+		for _, name := range dataBuckets {
+			b := tx.Bucket([]byte(name))
+			if b == nil || (name == bucketRemote && version < remoteSealVersion) {
+				continue // not sealed until its migration
+			}
+			if err := b.ForEach(func(k, v []byte) error {
+				if _, ok := openValue(key, name, k, v); !ok {
+					bad = append(bad, fmt.Sprintf("%s/%q", name, k))
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return bad, err
+}
+
+// checkIntegrity verifies every record of the data file. A damaged file is replaced with the newest
+// backup that passes the check, and the settings are reset if there is none.
+func (ls *LauncherStore) checkIntegrity() bool {
+	bad, err := verifyDataFile(ls.DataStore)
+	if err == nil && len(bad) == 0 {
+		return true
+	}
+	logger.Errorw(fmt.Sprintf("%s: data file failed the integrity check", GetCaller()), "records", bad, "error", err)
+	ls.recoverDataFile()
+	return false
+}
+
+// RecoverDataFile replaces a data file whose records failed the integrity check (see IsErrCorrupted) with
+// the newest backup that passes it. It returns false if there was none, and the settings were reset.
+func RecoverDataFile() bool {
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return false
+	}
+	defer ls.Close()
+	return ls.recoverDataFile()
+}
+
+func (ls *LauncherStore) recoverDataFile() bool {
+	backup, err := latestGoodBackup()
+	if err != nil || backup == nil {
+		logger.Errorw(fmt.Sprintf("%s: no usable backup to recover damaged data file from", GetCaller()), "error", err)
+		DeleteConfiguration(true)
+		ShowFatalErrorMsg("Settings Damaged", fmt.Sprintf(
+			"Your %s file is damaged or was changed outside QCLauncher, and no usable backup was found. It was moved to the %s folder. Please restart QCLauncher to configure it again.",
+			DataFile, BackupDir), nil)
+		return false
+	}
+	if err = RestoreDataFile(backup.Name); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error restoring backup of damaged data file", GetCaller()), "backup", backup.Name,
+			"error", err)
+		ShowFatalErrorMsg("Settings Damaged", fmt.Sprintf(
+			"Your %s file is damaged or was changed outside QCLauncher, and the backup %s could not be restored: %s",
+			DataFile, backup.Name, err), nil)
+		return false
+	}
+	if err = ls.reopen(); err != nil {
+		ShowFatalErrorMsg("Error", fmt.Sprintf("Unable to open the restored %s file: %s", DataFile, err), nil)
+		return false
+	}
+	logger.Infow("damaged data file replaced with backup", "backup", backup.Name)
+	ShowWarningMsg("Settings Restored", fmt.Sprintf(
+		"Your %s file was damaged or changed outside QCLauncher, so your settings were restored from the backup made %s. Changes made since then need to be made again. The damaged file was kept in the %s folder.",
+		DataFile, backup.Time.Format("2006-01-02 15:04"), BackupDir), nil)
+	ls.checkDataFile(false)
+	return true
+}
+
+// latestGoodBackup returns the newest backup that this QCLauncher can load and that passes the integrity
+// check, or nil if there is none.
+func latestGoodBackup() (*DataFileBackup, error) {
+	backups, err := ListDataFileBackups()
+	if err != nil {
+		return nil, err
+	}
+	for i := range backups {
+		p := filepath.Join(getBackupDirPath(), backups[i].Name)
+		if err = checkBackupVersion(p); err != nil {
+			logger.Infow("skipping backup", "backup", backups[i].Name, "reason", err)
+			continue
+		}
+		db, err := openDataStore(p, true)
+		if err != nil {
+			continue
+		}
+		bad, err := verifyDataFile(db)
+		db.Close()
+		if err != nil || len(bad) > 0 {
+			logger.Infow("skipping damaged backup", "backup", backups[i].Name, "records", strings.Join(bad, ", "))
+			continue
+		}
+		return &backups[i], nil
+	}
+	return nil, nil
+}
@@ -145,22 +145,19 @@ func formatUnexpectedResponse(event string) error {
 
 func buildArgs(cfg *Configuration, baseArgs string) string {
 	largs := []string{baseArgs}
+	if cfg.Profile != nil && cfg.Profile.CustomArgs != "" {
+		largs = append(largs, cfg.Profile.CustomArgs)
+	}
 	if ConfAppendCustomArgs != "" {
 		largs = append(largs, ConfAppendCustomArgs)
 	}
+	exp := cfg.Experimental.copy()
 	// Keep support for cmd-line (shortcut) Max FPS argument for backwards compatibility w/ previous version
 	// If the "maxfps" cmd-line argument is specified, it takes precedence over the value configured in the UI
 	if ConfMaxFPS != 0 {
-		largs = append(largs, fmt.Sprintf("--set /Config/CONFIG/maxFpsValue %d", ConfMaxFPS))
-	} else if cfg.Experimental.UseMaxFPSLimit {
-		largs = append(largs, fmt.Sprintf("--set /Config/CONFIG/maxFpsValue %d", cfg.Experimental.MaxFPSLimit))
-	}
-	if cfg.Experimental.UseMaxFPSLimitMinimized {
-		largs = append(largs, fmt.Sprintf("--set /Config/CONFIG/maxFpsValueMinimized %d", cfg.Experimental.MaxFPSLimitMinimized))
-	}
-	if cfg.Experimental.UseFPSSmoothing {
-		largs = append(largs, fmt.Sprintf("--set /Config/CONFIG/enableFpsSmooth 1"))
+		exp.Options[optionMaxFPS] = strconv.Itoa(ConfMaxFPS)
 	}
+	largs = append(largs, exp.args()...)
 	return strings.Join(largs, " ")
 }
 
@@ -194,6 +191,9 @@ func getProjectBranchBuildIdentifiers(r *EntitlementInfoResponse) (projectID int
 }
 
 func handlePostLaunch(cfg *Configuration) {
+	if ConfHeadless {
+		return
+	}
 	if cfg.Launcher.ExitOnLaunch {
 		exitFromUI()
 		return
@@ -8,8 +8,8 @@ import (
 	"strings"
 
 	"net/url"
-	"os"
 
+	"github.com/syncore/qclauncher/logrotate"
 	log "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -23,8 +23,7 @@ var logger *qlogger
 func NewLogger() *qlogger {
 	logCfg := log.NewProductionConfig()
 	winFileSink := func(u *url.URL) (log.Sink, error) {
-		// https://github.com/uber-go/zap/issues/621
-		return os.OpenFile(u.Path[1:], os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		return logrotate.NewSink(u)
 	}
 	if err := log.RegisterSink("winfile", winFileSink); err != nil {
 		// logger in main will have already registered before overall logger
@@ -32,16 +31,20 @@ func NewLogger() *qlogger {
 			panic(fmt.Errorf("Could not register sink for structured logger, error: %s", err))
 		}
 	}
+	if err := log.RegisterEncoder(redactingEncoderName, newRedactingEncoder); err != nil {
+		if !strings.Contains(err.Error(), "already registered") {
+			panic(fmt.Errorf("Could not register encoder for structured logger, error: %s", err))
+		}
+	}
 	logCfg.OutputPaths = []string{"winfile:///" + getLogFilePath()}
-	logCfg.Encoding = "json"
+	logCfg.Encoding = redactingEncoderName
 	logCfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	logCfg.Level = logLevel
 	if ConfDebug {
-		logCfg.Level.SetLevel(zapcore.DebugLevel)
 		logCfg.DisableStacktrace = false
 		logCfg.DisableCaller = false
 		logCfg.Development = true
 	} else {
-		logCfg.Level.SetLevel(zapcore.ErrorLevel)
 		logCfg.DisableStacktrace = true
 		logCfg.DisableCaller = true
 		logCfg.Development = false
@@ -63,5 +66,6 @@ func setLogger() {
 	if logger != nil {
 		return
 	}
+	logLevel.SetLevel(defaultLogLevel())
 	logger = NewLogger()
 }
@@ -0,0 +1,113 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	LogLevelFile          = "qcl.loglevel"
+	logLevelWatchInterval = 2 * time.Second
+)
+
+var (
+	// shared by every logger so that a level change applies everywhere at once
+	logLevel  = log.NewAtomicLevelAt(zapcore.ErrorLevel)
+	LogLevels = []string{"debug", "info", "warn", "error"}
+)
+
+func defaultLogLevel() zapcore.Level {
+	if ConfDebug {
+		return zapcore.DebugLevel
+	}
+	return zapcore.ErrorLevel
+}
+
+func GetLogLevel() string {
+	return logLevel.Level().String()
+}
+
+func logLevelIndex(level string) int {
+	for i, l := range LogLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+func SetLogLevel(level string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(strings.ToLower(strings.TrimSpace(level)))); err != nil {
+		return &usageError{emsg: fmt.Sprintf("Unknown log level: %s (expected one of: %s)", level, strings.Join(LogLevels, ", "))}
+	}
+	if l == logLevel.Level() {
+		return nil
+	}
+	logLevel.SetLevel(l)
+	logger.Infow("log level changed", "level", l.String()) // only written when the new level includes info
+	return nil
+}
+
+// RequestLogLevel changes the level of this process and asks a running QCLauncher to do the same.
+func RequestLogLevel(level string) error {
+	if err := SetLogLevel(level); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(getLogLevelFilePath(), []byte(GetLogLevel()), 0644)
+}
+
+func getRequestedLogLevel() (string, bool) {
+	b, err := ioutil.ReadFile(getLogLevelFilePath())
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(b)), true
+}
+
+// watchLogLevelFile picks up level changes requested from the command line while the UI is running.
+func watchLogLevelFile(onChange func(level string), stop <-chan struct{}) {
+	var lastMod time.Time
+	if fi, err := os.Stat(getLogLevelFilePath()); err == nil {
+		lastMod = fi.ModTime() // only requests made after startup
+	}
+	t := time.NewTicker(logLevelWatchInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			fi, err := os.Stat(getLogLevelFilePath())
+			if err != nil || !fi.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = fi.ModTime()
+			level, ok := getRequestedLogLevel()
+			if !ok {
+				continue
+			}
+			if err = SetLogLevel(level); err != nil {
+				logger.Errorw(fmt.Sprintf("%s: invalid log level requested", GetCaller()), "level", level, "error", err)
+				continue
+			}
+			if onChange != nil {
+				onChange(GetLogLevel())
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func getLogLevelFilePath() string {
+	return filepath.Join(getExecutingPath(), LogLevelFile)
+}
@@ -0,0 +1,132 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+// Package logrotate is the zap sink that writes QCLauncher's log file and rotates it. It has no Windows or
+// UI dependencies so that it can be tested on any platform.
+package logrotate
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	DefaultMaxSizeMB  = 10
+	DefaultMaxAgeDays = 30
+	DefaultMaxBackups = 5
+	LimitMaxSizeMB    = 1024
+	LimitMaxAgeDays   = 3650
+	LimitMaxBackups   = 100
+)
+
+type Rotation struct {
+	MaxSizeMB  int
+	MaxAgeDays int
+	MaxBackups int
+	Compress   bool
+}
+
+// Sink is shared by every logger writing to the same file, so that rotation settings loaded
+// from the data file after the logger was built take effect everywhere.
+type Sink struct {
+	mu sync.Mutex
+	lj *lumberjack.Logger
+}
+
+var (
+	sinksMu sync.Mutex
+	sinks   = map[string]*Sink{}
+)
+
+// NewSink returns the sink for the file named by u, which starts with the default rotation settings.
+func NewSink(u *url.URL) (*Sink, error) {
+	p := sinkPath(u)
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	if s, ok := sinks[p]; ok {
+		return s, nil
+	}
+	s := &Sink{lj: &lumberjack.Logger{Filename: p}}
+	s.lj.MaxSize, s.lj.MaxAge, s.lj.MaxBackups, s.lj.Compress = Default().Values()
+	sinks[p] = s
+	return s, nil
+}
+
+func sinkPath(u *url.URL) string {
+	// https://github.com/uber-go/zap/issues/621 - the path of winfile:///C:/dir/file.log is /C:/dir/file.log
+	p := u.Path
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.Clean(filepath.FromSlash(p))
+}
+
+func (s *Sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lj.Write(p)
+}
+
+func (s *Sink) Sync() error {
+	return nil // lumberjack does not buffer
+}
+
+func (s *Sink) Close() error {
+	// several loggers share the sink, so the file is left open until the process exits
+	return nil
+}
+
+func (s *Sink) configure(r *Rotation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lj.MaxSize, s.lj.MaxAge, s.lj.MaxBackups, s.lj.Compress = r.Values()
+}
+
+// Configure applies r to the sinks writing to the file at p.
+func Configure(p string, r *Rotation) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for sp, sink := range sinks {
+		if strings.EqualFold(sp, filepath.Clean(p)) {
+			sink.configure(r)
+		}
+	}
+}
+
+func Default() *Rotation {
+	return &Rotation{MaxSizeMB: DefaultMaxSizeMB, MaxAgeDays: DefaultMaxAgeDays, MaxBackups: DefaultMaxBackups}
+}
+
+func (r *Rotation) Values() (maxSize, maxAge, maxBackups int, compress bool) {
+	d := Default()
+	maxSize, maxAge, maxBackups = r.MaxSizeMB, r.MaxAgeDays, r.MaxBackups
+	// zero means "not set" (settings saved by older versions), not "unlimited"
+	if maxSize <= 0 {
+		maxSize = d.MaxSizeMB
+	}
+	if maxAge <= 0 {
+		maxAge = d.MaxAgeDays
+	}
+	if maxBackups <= 0 {
+		maxBackups = d.MaxBackups
+	}
+	return maxSize, maxAge, maxBackups, r.Compress
+}
+
+func (r *Rotation) Validate() error {
+	if r.MaxSizeMB < 0 || r.MaxSizeMB > LimitMaxSizeMB {
+		return fmt.Errorf("Maximum log size must be between 1 and %d MB, or 0 for the default", LimitMaxSizeMB)
+	}
+	if r.MaxAgeDays < 0 || r.MaxAgeDays > LimitMaxAgeDays {
+		return fmt.Errorf("Maximum log age must be between 1 and %d days, or 0 for the default", LimitMaxAgeDays)
+	}
+	if r.MaxBackups < 0 || r.MaxBackups > LimitMaxBackups {
+		return fmt.Errorf("Number of old log files to keep must be between 1 and %d, or 0 for the default", LimitMaxBackups)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package logrotate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotationValidate(t *testing.T) {
+	valid := []Rotation{
+		{},
+		{MaxSizeMB: 1, MaxAgeDays: 1, MaxBackups: 1},
+		{MaxSizeMB: LimitMaxSizeMB, MaxAgeDays: LimitMaxAgeDays, MaxBackups: LimitMaxBackups},
+	}
+	for _, r := range valid {
+		if err := r.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error: %s", r, err)
+		}
+	}
+	invalid := []Rotation{
+		{MaxSizeMB: -1},
+		{MaxSizeMB: LimitMaxSizeMB + 1},
+		{MaxAgeDays: -1},
+		{MaxAgeDays: LimitMaxAgeDays + 1},
+		{MaxBackups: -1},
+		{MaxBackups: LimitMaxBackups + 1},
+	}
+	for _, r := range invalid {
+		err := r.Validate()
+		if err == nil {
+			t.Errorf("%+v: expected an error", r)
+			continue
+		}
+		if !strings.Contains(err.Error(), "0 for the default") {
+			t.Errorf("%+v: message does not mention the default: %s", r, err)
+		}
+	}
+}
+
+func TestRotationValuesDefaultZero(t *testing.T) {
+	size, age, backups, compress := (&Rotation{Compress: true}).Values()
+	if size != DefaultMaxSizeMB || age != DefaultMaxAgeDays || backups != DefaultMaxBackups || !compress {
+		t.Errorf("got %d, %d, %d, %t", size, age, backups, compress)
+	}
+	size, age, backups, _ = (&Rotation{MaxSizeMB: 2, MaxAgeDays: 3, MaxBackups: 4}).Values()
+	if size != 2 || age != 3 || backups != 4 {
+		t.Errorf("got %d, %d, %d", size, age, backups)
+	}
+}
+
+func TestSinkPath(t *testing.T) {
+	u, err := url.Parse("winfile:///C:/QCLauncher/qclauncher.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Clean(filepath.FromSlash("C:/QCLauncher/qclauncher.log"))
+	if got := sinkPath(u); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func newTestSink(t *testing.T) (*Sink, string) {
+	p := filepath.Join(t.TempDir(), "qclauncher.log")
+	s, err := NewSink(&url.URL{Scheme: "winfile", Path: filepath.ToSlash(p)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.lj.Close()
+		sinksMu.Lock()
+		delete(sinks, p)
+		sinksMu.Unlock()
+	})
+	return s, p
+}
+
+func TestSinkShared(t *testing.T) {
+	s, p := newTestSink(t)
+	again, err := NewSink(&url.URL{Scheme: "winfile", Path: filepath.ToSlash(p)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != s {
+		t.Error("expected the same sink for the same file")
+	}
+}
+
+func TestSinkRotates(t *testing.T) {
+	s, p := newTestSink(t)
+	Configure(strings.ToUpper(p), &Rotation{MaxSizeMB: 1, MaxBackups: 2})
+	line := append(bytes.Repeat([]byte("x"), 1023), '\n')
+	for i := 0; i < 1500; i++ {
+		if _, err := s.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("expected the log to be rotated, found %d file(s)", len(files))
+	}
+	for _, f := range files {
+		if f.Size() > 1024*1024 {
+			t.Errorf("%s is larger than the 1 MB limit (%d bytes)", f.Name(), f.Size())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const maxLogViewLines = 2000
+
+type logViewEntry struct {
+	time   string
+	level  zapcore.Level
+	msg    string
+	fields []string
+	raw    string
+}
+
+type logViewFilter struct {
+	minLevel zapcore.Level
+	text     string
+}
+
+func parseLogLine(line string) *logViewEntry {
+	e := &logViewEntry{raw: line, level: zapcore.InfoLevel}
+	var m map[string]interface{}
+	d := json.NewDecoder(strings.NewReader(line))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		e.msg = line // not written by zap (e.g. a panic); show as-is
+		return e
+	}
+	for k, v := range m {
+		switch k {
+		case "ts":
+			e.time = fmt.Sprint(v)
+		case "level":
+			if err := e.level.UnmarshalText([]byte(fmt.Sprint(v))); err != nil {
+				e.level = zapcore.InfoLevel
+			}
+		case "msg":
+			e.msg = fmt.Sprint(v)
+		default:
+			e.fields = append(e.fields, fmt.Sprintf("    %s: %s", k, formatLogValue(v)))
+		}
+	}
+	sort.Strings(e.fields)
+	return e
+}
+
+func formatLogValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		// response bodies are logged as JSON strings
+		var buf bytes.Buffer
+		if (strings.HasPrefix(t, "{") || strings.HasPrefix(t, "[")) && json.Indent(&buf, []byte(t), "      ", "  ") == nil {
+			return buf.String()
+		}
+		return t
+	case map[string]interface{}, []interface{}:
+		b, err := json.MarshalIndent(t, "      ", "  ")
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func (e *logViewEntry) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-5s %s", e.time, strings.ToUpper(e.level.String()), e.msg)
+	for _, f := range e.fields {
+		b.WriteString("\n")
+		b.WriteString(f)
+	}
+	return b.String()
+}
+
+func (f *logViewFilter) matches(e *logViewEntry) bool {
+	if e.level < f.minLevel {
+		return false
+	}
+	if f.text == "" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(e.raw), strings.ToLower(f.text))
+}
+
+func readLogView(filter *logViewFilter) (string, error) {
+	data, err := tailLogFile(maxLogViewLines, nil)
+	if err != nil {
+		return "", err
+	}
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if e := parseLogLine(line); filter.matches(e) {
+			entries = append(entries, e.String())
+		}
+	}
+	return strings.Join(entries, "\n"), nil
+}
@@ -0,0 +1,414 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	UnlockCacheFile     = "qclauncher.unlock"
+	minMasterPassphrase = 8
+	unlockCacheEntropy  = "qclauncher-unlock:"
+)
+
+// MasterLock is stored when a master passphrase is set. The credential key (keyTokenKey) is then stored
+// encrypted with a key derived from the passphrase with these parameters.
+type MasterLock struct {
+	KDF     string
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	Salt    []byte
+}
+
+var (
+	masterKey   []byte // derived from the master passphrase once it has been entered
+	masterKeyMu sync.Mutex
+	unlockMu    sync.Mutex // one passphrase prompt at a time
+)
+
+func newMasterLock() (*MasterLock, error) {
+	salt := make([]byte, exportSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &MasterLock{KDF: exportKDF, Time: exportKDFTime, Memory: exportKDFMemory, Threads: exportKDFThreads, Salt: salt}, nil
+}
+
+func (ml *MasterLock) deriveKey(passphrase string) ([]byte, error) {
+	if ml.KDF != exportKDF || ml.Time == 0 || ml.Memory == 0 || ml.Threads == 0 || len(ml.Salt) == 0 {
+		return nil, fmt.Errorf("unsupported master passphrase key derivation: %s", ml.KDF)
+	}
+	return argon2.IDKey([]byte(passphrase), ml.Salt, ml.Time, ml.Memory, ml.Threads, 32), nil
+}
+
+// readMasterLock returns nil if no master passphrase is set.
+func readMasterLock(tx DataTx) (*MasterLock, error) {
+	data := tx.Bucket([]byte(bucketSettings)).Get([]byte(keyMasterLock))
+	if len(data) == 0 {
+		return nil, nil
+	}
+	ml := &MasterLock{}
+	if err := decodeRecord(data, ml); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding master passphrase settings", GetCaller()), "error", err)
+		return nil, err
+	}
+	return ml, nil
+}
+
+// credentialKey returns the key that the stored credentials are encrypted with, or nil if none was saved yet.
+func credentialKey(tx DataTx) ([]byte, error) {
+	stored := tx.Bucket([]byte(bucketSettings)).Get([]byte(keyTokenKey))
+	ml, err := readMasterLock(tx)
+	if err != nil || ml == nil || len(stored) == 0 {
+		return stored, err
+	}
+	mk := getMasterKey()
+	if mk == nil {
+		return nil, &lockedError{emsg: "Your saved credentials are locked. Enter your master passphrase to unlock them."}
+	}
+	return unwrapKey(stored, mk)
+}
+
+// putCredentialKey stores the credential key, encrypted with the master passphrase if one is set.
+func putCredentialKey(tx DataTx, key []byte) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+	if err != nil {
+		return err
+	}
+	ml, err := readMasterLock(tx)
+	if err != nil {
+		return err
+	}
+	if ml == nil {
+		return b.Put([]byte(keyTokenKey), key)
+	}
+	mk := getMasterKey()
+	if mk == nil {
+		return &lockedError{emsg: "Your saved credentials are locked. Enter your master passphrase to unlock them."}
+	}
+	wrapped, err := encrypt(string(key), &mk)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(keyTokenKey), []byte(wrapped))
+}
+
+func unwrapKey(wrapped, mk []byte) ([]byte, error) {
+	key, err := decrypt(string(wrapped), &mk)
+	if err != nil {
+		return nil, &authFailedError{emsg: "Wrong master passphrase"}
+	}
+	return []byte(key), nil
+}
+
+func getMasterKey() []byte {
+	masterKeyMu.Lock()
+	defer masterKeyMu.Unlock()
+	return masterKey
+}
+
+func setMasterKey(mk []byte) {
+	masterKeyMu.Lock()
+	defer masterKeyMu.Unlock()
+	masterKey = mk
+}
+
+// HasMasterPassphrase reports whether the saved credentials are protected by a master passphrase.
+func HasMasterPassphrase() (bool, error) {
+	if !DataStoreExists() {
+		return false, nil
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return false, err
+	}
+	defer ls.Close()
+	var ml *MasterLock
+	err = ls.View(func(tx DataTx) error {
+		ml, err = readMasterLock(tx)
+		return err
+	})
+	return ml != nil, err
+}
+
+// unlockCredentials asks for the master passphrase if one is set and it has not been entered yet. The
+// unlock cache is tried first.
+func unlockCredentials() error {
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	if getMasterKey() != nil {
+		return nil
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return err
+	}
+	defer ls.Close()
+	var ml *MasterLock
+	var wrapped []byte
+	if err = ls.View(func(tx DataTx) error {
+		ml, err = readMasterLock(tx)
+		wrapped = append([]byte(nil), tx.Bucket([]byte(bucketSettings)).Get([]byte(keyTokenKey))...)
+		return err
+	}); err != nil || ml == nil || len(wrapped) == 0 {
+		return err
+	}
+	if mk := readUnlockCache(); mk != nil {
+		if _, err = unwrapKey(wrapped, mk); err == nil {
+			setMasterKey(mk)
+			return nil
+		}
+	}
+	for {
+		passphrase, remember, ok := askMasterPassphrase()
+		if !ok {
+			return &lockedError{emsg: "The master passphrase is needed to read your saved credentials"}
+		}
+		mk, err := ml.deriveKey(passphrase)
+		if err != nil {
+			return err
+		}
+		if _, err = unwrapKey(wrapped, mk); err != nil {
+			logger.Infow("wrong master passphrase entered")
+			if ConfHeadless {
+				return err
+			}
+			ShowErrorMsg("Unlock QCLauncher", "Wrong master passphrase. Please try again.", nil)
+			continue
+		}
+		setMasterKey(mk)
+		if remember {
+			if err = writeUnlockCache(mk); err != nil {
+				logger.Errorw(fmt.Sprintf("%s: error saving unlock cache", GetCaller()), "error", err)
+			}
+		}
+		return nil
+	}
+}
+
+func askMasterPassphrase() (string, bool, bool) {
+	if !ConfHeadless {
+		return askUnlockPassphrase(nil)
+	}
+	if ConfMasterPassFile != "" {
+		passphrase, err := readPassphraseFile(ConfMasterPassFile)
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error reading master passphrase file", GetCaller()), "error", err)
+			return "", false, false
+		}
+		return passphrase, false, true
+	}
+	passphrase, err := readConsolePassphrase("Master passphrase: ")
+	if err != nil || passphrase == "" {
+		return "", false, false
+	}
+	return passphrase, false, true
+}
+
+// SetMasterPassphrase sets or changes the master passphrase, or removes it if passphrase is empty. current
+// is the passphrase in use, if any.
+func SetMasterPassphrase(current, passphrase string) error {
+	if !DataStoreExists() {
+		return &notConfiguredError{emsg: "QCLauncher has not been configured yet. Run QCLauncher and click \"Configure\"."}
+	}
+	if passphrase != "" && len(passphrase) < minMasterPassphrase {
+		return &usageError{emsg: fmt.Sprintf("The master passphrase must be at least %d characters", minMasterPassphrase)}
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return err
+	}
+	defer ls.Close()
+	ls.checkDataFile(false)
+	var mk []byte
+	if err = ls.Update(func(tx DataTx) error {
+		b := tx.Bucket([]byte(bucketSettings))
+		key := append([]byte(nil), b.Get([]byte(keyTokenKey))...)
+		if len(key) == 0 {
+			return &notConfiguredError{emsg: "Save your settings before setting a master passphrase"}
+		}
+		ml, err := readMasterLock(tx)
+		if err != nil {
+			return err
+		}
+		if ml == nil && passphrase == "" {
+			return &usageError{emsg: "No master passphrase is set"}
+		}
+		if ml != nil {
+			cur, err := ml.deriveKey(current)
+			if err != nil {
+				return err
+			}
+			if key, err = unwrapKey(key, cur); err != nil {
+				return err
+			}
+		}
+		if passphrase == "" {
+			if err = b.Delete([]byte(keyMasterLock)); err != nil {
+				return err
+			}
+			return b.Put([]byte(keyTokenKey), key)
+		}
+		if ml, err = newMasterLock(); err != nil {
+			return err
+		}
+		if mk, err = ml.deriveKey(passphrase); err != nil {
+			return err
+		}
+		wrapped, err := encrypt(string(key), &mk)
+		if err != nil {
+			return err
+		}
+		data, err := encodeRecord(ml)
+		if err != nil {
+			return err
+		}
+		if err = b.Put([]byte(keyMasterLock), data); err != nil {
+			return err
+		}
+		return b.Put([]byte(keyTokenKey), []byte(wrapped))
+	}); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error changing master passphrase", GetCaller()), "error", err)
+		return err
+	}
+	setMasterKey(mk)
+	ClearUnlockCache()
+	logger.Infow("master passphrase changed", "set", passphrase != "")
+	return nil
+}
+
+// RememberMasterPassphrase unlocks the saved credentials until the user signs out of Windows.
+func RememberMasterPassphrase() error {
+	if err := unlockCredentials(); err != nil {
+		return err
+	}
+	mk := getMasterKey()
+	if mk == nil {
+		return &usageError{emsg: "No master passphrase is set"}
+	}
+	return writeUnlockCache(mk)
+}
+
+// ClearUnlockCache makes QCLauncher ask for the master passphrase again the next time it starts.
+func ClearUnlockCache() {
+	if err := os.Remove(getUnlockCachePath()); err != nil && !os.IsNotExist(err) {
+		logger.Errorw(fmt.Sprintf("%s: error deleting unlock cache", GetCaller()), "error", err)
+	}
+}
+
+func getUnlockCachePath() string {
+	return filepath.Join(getExecutingPath(), UnlockCacheFile)
+}
+
+// The unlock cache holds the master key protected with DPAPI, tied to the current Windows logon session so
+// that it stops working when the user signs out.
+func writeUnlockCache(mk []byte) error {
+	entropy, err := logonSessionEntropy()
+	if err != nil {
+		return err
+	}
+	data, err := dpapiProtect(mk, entropy)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(getUnlockCachePath(), data, 0600)
+}
+
+func readUnlockCache() []byte {
+	data, err := ioutil.ReadFile(getUnlockCachePath())
+	if err != nil {
+		return nil
+	}
+	entropy, err := logonSessionEntropy()
+	if err != nil {
+		return nil
+	}
+	mk, err := dpapiUnprotect(data, entropy)
+	if err != nil {
+		logger.Infow("unlock cache is from another logon session")
+		return nil
+	}
+	return mk
+}
+
+func logonSessionEntropy() ([]byte, error) {
+	// TOKEN_STATISTICS: TokenId, then AuthenticationId (the logon session's LUID)
+	buf := make([]byte, 64)
+	var n uint32
+	if err := windows.GetTokenInformation(windows.GetCurrentProcessToken(), windows.TokenStatistics, &buf[0],
+		uint32(len(buf)), &n); err != nil {
+		return nil, err
+	}
+	return append([]byte(unlockCacheEntropy), buf[8:16]...), nil
+}
+
+func dpapiProtect(data, entropy []byte) ([]byte, error) {
+	in := &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	ent := &windows.DataBlob{Size: uint32(len(entropy)), Data: &entropy[0]}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(in, nil, ent, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return takeDataBlob(&out), nil
+}
+
+func dpapiUnprotect(data, entropy []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty unlock cache")
+	}
+	in := &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	ent := &windows.DataBlob{Size: uint32(len(entropy)), Data: &entropy[0]}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(in, nil, ent, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return takeDataBlob(&out), nil
+}
+
+func takeDataBlob(b *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(b.Data)))
+	return append([]byte(nil), (*[1 << 20]byte)(unsafe.Pointer(b.Data))[:b.Size:b.Size]...)
+}
+
+// readConsolePassphrase reads a line from the console without echoing it.
+func readConsolePassphrase(prompt string) (string, error) {
+	in := os.Stdin
+	if h, err := syscall.GetStdHandle(syscall.STD_INPUT_HANDLE); err != nil || h == 0 || h == syscall.InvalidHandle {
+		f, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		in = f
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	h := windows.Handle(in.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(h, &mode); err == nil {
+		windows.SetConsoleMode(h, mode&^windows.ENABLE_ECHO_INPUT)
+		defer func() {
+			windows.SetConsoleMode(h, mode)
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,267 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+type migration struct {
+	to   int64
+	desc string
+	run  func(tx DataTx) error
+}
+
+// Ordered by target version. A step runs when the saved data file version is below its target version,
+// so adding a version means bumping dataFileVersion and appending one step here.
+var migrations = []*migration{
+	{to: 4, desc: "carry over settings from data files written before version 4", run: migrateLegacySettings},
+	{to: 5, desc: "store experimental settings as QC options", run: migrateExperimentalOptions},
+	// nothing to convert; the version keeps older QCLaunchers away from files whose key needs a master passphrase
+	{to: 6, desc: "allow a master passphrase", run: func(tx DataTx) error { return nil }},
+	{to: 7, desc: "move credentials to the secret store", run: migrateSecrets},
+	{to: 8, desc: "add integrity checks to every record", run: sealDataFile},
+	{to: 9, desc: "add integrity checks to cached remote documents", run: sealRemoteResponses},
+	{to: 10, desc: "encrypt the integrity key with DPAPI", run: protectIntegrityKey},
+}
+
+// experimentalSettingsV4 is QCExperimentalSettings as stored up to version 4.
+type experimentalSettingsV4 struct {
+	UseMaxFPSLimit          bool
+	MaxFPSLimit             int
+	UseMaxFPSLimitMinimized bool
+	MaxFPSLimitMinimized    int
+	UseFPSSmoothing         bool
+}
+
+type profileV4 struct {
+	Name         string
+	CustomArgs   string
+	Experimental *experimentalSettingsV4
+	Launcher     *LauncherSettings
+}
+
+func pendingMigrations(from int64) []*migration {
+	var pending []*migration
+	for _, m := range migrations {
+		if m.to > from && m.to <= dataFileVersion {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+func (ls *LauncherStore) migrate(from int64) (string, error) {
+	backup, err := ls.backupBeforeMigration(from)
+	if err != nil {
+		return "", fmt.Errorf("unable to back up %s before migrating: %s", DataFile, err)
+	}
+	logger.Infow("migrating data file", "from", from, "to", dataFileVersion, "backup", backup)
+	// one transaction so that a failed step leaves the file exactly as it was
+	err = ls.Update(func(tx DataTx) error {
+		for _, m := range pendingMigrations(from) {
+			if err := m.run(tx); err != nil {
+				return fmt.Errorf("migration to version %d (%s) failed: %s", m.to, m.desc, err)
+			}
+			logger.Infow("data file migration step complete", "to", m.to, "step", m.desc)
+		}
+		return putDataFileVersion(tx)
+	})
+	return backup, err
+}
+
+func (ls *LauncherStore) backupBeforeMigration(from int64) (string, error) {
+	empty := true
+	if err := ls.View(func(tx DataTx) error {
+		if b := tx.Bucket([]byte(bucketSettings)); b != nil {
+			k, _ := b.Cursor().First()
+			empty = k == nil
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	if empty {
+		return "", nil // nothing worth keeping (e.g. a file created before the first save)
+	}
+	return ls.backup(fmt.Sprintf("%s-v%d", backupReasonMigration, from))
+}
+
+func putDataFileVersion(tx DataTx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketLastUpdate))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating update bucket for saving data file version to datastore", GetCaller()),
+			"error", err)
+		return err
+	}
+	dfv := make([]byte, 8)
+	binary.LittleEndian.PutUint64(dfv, uint64(dataFileVersion))
+	if err = b.Put([]byte(keyDfVer), dfv); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving data file version to datastore", GetCaller()), "error", err)
+		return err
+	}
+	return nil
+}
+
+// readDataFileVersion returns the saved data file version, 0 for files from before versioning was added.
+func readDataFileVersion(tx DataTx) int64 {
+	b := tx.Bucket([]byte(bucketLastUpdate))
+	if b == nil {
+		return 0
+	}
+	if v := b.Get([]byte(keyDfVer)); len(v) == 8 {
+		return int64(binary.LittleEndian.Uint64(v))
+	}
+	return 0
+}
+
+// The layouts of versions before 4 were never recorded, so this re-encodes every record with the version 4
+// types. A record that no longer decodes fails the migration rather than losing the user's credentials.
+func migrateLegacySettings(tx DataTx) error {
+	for _, name := range []string{bucketSettings, bucketLastUpdate, bucketServerStatus} {
+		if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+	}
+	b := tx.Bucket([]byte(bucketSettings))
+	records := []struct {
+		key string
+		v   interface{}
+	}{
+		{keyQCCoreSettings, &QCCoreSettings{}},
+		{keyQCExperimentalSettings, &experimentalSettingsV4{}},
+		{keyLauncherSettings, &LauncherSettings{}},
+		{keyTokenAuth, &TokenAuth{}},
+	}
+	for _, r := range records {
+		if err := reencodeRecord(b, r.key, r.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reencodeRecord rewrites a record with its current type, which drops fields that no longer exist.
+func reencodeRecord(b DataBucket, key string, v interface{}) error {
+	data := b.Get([]byte(key))
+	if data == nil {
+		return nil
+	}
+	if err := decodeRecord(data, v); err != nil {
+		return fmt.Errorf("unable to carry over %s: %s", key, err)
+	}
+	data, err := encodeRecord(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+func migrateExperimentalOptions(tx DataTx) error {
+	b := tx.Bucket([]byte(bucketSettings))
+	if data := b.Get([]byte(keyQCExperimentalSettings)); data != nil {
+		old := &experimentalSettingsV4{}
+		if err := decodeRecord(data, old); err != nil {
+			return fmt.Errorf("unable to carry over experimental settings: %s", err)
+		}
+		encoded, err := old.upgrade().encode()
+		if err != nil {
+			return err
+		}
+		if err = b.Put([]byte(keyQCExperimentalSettings), encoded); err != nil {
+			return err
+		}
+	}
+	pb := tx.Bucket([]byte(bucketProfiles))
+	if pb == nil {
+		return nil
+	}
+	profiles := map[string]*Profile{}
+	if err := pb.ForEach(func(k, v []byte) error {
+		old := &profileV4{}
+		if err := decodeRecord(v, old); err != nil {
+			return fmt.Errorf("unable to carry over profile %s: %s", k, err)
+		}
+		p := &Profile{Name: old.Name, CustomArgs: old.CustomArgs, Launcher: old.Launcher}
+		if old.Experimental != nil {
+			p.Experimental = old.Experimental.upgrade()
+		}
+		profiles[string(k)] = p
+		return nil
+	}); err != nil {
+		return err
+	}
+	for k, p := range profiles {
+		encoded, err := p.encode()
+		if err != nil {
+			return err
+		}
+		if err = pb.Put([]byte(k), encoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *experimentalSettingsV4) upgrade() *QCExperimentalSettings {
+	exp := &QCExperimentalSettings{Options: map[string]string{}}
+	if s.UseMaxFPSLimit && s.MaxFPSLimit != 0 {
+		exp.Options["maxfps"] = strconv.Itoa(s.MaxFPSLimit)
+	}
+	if s.UseMaxFPSLimitMinimized && s.MaxFPSLimitMinimized != 0 {
+		exp.Options["maxfpsminimized"] = strconv.Itoa(s.MaxFPSLimitMinimized)
+	}
+	if s.UseFPSSmoothing {
+		exp.Options["fpssmoothing"] = "true"
+	}
+	return exp
+}
+
+// migrateSecrets moves the encrypted username, password and token into the data file's secret store. They
+// stay encrypted with the same credential key, so the move works while the data file is locked.
+func migrateSecrets(tx DataTx) error {
+	b := tx.Bucket([]byte(bucketSettings))
+	sb, err := tx.CreateBucketIfNotExists([]byte(bucketSecrets))
+	if err != nil {
+		return err
+	}
+	moved := map[string]string{}
+	if data := b.Get([]byte(keyQCCoreSettings)); data != nil {
+		core := &QCCoreSettings{}
+		if err = decodeRecord(data, core); err != nil {
+			return fmt.Errorf("unable to carry over core settings: %s", err)
+		}
+		moved[secretUsername], moved[secretPassword] = core.Username, core.Password
+		core.Username, core.Password = "", ""
+		core.SecretStore = SecretStoreDataFile
+		encoded, err := encodeRecord(core)
+		if err != nil {
+			return err
+		}
+		if err = b.Put([]byte(keyQCCoreSettings), encoded); err != nil {
+			return err
+		}
+	}
+	if data := b.Get([]byte(keyTokenAuth)); data != nil {
+		t := &TokenAuth{}
+		if err = decodeRecord(data, t); err != nil {
+			return fmt.Errorf("unable to carry over the auth token: %s", err)
+		}
+		moved[secretToken] = t.Token
+		if err = b.Delete([]byte(keyTokenAuth)); err != nil {
+			return err
+		}
+	}
+	for name, enc := range moved {
+		if enc == "" {
+			continue
+		}
+		if err = sb.Put([]byte(name), []byte(enc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
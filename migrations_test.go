@@ -0,0 +1,396 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "go.uber.org/zap"
+)
+
+// sealedMemoryBackend is the memory backend with integrity checks, like the bolt backend.
+type sealedMemoryBackend struct {
+	memoryBackend
+}
+
+// legacyCoreSettings has a field that QCCoreSettings no longer has, like the layouts before version 4.
+type legacyCoreSettings struct {
+	Username   string
+	Password   string
+	FilePath   string
+	LaunchMode int
+}
+
+func (b *sealedMemoryBackend) sealed() bool {
+	return true
+}
+
+// useNopLogger discards the log, for tests that run code which logs.
+func useNopLogger() {
+	if logger == nil {
+		logger = &qlogger{log.NewNop().Sugar()}
+	}
+}
+
+// useBackend makes b the active backend, with nothing saved in memory, for the length of the test.
+func useBackend(t *testing.T, b storeBackend) {
+	t.Helper()
+	useNopLogger()
+	prev := activeStore
+	activeStore = b
+	memoryTree = nil
+	t.Cleanup(func() {
+		activeStore = prev
+		memoryTree = nil
+	})
+}
+
+// useMemoryStore makes b (the memory backend if nil) the active store and returns it empty.
+func useMemoryStore(t *testing.T, b storeBackend) *LauncherStore {
+	t.Helper()
+	if b == nil {
+		b = storeBackends[StoreMemory]
+	}
+	useBackend(t, b)
+	return &LauncherStore{DataStore: &memoryStore{}}
+}
+
+// putRaw stores v, encoded unless it is a []byte, bypassing the integrity checks.
+func putRaw(t *testing.T, bucket, key string, v interface{}) {
+	t.Helper()
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = encodeRecord(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := (&memoryStore{}).Update(func(tx DataTx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getRaw(t *testing.T, bucket, key string, v interface{}) bool {
+	t.Helper()
+	var data []byte
+	(&memoryStore{}).View(func(tx DataTx) error {
+		if b := tx.Bucket([]byte(bucket)); b != nil {
+			data = append([]byte(nil), b.Get([]byte(key))...)
+		}
+		return nil
+	})
+	if len(data) == 0 {
+		return false
+	}
+	if err := decodeRecord(data, v); err != nil {
+		t.Fatalf("%s/%s: %s", bucket, key, err)
+	}
+	return true
+}
+
+func snapshot(t *testing.T, ls *LauncherStore) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := ls.Snapshot(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPendingMigrations(t *testing.T) {
+	all := pendingMigrations(0)
+	if len(all) != len(migrations) {
+		t.Fatalf("expected every step from version 0, got %d of %d", len(all), len(migrations))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].to <= all[i-1].to {
+			t.Errorf("step to version %d runs after the step to version %d", all[i].to, all[i-1].to)
+		}
+	}
+	if last := all[len(all)-1].to; last != dataFileVersion {
+		t.Errorf("the last step migrates to version %d, expected %d", last, dataFileVersion)
+	}
+	if p := pendingMigrations(dataFileVersion); len(p) != 0 {
+		t.Errorf("expected no steps for a current file, got %d", len(p))
+	}
+	if p := pendingMigrations(5); len(p) != 5 || p[0].to != 6 {
+		t.Errorf("expected the steps to versions 6 to 10 from version 5, got %d steps", len(p))
+	}
+}
+
+func TestMigrateLegacySettings(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	putRaw(t, bucketSettings, keyQCCoreSettings, &legacyCoreSettings{Username: "u", Password: "p", FilePath: `C:\qc.exe`,
+		LaunchMode: 2})
+	putRaw(t, bucketSettings, keyLauncherSettings, &LauncherSettings{AutoStartQC: true})
+	if err := ls.Update(migrateLegacySettings); err != nil {
+		t.Fatal(err)
+	}
+	core := &QCCoreSettings{}
+	if !getRaw(t, bucketSettings, keyQCCoreSettings, core) {
+		t.Fatal("core settings were not carried over")
+	}
+	if core.Username != "u" || core.Password != "p" || core.FilePath != `C:\qc.exe` {
+		t.Errorf("core settings changed: %+v", core)
+	}
+	lch := &LauncherSettings{}
+	if !getRaw(t, bucketSettings, keyLauncherSettings, lch) || !lch.AutoStartQC {
+		t.Errorf("launcher settings were not carried over: %+v", lch)
+	}
+	ls.View(func(tx DataTx) error {
+		for _, name := range []string{bucketSettings, bucketLastUpdate, bucketServerStatus} {
+			if tx.Bucket([]byte(name)) == nil {
+				t.Errorf("bucket %s was not created", name)
+			}
+		}
+		return nil
+	})
+}
+
+func TestMigrateLegacySettingsUndecodable(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	putRaw(t, bucketSettings, keyQCCoreSettings, []byte("not a record"))
+	err := ls.Update(migrateLegacySettings)
+	if err == nil || !strings.Contains(err.Error(), keyQCCoreSettings) {
+		t.Fatalf("expected the migration to fail on the core settings, got %v", err)
+	}
+}
+
+func TestMigrateExperimentalOptions(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	putRaw(t, bucketSettings, keyQCExperimentalSettings, &experimentalSettingsV4{UseMaxFPSLimit: true, MaxFPSLimit: 250,
+		UseFPSSmoothing: true})
+	putRaw(t, bucketProfiles, "duel", &profileV4{Name: "Duel", CustomArgs: "+set r_fov 110",
+		Experimental: &experimentalSettingsV4{UseMaxFPSLimitMinimized: true, MaxFPSLimitMinimized: 30}})
+	putRaw(t, bucketProfiles, "plain", &profileV4{Name: "Plain"})
+	if err := ls.Update(migrateExperimentalOptions); err != nil {
+		t.Fatal(err)
+	}
+	exp := &QCExperimentalSettings{}
+	if !getRaw(t, bucketSettings, keyQCExperimentalSettings, exp) {
+		t.Fatal("experimental settings were not carried over")
+	}
+	if exp.Options["maxfps"] != "250" || exp.Options["fpssmoothing"] != "true" || len(exp.Options) != 2 {
+		t.Errorf("unexpected options: %v", exp.Options)
+	}
+	duel := &Profile{}
+	if !getRaw(t, bucketProfiles, "duel", duel) {
+		t.Fatal("profile was not carried over")
+	}
+	if duel.Name != "Duel" || duel.CustomArgs != "+set r_fov 110" || duel.Experimental == nil ||
+		duel.Experimental.Options["maxfpsminimized"] != "30" {
+		t.Errorf("unexpected profile: %+v", duel)
+	}
+	plain := &Profile{}
+	if !getRaw(t, bucketProfiles, "plain", plain) || plain.Experimental != nil {
+		t.Errorf("unexpected profile: %+v", plain)
+	}
+}
+
+func TestMigrateExperimentalOptionsUndecodable(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	putRaw(t, bucketSettings, keyQCExperimentalSettings, &experimentalSettingsV4{})
+	putRaw(t, bucketProfiles, "broken", []byte("not a record"))
+	if err := ls.Update(migrateExperimentalOptions); err == nil {
+		t.Fatal("expected the migration to fail on the profile")
+	}
+}
+
+func TestMigrateSecrets(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	putRaw(t, bucketSettings, keyQCCoreSettings, &QCCoreSettings{Username: "enc-user", Password: "enc-pass", FP: "fp"})
+	putRaw(t, bucketSettings, keyTokenAuth, &TokenAuth{Token: "enc-token"})
+	if err := ls.Update(migrateSecrets); err != nil {
+		t.Fatal(err)
+	}
+	core := &QCCoreSettings{}
+	if !getRaw(t, bucketSettings, keyQCCoreSettings, core) {
+		t.Fatal("core settings were removed")
+	}
+	if core.Username != "" || core.Password != "" || core.FP != "fp" || core.SecretStore != SecretStoreDataFile {
+		t.Errorf("unexpected core settings: %+v", core)
+	}
+	if getRaw(t, bucketSettings, keyTokenAuth, &TokenAuth{}) {
+		t.Error("the old auth token record was kept")
+	}
+	ls.View(func(tx DataTx) error {
+		sb := tx.Bucket([]byte(bucketSecrets))
+		if sb == nil {
+			t.Fatal("secret bucket was not created")
+		}
+		for name, want := range map[string]string{secretUsername: "enc-user", secretPassword: "enc-pass", secretToken: "enc-token"} {
+			if got := string(sb.Get([]byte(name))); got != want {
+				t.Errorf("secret %s: expected %q, got %q", name, want, got)
+			}
+		}
+		return nil
+	})
+}
+
+func TestMigrateSecretsUndecodable(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	putRaw(t, bucketSettings, keyQCCoreSettings, []byte("not a record"))
+	if err := ls.Update(migrateSecrets); err == nil {
+		t.Fatal("expected the migration to fail on the core settings")
+	}
+}
+
+func TestSealDataFile(t *testing.T) {
+	ls := useMemoryStore(t, &sealedMemoryBackend{})
+	putRaw(t, bucketSettings, keyLauncherSettings, &LauncherSettings{ExitOnLaunch: true})
+	putRaw(t, bucketProfiles, "duel", &Profile{Name: "Duel"})
+	putRaw(t, bucketRemote, signedResponses[rrUpdateQC], &signedPayload{Data: []byte("{}")})
+	putRaw(t, bucketLastUpdate, keyDfVer, []byte{byte(dataFileVersion), 0, 0, 0, 0, 0, 0, 0})
+	if err := ls.Update(sealDataFile); err != nil {
+		t.Fatal(err)
+	}
+	bad, err := verifyDataFile(ls.DataStore)
+	if err != nil || len(bad) != 0 {
+		t.Fatalf("sealed file failed the integrity check: %v %v", bad, err)
+	}
+	lch := &LauncherSettings{}
+	if err = ls.View(func(tx DataTx) error {
+		return decodeRecord(tx.Bucket([]byte(bucketSettings)).Get([]byte(keyLauncherSettings)), lch)
+	}); err != nil || !lch.ExitOnLaunch {
+		t.Errorf("sealed record did not read back: %+v %v", lch, err)
+	}
+	putRaw(t, bucketProfiles, "duel", &Profile{Name: "Edited"})
+	if bad, _ = verifyDataFile(ls.DataStore); len(bad) != 1 {
+		t.Errorf("expected the edited record to fail the integrity check, got %v", bad)
+	}
+}
+
+func TestSealRemoteResponses(t *testing.T) {
+	ls := useMemoryStore(t, &sealedMemoryBackend{})
+	// a file sealed by version 8, which left the cached documents out
+	putRaw(t, bucketRemote, signedResponses[rrUpdateQC], &signedPayload{Data: []byte("{}")})
+	putRaw(t, bucketLastUpdate, keyDfVer, []byte{8, 0, 0, 0, 0, 0, 0, 0})
+	if err := ls.Update(sealDataFile); err != nil {
+		t.Fatal(err)
+	}
+	putRaw(t, bucketRemote, signedResponses[rrUpdateQC], &signedPayload{Data: []byte("{}")})
+	if err := ls.Update(func(tx DataTx) error {
+		return tx.Bucket([]byte(bucketRemote)).Put([]byte(signedResponses[rrUpdateLauncher]), []byte("sealed by version 8"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.View(func(tx DataTx) error {
+		tx.Bucket([]byte(bucketRemote)).Get([]byte(signedResponses[rrUpdateQC]))
+		return nil
+	}); !IsErrCorrupted(err) {
+		t.Fatalf("expected the unsealed document to fail the integrity check, got %v", err)
+	}
+	if _, err := ls.migrate(8); err != nil {
+		t.Fatal(err)
+	}
+	if bad, err := verifyDataFile(ls.DataStore); err != nil || len(bad) != 0 {
+		t.Fatalf("migrated file failed the integrity check: %v %v", bad, err)
+	}
+	if err := ls.View(func(tx DataTx) error {
+		b := tx.Bucket([]byte(bucketRemote))
+		if v := b.Get([]byte(signedResponses[rrUpdateLauncher])); string(v) != "sealed by version 8" {
+			t.Errorf("a sealed document changed: %q", v)
+		}
+		return decodeRecord(b.Get([]byte(signedResponses[rrUpdateQC])), &signedPayload{})
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProtectIntegrityKey(t *testing.T) {
+	ls := useMemoryStore(t, &sealedMemoryBackend{})
+	// a file sealed by version 9, which kept the key as-is
+	key := make([]byte, integrityKeySize)
+	putRaw(t, bucketIntegrity, keyIntegrity, key)
+	putRaw(t, bucketLastUpdate, keyDfVer, []byte{9, 0, 0, 0, 0, 0, 0, 0})
+	if err := ls.Update(func(tx DataTx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(keyLauncherSettings), []byte("sealed by version 9"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls.migrate(9); err != nil {
+		t.Fatal(err)
+	}
+	if bad, err := verifyDataFile(ls.DataStore); err != nil || len(bad) != 0 {
+		t.Fatalf("migrated file failed the integrity check: %v %v", bad, err)
+	}
+	if err := ls.View(func(tx DataTx) error {
+		if v := tx.Bucket([]byte(bucketSettings)).Get([]byte(keyLauncherSettings)); string(v) != "sealed by version 9" {
+			t.Errorf("a sealed record changed: %q", v)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// a key put in the file by another program does not match the records
+	other := make([]byte, integrityKeySize)
+	other[0] = 1
+	putRaw(t, bucketIntegrity, keyIntegrity, other)
+	if bad, _ := verifyDataFile(ls.DataStore); len(bad) == 0 {
+		t.Error("expected a replaced key to fail the integrity check")
+	}
+	if err := ls.View(func(tx DataTx) error {
+		tx.Bucket([]byte(bucketSettings)).Get([]byte(keyLauncherSettings))
+		return nil
+	}); !IsErrCorrupted(err) {
+		t.Errorf("expected a replaced key to fail reads, got %v", err)
+	}
+}
+
+func TestSealDataFileUnsealedBackend(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	putRaw(t, bucketSettings, keyLauncherSettings, &LauncherSettings{})
+	before := snapshot(t, ls)
+	if err := ls.Update(sealDataFile); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, snapshot(t, ls)) {
+		t.Error("a backend without integrity checks was sealed")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ls := useMemoryStore(t, &sealedMemoryBackend{})
+	putRaw(t, bucketSettings, keyQCCoreSettings, &legacyCoreSettings{Username: "enc-user", Password: "enc-pass"})
+	putRaw(t, bucketSettings, keyQCExperimentalSettings, &experimentalSettingsV4{UseFPSSmoothing: true})
+	if _, err := ls.migrate(0); err != nil {
+		t.Fatal(err)
+	}
+	var version int64
+	ls.View(func(tx DataTx) error {
+		version = readDataFileVersion(tx)
+		return nil
+	})
+	if version != dataFileVersion {
+		t.Errorf("expected version %d after migrating, got %d", dataFileVersion, version)
+	}
+	if bad, err := verifyDataFile(ls.DataStore); err != nil || len(bad) != 0 {
+		t.Errorf("migrated file failed the integrity check: %v %v", bad, err)
+	}
+}
+
+func TestMigrateFailureLeavesStoreUnchanged(t *testing.T) {
+	ls := useMemoryStore(t, &sealedMemoryBackend{})
+	putRaw(t, bucketSettings, keyQCCoreSettings, &legacyCoreSettings{Username: "enc-user", Password: "enc-pass"})
+	putRaw(t, bucketProfiles, "broken", []byte("not a record"))
+	before := snapshot(t, ls)
+	if _, err := ls.migrate(0); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	if !bytes.Equal(before, snapshot(t, ls)) {
+		t.Error("a failed migration changed the store")
+	}
+}
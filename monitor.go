@@ -0,0 +1,255 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	serverStatusUp          = "UP"
+	serverStatusDown        = "DOWN"
+	serverStatusMaintenance = "MAINTENANCE"
+	serverStatusUnknown     = "UNKNOWN"
+	maxServerStatusRecords  = 200
+)
+
+type ServerStatusRecord struct {
+	Time    time.Time
+	Status  string
+	Message string
+}
+
+type ServerOutage struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"` // zero if the outage is ongoing
+	Ongoing bool      `json:"ongoing"`
+	Status  string    `json:"status"`
+	Message string    `json:"message"`
+}
+
+type serverStatusMonitor struct {
+	interval  time.Duration
+	last      *ServerStatusRecord
+	published bool // the first poll is always shown, even if history already has its status
+	onChange  func(prev, cur *ServerStatusRecord)
+	stop      chan struct{}
+}
+
+func newServerStatusRecord(res *ServerStatusResponse, err error) *ServerStatusRecord {
+	r := &ServerStatusRecord{Time: time.Now(), Status: serverStatusUnknown}
+	if err != nil || res == nil {
+		r.Message = "Unable to retrieve QC server status"
+		return r
+	}
+	r.Message = res.Platform.Message
+	q := strings.ToUpper(strings.TrimSpace(res.Platform.Response.Quake))
+	switch {
+	case q == serverStatusUp:
+		r.Status = serverStatusUp
+	case q == serverStatusDown:
+		r.Status = serverStatusDown
+	case strings.Contains(q, "MAINT"):
+		r.Status = serverStatusMaintenance
+	case q != "":
+		r.Status = q
+	}
+	return r
+}
+
+func (r *ServerStatusRecord) String() string {
+	if r == nil {
+		return "checking..."
+	}
+	return r.Status
+}
+
+func newServerStatusMonitor(intervalSecs int64, onChange func(prev, cur *ServerStatusRecord)) *serverStatusMonitor {
+	return &serverStatusMonitor{
+		interval: time.Duration(intervalSecs) * time.Second,
+		onChange: onChange,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (m *serverStatusMonitor) start() {
+	if m.interval <= 0 {
+		logger.Debug("server status monitor disabled (interval is 0)")
+		return
+	}
+	history, err := GetServerStatusHistory()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading server status history", GetCaller()), "error", err)
+	} else if len(history) != 0 {
+		m.last = &history[len(history)-1]
+	}
+	go func() {
+		m.poll()
+		t := time.NewTicker(m.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				m.poll()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (m *serverStatusMonitor) poll() {
+	res, err := newLauncherClient(defTimeout).getServerStatus()
+	cur := newServerStatusRecord(res, err)
+	prev := m.last
+	m.last = cur
+	changed := prev == nil || prev.Status != cur.Status
+	if changed {
+		if err := recordServerStatus(cur); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error recording server status transition", GetCaller()), "error", err)
+		}
+	}
+	if !m.published {
+		// prev may come from history, so the initial poll is published as one without a previous status
+		m.published = true
+		prev, changed = nil, true
+	}
+	if changed && m.onChange != nil {
+		m.onChange(prev, cur)
+	}
+}
+
+func (m *serverStatusMonitor) shutdown() {
+	if m == nil {
+		return
+	}
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+}
+
+func recordServerStatus(r *ServerStatusRecord) error {
+	if !DataStoreExists() {
+		return nil // nothing configured yet; history begins with the first saved configuration
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error initializing datastore", GetCaller()), "error", err)
+		return err
+	}
+	defer ls.Close()
+	return ls.addServerStatusRecord(r)
+}
+
+func GetServerStatusHistory() ([]ServerStatusRecord, error) {
+	if !DataStoreExists() {
+		return nil, nil
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error initializing datastore", GetCaller()), "error", err)
+		return nil, err
+	}
+	defer ls.Close()
+	return ls.getServerStatusHistory()
+}
+
+func GetServerOutages(history []ServerStatusRecord) []ServerOutage {
+	var outages []ServerOutage
+	var cur *ServerOutage
+	for _, r := range history {
+		if r.Status == serverStatusUnknown {
+			continue // unreachable status endpoint says nothing about the servers themselves
+		}
+		if r.Status == serverStatusUp {
+			if cur != nil {
+				cur.End = r.Time
+				outages = append(outages, *cur)
+				cur = nil
+			}
+			continue
+		}
+		if cur != nil && cur.Status == r.Status {
+			continue
+		}
+		if cur != nil {
+			cur.End = r.Time
+			outages = append(outages, *cur)
+		}
+		cur = &ServerOutage{Start: r.Time, Status: r.Status, Message: r.Message}
+	}
+	if cur != nil {
+		cur.Ongoing = true
+		outages = append(outages, *cur)
+	}
+	return outages
+}
+
+func (ls *LauncherStore) addServerStatusRecord(r *ServerStatusRecord) error {
+	data, err := encodeRecord(r)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error encoding server status record", GetCaller()), "error", err)
+		return err
+	}
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(r.Time.UnixNano())) // big endian so the cursor iterates chronologically
+	return ls.Update(func(tx DataTx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketServerStatus))
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error creating server status bucket", GetCaller()), "error", err)
+			return err
+		}
+		if _, lv := b.Cursor().Last(); lv != nil {
+			var last ServerStatusRecord
+			if decodeRecord(lv, &last) == nil && last.Status == r.Status {
+				return nil // only transitions are recorded
+			}
+		}
+		if err = b.Put(k, data); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error saving server status record to datastore", GetCaller()), "error", err)
+			return err
+		}
+		var keys [][]byte
+		c := b.Cursor()
+		for ck, _ := c.First(); ck != nil; ck, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), ck...))
+		}
+		for i := 0; i < len(keys)-maxServerStatusRecords; i++ {
+			if err = b.Delete(keys[i]); err != nil {
+				logger.Errorw(fmt.Sprintf("%s: error pruning server status records", GetCaller()), "error", err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (ls *LauncherStore) getServerStatusHistory() ([]ServerStatusRecord, error) {
+	var history []ServerStatusRecord
+	err := ls.View(func(tx DataTx) error {
+		b := tx.Bucket([]byte(bucketServerStatus))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var r ServerStatusRecord
+			if err := decodeRecord(v, &r); err != nil {
+				logger.Errorw(fmt.Sprintf("%s: error decoding server status record", GetCaller()), "error", err)
+				return nil // skip
+			}
+			history = append(history, r)
+			return nil
+		})
+	})
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error getting server status history from datastore", GetCaller()), "error", err)
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,318 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	OptionsCatalogFile       = "qcoptions.json"
+	OptionsCatalogUpdateFile = "qcoptions.update.json"
+	maxOptionsCatalogBytes   = 1 << 20
+	optionTypeBool           = "bool"
+	optionTypeInt            = "int"
+	optionTypeFloat          = "float"
+	optionTypeEnum           = "enum"
+	optionTypeString         = "string"
+	optionMaxFPS             = "maxfps" // also set by -maxfps
+)
+
+// QCOption describes a QC console variable that can be set at launch with --set <path> <value>.
+type QCOption struct {
+	ID          string   `json:"id"`
+	Path        string   `json:"path"`
+	Type        string   `json:"type"`
+	Label       string   `json:"label"`
+	Description string   `json:"description,omitempty"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Values      []string `json:"values,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Suffix      string   `json:"suffix,omitempty"`
+	Removed     bool     `json:"removed,omitempty"` // known to have been removed from the game; never sent to QC
+}
+
+// OptionsCatalog is the list of QC options shown on the experimental tab. The copy built into QCLauncher
+// is replaced by a newer signed catalog from qc.syncore.org, and by qcoptions.json next to the exe when
+// that file has the same or a higher version.
+type OptionsCatalog struct {
+	Version int         `json:"version"`
+	Options []*QCOption `json:"options"`
+	source  string
+}
+
+// Update embeddedOptionsCatalog's version whenever it changes so that older qcoptions.json files are ignored.
+const embeddedOptionsCatalog = `{
+  "version": 1,
+  "options": [
+    {
+      "id": "maxfps",
+      "path": "/Config/CONFIG/maxFpsValue",
+      "type": "int",
+      "label": "Set Max FPS Limit",
+      "description": "Limit or 'cap' the maximum FPS during the game",
+      "min": 1,
+      "max": 2000,
+      "default": "144",
+      "suffix": " FPS"
+    },
+    {
+      "id": "maxfpsminimized",
+      "path": "/Config/CONFIG/maxFpsValueMinimized",
+      "type": "int",
+      "label": "Set Max FPS Limit (when QC is minimized)",
+      "description": "Limit or 'cap' the maximum FPS when QC is minimized",
+      "min": 1,
+      "max": 2000,
+      "default": "30",
+      "suffix": " FPS"
+    },
+    {
+      "id": "fpssmoothing",
+      "path": "/Config/CONFIG/enableFpsSmooth",
+      "type": "bool",
+      "label": "Use FPS smoothing",
+      "description": "Use FPS smoothing (may have no effect)",
+      "default": "true"
+    }
+  ]
+}`
+
+var (
+	optionsCatalog     *OptionsCatalog
+	optionsCatalogOnce sync.Once
+)
+
+func getOptionsCatalog() *OptionsCatalog {
+	optionsCatalogOnce.Do(func() {
+		var problems []string
+		optionsCatalog, problems = loadOptionsCatalog(getOptionsCatalogFilePath(), getOptionsCatalogUpdateFilePath())
+		// also reached before the logger exists (see LoadLayeredConfig), so keep them for the doctor as well
+		configProblems = append(configProblems, problems...)
+		if logger != nil {
+			for _, p := range problems {
+				logger.Warnw("ignoring QC options catalog", "problem", p)
+			}
+		}
+	})
+	return optionsCatalog
+}
+
+// loadOptionsCatalog always returns a usable catalog: the newest of the built-in catalog and the signed
+// catalog downloaded to updatePath, unless the catalog at userPath is at least as new.
+func loadOptionsCatalog(userPath, updatePath string) (*OptionsCatalog, []string) {
+	c, err := parseOptionsCatalog([]byte(embeddedOptionsCatalog))
+	if err != nil {
+		panic(fmt.Errorf("Built-in QC options catalog is invalid: %s", err))
+	}
+	c.source = "built-in"
+	var problems []string
+	if FileExists(updatePath) {
+		update, err := readOptionsCatalogFile(updatePath, true)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", filepath.Base(updatePath), err))
+		} else if update.Version > c.Version {
+			c = update
+		}
+	}
+	if FileExists(userPath) {
+		user, err := readOptionsCatalogFile(userPath, false)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", filepath.Base(userPath), err))
+		} else if user.Version < c.Version {
+			problems = append(problems, fmt.Sprintf("%s: version %d is older than the %s version %d",
+				filepath.Base(userPath), user.Version, c.source, c.Version))
+		} else {
+			c = user
+		}
+	}
+	return c, problems
+}
+
+// readOptionsCatalogFile reads a catalog file, which must have a valid detached signature if signed is true.
+func readOptionsCatalogFile(p string, signed bool) (*OptionsCatalog, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	source := p
+	if signed {
+		sig, err := ioutil.ReadFile(p + SignatureExt)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = verifySignature(data, sig); err != nil {
+			return nil, err
+		}
+		source = "downloaded"
+	}
+	c, err := parseOptionsCatalog(data)
+	if err != nil {
+		return nil, err
+	}
+	c.source = source
+	return c, nil
+}
+
+// updateOptionsCatalog downloads the signed QC options catalog, which is used from the next start.
+func (lc *launcherClient) updateOptionsCatalog() {
+	res, err := lc.Get(optionsCatalogEndpoint)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error requesting QC options catalog", GetCaller()), "error", err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		logger.Errorw(fmt.Sprintf("%s: got non-OK status code for QC options catalog", GetCaller()), "statusCode", res.StatusCode)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxOptionsCatalogBytes))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading QC options catalog", GetCaller()), "error", err)
+		return
+	}
+	sig, err := lc.verifyRemote(optionsCatalogEndpoint, data)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: rejected QC options catalog with missing or invalid signature", GetCaller()), "error", err)
+		return
+	}
+	c, err := parseOptionsCatalog(data)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: downloaded QC options catalog is invalid", GetCaller()), "error", err)
+		return
+	}
+	p := getOptionsCatalogUpdateFilePath()
+	if FileExists(p) {
+		if current, err := readOptionsCatalogFile(p, true); err == nil && current.Version >= c.Version {
+			return // never go back to an older catalog, even a signed one
+		}
+	}
+	if err = ioutil.WriteFile(p, data, 0644); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving QC options catalog", GetCaller()), "error", err)
+		return
+	}
+	if err = ioutil.WriteFile(p+SignatureExt, []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0644); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving QC options catalog signature", GetCaller()), "error", err)
+		return
+	}
+	logger.Infow("downloaded QC options catalog", "version", c.Version)
+}
+
+func parseOptionsCatalog(data []byte) (*OptionsCatalog, error) {
+	c := &OptionsCatalog{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, o := range c.Options {
+		if o.ID == "" || strings.Trim(o.ID, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+			return nil, fmt.Errorf("option ids must be lowercase letters and numbers: %q", o.ID)
+		}
+		if seen[o.ID] {
+			return nil, fmt.Errorf("duplicate option id: %s", o.ID)
+		}
+		seen[o.ID] = true
+		if !strings.HasPrefix(o.Path, "/") || strings.ContainsAny(o.Path, " \t\"") {
+			return nil, fmt.Errorf("%s: invalid path: %q", o.ID, o.Path)
+		}
+		switch o.Type {
+		case optionTypeBool, optionTypeInt, optionTypeFloat, optionTypeString:
+		case optionTypeEnum:
+			if len(o.Values) == 0 {
+				return nil, fmt.Errorf("%s: enum options need values", o.ID)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unknown type: %s", o.ID, o.Type)
+		}
+		if o.Label == "" {
+			o.Label = o.Path
+		}
+		if o.Default != "" {
+			if err := o.validate(o.Default); err != nil {
+				return nil, fmt.Errorf("%s: invalid default: %s", o.ID, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+func (c *OptionsCatalog) find(id string) *QCOption {
+	for _, o := range c.Options {
+		if o.ID == id {
+			return o
+		}
+	}
+	return nil
+}
+
+func (o *QCOption) validate(v string) error {
+	switch o.Type {
+	case optionTypeBool:
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("Expected true or false, got: %s", v)
+		}
+	case optionTypeInt, optionTypeFloat:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("Expected a number, got: %s", v)
+		}
+		if o.Type == optionTypeInt && f != math.Trunc(f) {
+			return fmt.Errorf("Expected a whole number, got: %s", v)
+		}
+		if (o.Min != nil && f < *o.Min) || (o.Max != nil && f > *o.Max) {
+			return fmt.Errorf("Expected a number between %s and %s, got: %s", o.formatBound(o.Min), o.formatBound(o.Max), v)
+		}
+	case optionTypeEnum:
+		for _, e := range o.Values {
+			if e == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("Expected one of %s, got: %s", strings.Join(o.Values, ", "), v)
+	case optionTypeString:
+		if v == "" || strings.ContainsAny(v, " \t\"") {
+			return errors.New("Expected a value without spaces or quotes")
+		}
+	}
+	return nil
+}
+
+func (o *QCOption) formatBound(b *float64) string {
+	if b == nil {
+		return "any"
+	}
+	return strconv.FormatFloat(*b, 'f', -1, 64)
+}
+
+// arg returns the launch argument for the option set to v.
+func (o *QCOption) arg(v string) string {
+	if o.Type == optionTypeBool {
+		if b, _ := strconv.ParseBool(v); b {
+			v = "1"
+		} else {
+			v = "0"
+		}
+	}
+	return fmt.Sprintf("--set %s %s", o.Path, v)
+}
+
+func getOptionsCatalogFilePath() string {
+	return filepath.Join(getExecutingPath(), OptionsCatalogFile)
+}
+
+func getOptionsCatalogUpdateFilePath() string {
+	return filepath.Join(getExecutingPath(), OptionsCatalogUpdateFile)
+}
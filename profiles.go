@@ -0,0 +1,354 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultProfile     = "default"
+	maxProfileNameLen  = 32
+	profileNameAllowed = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 _-"
+)
+
+// Profile holds the settings that can differ between setups. The default profile's experimental and
+// launcher settings are the ones stored in the settings bucket, so its Experimental and Launcher are nil.
+type Profile struct {
+	Name         string
+	CustomArgs   string
+	Experimental *QCExperimentalSettings
+	Launcher     *LauncherSettings // nil uses the default profile's launcher settings
+}
+
+// ProfileList is the stored list of profile names and the profile selected from the UI or command line.
+type ProfileList struct {
+	Names  []string
+	Active string
+}
+
+var errProfileNotFound = errors.New("profile not found")
+
+func (p *Profile) isDefault() bool {
+	return strings.EqualFold(p.Name, DefaultProfile)
+}
+
+func (p *Profile) get(ls *LauncherStore) error {
+	ls.checkDataFile(false)
+	return ls.View(p.read)
+}
+
+func (p *Profile) read(tx DataTx) error {
+	b := tx.Bucket([]byte(bucketProfiles))
+	data := b.Get([]byte(profileKey(p.Name)))
+	if data == nil {
+		if p.isDefault() {
+			return nil // nothing saved for the default profile yet
+		}
+		return errProfileNotFound
+	}
+	if err := p.decode(data); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding profile from datastore during get operation", GetCaller()),
+			"profile", p.Name, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (p *Profile) save(ls *LauncherStore) error {
+	return ls.Update(p.write)
+}
+
+func (p *Profile) write(tx DataTx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketProfiles))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating profiles bucket in datastore during save operation", GetCaller()),
+			"error", err)
+		return err
+	}
+	encoded, err := p.encode()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error encoding profile during datastore save operation", GetCaller()), "error", err)
+		return err
+	}
+	if err = b.Put([]byte(profileKey(p.Name)), encoded); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving encoded profile to datastore", GetCaller()), "error", err)
+		return err
+	}
+	return nil
+}
+
+func (p *Profile) decode(data []byte) error {
+	if err := decodeRecord(data, &p); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding profile data", GetCaller()), "error", err)
+		return err
+	}
+	return nil
+}
+
+func (p *Profile) encode() ([]byte, error) {
+	data, err := encodeRecord(p)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error encoding profile data", GetCaller()), "error", err)
+		return nil, err
+	}
+	return data, nil
+}
+
+func (l *ProfileList) get(ls *LauncherStore) error {
+	ls.checkDataFile(false)
+	return ls.View(l.read)
+}
+
+func (l *ProfileList) read(tx DataTx) error {
+	l.Names = []string{DefaultProfile}
+	l.Active = DefaultProfile
+	if err := tx.Bucket([]byte(bucketProfiles)).ForEach(func(k, v []byte) error {
+		p := &Profile{}
+		if err := p.decode(v); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: skipping unreadable profile", GetCaller()), "profile", string(k), "error", err)
+			return nil
+		}
+		if !p.isDefault() {
+			l.Names = append(l.Names, p.Name)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	rest := l.Names[1:]
+	sort.Slice(rest, func(i, j int) bool { return strings.ToLower(rest[i]) < strings.ToLower(rest[j]) })
+	if active := tx.Bucket([]byte(bucketSettings)).Get([]byte(keyActiveProfile)); len(active) != 0 {
+		l.Active = l.find(string(active))
+	}
+	return nil
+}
+
+func (l *ProfileList) save(ls *LauncherStore) error {
+	return ls.Update(l.write)
+}
+
+func (l *ProfileList) write(tx DataTx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating settings bucket in datastore during save operation", GetCaller()),
+			"error", err)
+		return err
+	}
+	if err = b.Put([]byte(keyActiveProfile), []byte(profileKey(l.Active))); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving active profile to datastore", GetCaller()), "error", err)
+		return err
+	}
+	return nil
+}
+
+// find returns the name of the profile as it was created, or the default profile if there is no such profile.
+func (l *ProfileList) find(name string) string {
+	for _, n := range l.Names {
+		if strings.EqualFold(n, name) {
+			return n
+		}
+	}
+	return DefaultProfile
+}
+
+func (l *ProfileList) has(name string) bool {
+	for _, n := range l.Names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProfiles returns every profile name, default first, and the profile in use by this process.
+func GetProfiles() ([]string, string, error) {
+	l := &ProfileList{}
+	if err := Get(l); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error getting profile list", GetCaller()), "error", err)
+		return nil, "", err
+	}
+	if ConfProfile != "" && l.has(ConfProfile) {
+		return l.Names, l.find(ConfProfile), nil
+	}
+	return l.Names, l.Active, nil
+}
+
+// SetActiveProfile selects the profile used for future launches. It replaces a -profile given on the command line.
+func SetActiveProfile(name string) error {
+	l := &ProfileList{}
+	if err := Get(l); err != nil {
+		return err
+	}
+	if !l.has(name) {
+		return &usageError{emsg: fmt.Sprintf("Profile does not exist: %s", name)}
+	}
+	l.Active = l.find(name)
+	if err := Save(l); err != nil {
+		return err
+	}
+	ConfProfile = ""
+	logger.Infow("profile selected", "profile", l.Active)
+	return nil
+}
+
+// CreateProfile creates a profile with a copy of the settings of an existing profile.
+func CreateProfile(name, from string) error {
+	name = strings.TrimSpace(name)
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	l := &ProfileList{}
+	if err := Get(l); err != nil {
+		return err
+	}
+	if l.has(name) {
+		return &usageError{emsg: fmt.Sprintf("Profile already exists: %s", name)}
+	}
+	if !l.has(from) {
+		return &usageError{emsg: fmt.Sprintf("Profile does not exist: %s", from)}
+	}
+	src, err := getStoredProfileConfiguration(l.find(from))
+	if err != nil {
+		return err
+	}
+	p := &Profile{Name: name, CustomArgs: src.Profile.CustomArgs, Experimental: src.Experimental.copy()}
+	if src.Profile.Launcher != nil {
+		launcher := *src.Profile.Launcher
+		p.Launcher = &launcher
+	}
+	if err = Save(p); err != nil {
+		return err
+	}
+	logger.Infow("profile created", "profile", name, "from", from)
+	return nil
+}
+
+func DeleteProfile(name string) error {
+	l := &ProfileList{}
+	if err := Get(l); err != nil {
+		return err
+	}
+	if strings.EqualFold(name, DefaultProfile) {
+		return &usageError{emsg: "The default profile cannot be deleted"}
+	}
+	if !l.has(name) {
+		return &usageError{emsg: fmt.Sprintf("Profile does not exist: %s", name)}
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return err
+	}
+	defer ls.Close()
+	if err = ls.Update(func(tx DataTx) error {
+		if err := tx.Bucket([]byte(bucketProfiles)).Delete([]byte(profileKey(name))); err != nil {
+			return err
+		}
+		if strings.EqualFold(l.Active, name) {
+			return tx.Bucket([]byte(bucketSettings)).Put([]byte(keyActiveProfile), []byte(DefaultProfile))
+		}
+		return nil
+	}); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error deleting profile", GetCaller()), "profile", name, "error", err)
+		return err
+	}
+	if strings.EqualFold(ConfProfile, name) {
+		ConfProfile = ""
+	}
+	logger.Infow("profile deleted", "profile", name)
+	return nil
+}
+
+// readProfileName returns the stored name of the given profile, or of the selected profile if name is empty.
+func readProfileName(tx DataTx, name string) (string, error) {
+	l := &ProfileList{}
+	if err := l.read(tx); err != nil {
+		return "", err
+	}
+	if name == "" {
+		return l.Active, nil
+	}
+	if !l.has(name) {
+		return "", &usageError{emsg: fmt.Sprintf("Profile does not exist: %s", name)}
+	}
+	return l.find(name), nil
+}
+
+// readProfile replaces the default profile's settings in cfg with those of the named profile.
+func readProfile(tx DataTx, cfg *Configuration, name string) {
+	p := &Profile{Name: name}
+	if err := p.read(tx); err != nil {
+		// not worth failing (and resetting) the whole configuration over
+		logger.Errorw(fmt.Sprintf("%s: error getting profile, using the default profile", GetCaller()), "profile", name, "error", err)
+		p = &Profile{Name: DefaultProfile}
+	}
+	if p.isDefault() {
+		p.Name, p.Experimental, p.Launcher = DefaultProfile, nil, nil
+	} else {
+		if p.Experimental == nil {
+			p.Experimental = &QCExperimentalSettings{}
+		}
+		cfg.Experimental = p.Experimental
+		if p.Launcher != nil {
+			cfg.Launcher = p.Launcher
+		}
+	}
+	cfg.Profile = p
+}
+
+// saveProfileSettings saves the settings owned by the active profile along with the profile itself.
+func saveProfileSettings(cfg *Configuration, experimental, launcher bool) error {
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return err
+	}
+	defer ls.Close()
+	return ls.Update(func(tx DataTx) error {
+		return writeProfileSettings(tx, cfg, experimental, launcher)
+	})
+}
+
+func writeProfileSettings(tx DataTx, cfg *Configuration, experimental, launcher bool) error {
+	p := cfg.Profile
+	if p.isDefault() {
+		if experimental {
+			if err := cfg.Experimental.write(tx); err != nil {
+				return err
+			}
+		}
+		if launcher {
+			if err := cfg.Launcher.write(tx); err != nil {
+				return err
+			}
+		}
+	} else {
+		if experimental {
+			p.Experimental = cfg.Experimental
+		}
+		if launcher {
+			p.Launcher = cfg.Launcher
+		}
+	}
+	return p.write(tx)
+}
+
+func validateProfileName(name string) error {
+	if name == "" {
+		return &usageError{emsg: "A profile name must be specified"}
+	}
+	if len(name) > maxProfileNameLen {
+		return &usageError{emsg: fmt.Sprintf("Profile names can be at most %d characters", maxProfileNameLen)}
+	}
+	if strings.Trim(name, profileNameAllowed) != "" {
+		return &usageError{emsg: "Profile names can only contain letters, numbers, spaces, - and _"}
+	}
+	return nil
+}
+
+func profileKey(name string) string {
+	return strings.ToLower(name)
+}
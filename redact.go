@@ -0,0 +1,103 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	redactingEncoderName = "qcljson"
+	minLogSecretLen      = 6
+	// field or JSON key names whose values are never logged; fp must match exactly since it is so short
+	secretKeyPattern = `[A-Za-z0-9_.\-]*(?:token|password|gamecode|x-src-fp|authorization|api_key)[A-Za-z0-9_.\-]*|fp`
+)
+
+var (
+	redactPatterns = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		// "key":"value", including JSON that was escaped into another string value (e.g. a logged response body)
+		{regexp.MustCompile(`(?i)(\\*")(` + secretKeyPattern + `)(\\*"\s*:\s*)(\\*")(?:[^"\\]|\\[^"])*(\\*")`), `${1}${2}${3}${4}` + redactedValue + `${5}`},
+		// "key":["value", ...] (headers, beam tokens)
+		{regexp.MustCompile(`(?i)(\\*")(` + secretKeyPattern + `)(\\*"\s*:\s*)\[[^\]]*\]`), `${1}${2}${3}[${1}` + redactedValue + `${1}]`},
+		// Key:value and map[Key:[value]] from fmt's %v and %+v
+		{regexp.MustCompile(`(?i)\b(` + secretKeyPattern + `):(\[[^\]]*\]|[^\s,}\]"\\]+)`), `${1}:` + redactedValue},
+		// key=value in query strings and command lines
+		{regexp.MustCompile(`(?i)\b(` + secretKeyPattern + `)=([^&\s"\\]+)`), `${1}=` + redactedValue},
+		// key "value" in QC launch arguments (bethesdaGameCode)
+		{regexp.MustCompile(`(?i)\b(` + secretKeyPattern + `)(\s+)(\\*")[^"\\]*(\\*")`), `${1}${2}${3}` + redactedValue + `${4}`},
+	}
+	logSecretsMu sync.RWMutex
+	logSecrets   = map[string]bool{}
+)
+
+// redactingEncoder scrubs secrets from each fully encoded log entry, so that secrets nested inside messages,
+// reflected structs and response bodies are caught no matter which field or logger call they arrive in.
+type redactingEncoder struct {
+	zapcore.Encoder
+}
+
+func newRedactingEncoder(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+	return &redactingEncoder{zapcore.NewJSONEncoder(cfg)}, nil
+}
+
+func (e *redactingEncoder) Clone() zapcore.Encoder {
+	return &redactingEncoder{e.Encoder.Clone()}
+}
+
+func (e *redactingEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	for i, f := range fields {
+		if isSecretKey(f.Key) {
+			fields[i] = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: redactedValue}
+		}
+	}
+	buf, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return buf, err
+	}
+	line := buf.String()
+	redacted := redactLogString(line)
+	if redacted != line {
+		buf.Reset()
+		buf.AppendString(redacted)
+	}
+	return buf, nil
+}
+
+func redactLogString(s string) string {
+	for _, p := range redactPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	logSecretsMu.RLock()
+	defer logSecretsMu.RUnlock()
+	for v := range logSecrets {
+		s = strings.Replace(s, v, redactedValue, -1)
+	}
+	return s
+}
+
+var secretKeyRegexp = regexp.MustCompile(`(?i)^(?:` + secretKeyPattern + `)$`)
+
+func isSecretKey(key string) bool {
+	return secretKeyRegexp.MatchString(key)
+}
+
+// addLogSecrets registers values that must never appear in the log, wherever they show up.
+func addLogSecrets(values ...string) {
+	logSecretsMu.Lock()
+	defer logSecretsMu.Unlock()
+	for _, v := range values {
+		if len(v) < minLogSecretLen {
+			continue
+		}
+		logSecrets[v] = true
+	}
+}
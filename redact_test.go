@@ -0,0 +1,94 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var testLogSecrets = []string{
+	"tok-7f3a9c2e41",
+	"pw-hunter2-secret",
+	"gc-5b8d0e7a13",
+	"beam-1-aa4c9e",
+	"beam-2-ff01b3",
+	"fp-9e8d7c6b5a",
+	"auth-c4f2e8a1d0",
+}
+
+// newBufferLogger returns a logger that writes through the redacting encoder into a buffer.
+func newBufferLogger(t *testing.T) (*log.SugaredLogger, *bytes.Buffer) {
+	enc, err := newRedactingEncoder(log.NewProductionEncoderConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	return log.New(zapcore.NewCore(enc, zapcore.AddSync(buf), zapcore.DebugLevel)).Sugar(), buf
+}
+
+func assertNoSecrets(t *testing.T, out string) {
+	t.Helper()
+	for _, s := range testLogSecrets {
+		if strings.Contains(out, s) {
+			t.Errorf("secret %q reached the sink: %s", s, out)
+		}
+	}
+	if !strings.Contains(out, redactedValue) {
+		t.Errorf("expected %s in output: %s", redactedValue, out)
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	l, buf := newBufferLogger(t)
+	l.Infow("fields",
+		"token", "tok-7f3a9c2e41",
+		"password", "pw-hunter2-secret",
+		"gamecode", "gc-5b8d0e7a13",
+		"beam_token", []string{"beam-1-aa4c9e", "beam-2-ff01b3"},
+		"x-src-fp", "fp-9e8d7c6b5a",
+		"Authorization", "Token auth-c4f2e8a1d0")
+	assertNoSecrets(t, buf.String())
+}
+
+func TestRedactMessages(t *testing.T) {
+	messages := []string{
+		`response body: {"token":"tok-7f3a9c2e41","beam_token":["beam-1-aa4c9e","beam-2-ff01b3"]}`,
+		`request: {"username":"u","password":"pw-hunter2-secret"}`,
+		`headers: map[Authorization:[Token auth-c4f2e8a1d0] x-src-fp:[fp-9e8d7c6b5a]]`,
+		`launch args: +bethesdaGameCode "gc-5b8d0e7a13" +other 1`,
+		`query: ?token=tok-7f3a9c2e41&password=pw-hunter2-secret`,
+	}
+	for _, m := range messages {
+		l, buf := newBufferLogger(t)
+		l.Info(m)
+		assertNoSecrets(t, buf.String())
+	}
+}
+
+func TestRedactNestedJSON(t *testing.T) {
+	l, buf := newBufferLogger(t)
+	l.Errorw("error parsing response", "data", `{"token":"tok-7f3a9c2e41","gamecode":"gc-5b8d0e7a13"}`)
+	assertNoSecrets(t, buf.String())
+}
+
+func TestRedactRegisteredSecrets(t *testing.T) {
+	addLogSecrets(testLogSecrets...)
+	// the other tests must not pass only because the values are registered
+	t.Cleanup(func() {
+		logSecretsMu.Lock()
+		defer logSecretsMu.Unlock()
+		for _, s := range testLogSecrets {
+			delete(logSecrets, s)
+		}
+	})
+	l, buf := newBufferLogger(t)
+	l.Infof("free text %s %s and %s", "tok-7f3a9c2e41", "pw-hunter2-secret", "fp-9e8d7c6b5a")
+	l.Infow("unrelated key", "value", "auth-c4f2e8a1d0")
+	assertNoSecrets(t, buf.String())
+}
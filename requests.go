@@ -42,7 +42,9 @@ func (r *authRequest) build(addr string) error {
 		return err
 	}
 	r.Username = cfg.Core.Username
-	r.Password = cfg.Core.Password
+	if r.Password == "" {
+		r.Password = cfg.Core.Password
+	}
 	r.SessionID = uuid.New().String()
 	header := &requestHeaderAuth{}
 	err = header.build()
@@ -105,6 +107,29 @@ func (r *verifyRequest) needsContent() bool {
 	return true
 }
 
+// tokenCheckRequest verifies the saved token without changing anything: fp is sent instead of running the
+// fingerprint chain, and the tokens in the response are not saved.
+type tokenCheckRequest struct {
+	verifyRequest
+	fp string
+}
+
+func (r *tokenCheckRequest) build(addr string) error {
+	r.SessionID = uuid.New().String()
+	header := &requestHeaderVerify{fp: r.fp}
+	err := header.build()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error getting token check request headers", GetCaller()), "error", err)
+		return err
+	}
+	r.params = &requestParams{header: header.values, endpointAddr: addr}
+	return nil
+}
+
+func (r *tokenCheckRequest) expectedResponse() remoteResponseType {
+	return rrTokenCheck
+}
+
 type entitlementInfoRequest struct {
 	EntitlementIDs []int `json:"entitlement_ids"`
 	params         *requestParams
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -24,6 +25,7 @@ const (
 	rrUpdateLauncher
 	rrEntitlementInfo
 	rrEntitlementCheckAPI
+	rrTokenCheck
 )
 
 type remoteResponse interface {
@@ -32,8 +34,9 @@ type remoteResponse interface {
 }
 
 type remoteResponseData struct {
-	ResponseType remoteResponseType
-	Data         json.RawMessage
+	ResponseType  remoteResponseType
+	Data          json.RawMessage
+	LastKnownGood bool // a stored copy was used because the response's signature was rejected
 }
 
 type Project struct {
@@ -109,6 +112,7 @@ type AuthResponse struct {
 	BeamToken             []string    `json:"beam_token"`
 	EntitlementIDs        []int       `json:"entitlement_ids"`
 	isPreSaveVerification bool        // custom flag for internal launcher use
+	isTokenCheck          bool        // verified for diagnostics only; nothing is saved
 }
 
 type BuildInfoResponse struct {
@@ -172,6 +176,13 @@ type GameCodeResponse struct {
 	Project  int    `json:"project"`
 }
 
+// apiErrorResponse is the body of a non-OK response. Depending on the endpoint, code is a number or a string.
+type apiErrorResponse struct {
+	Code    interface{} `json:"code"`
+	Error   string      `json:"error"`
+	Message string      `json:"message"`
+}
+
 type ServerStatusResponse struct {
 	Platform struct {
 		Code     int    `json:"code"`
@@ -188,10 +199,11 @@ type FileHash struct {
 }
 
 type UpdateQCResponse struct {
-	ID     int        `json:"id"`
-	Date   time.Time  `json:"date"`
-	Hashes []FileHash `json:"hashes"`
-	BVer   string     `json:"bver"`
+	ID            int        `json:"id"`
+	Date          time.Time  `json:"date"`
+	Hashes        []FileHash `json:"hashes"`
+	BVer          string     `json:"bver"`
+	lastKnownGood bool
 }
 
 type UpdateLauncherResponse struct {
@@ -256,13 +268,32 @@ func (response *AuthResponse) parse(j json.RawMessage) error {
 		logger.Errorw(fmt.Sprintf("%s: error parsing raw auth response message", GetCaller()), "error", err, "data", string(j))
 		return err
 	}
-	if err := updateAuthToken(response.isPreSaveVerification, response.Token); err != nil {
+	if response.isTokenCheck {
+		return nil
+	}
+	if err := updateAuthToken(response); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error updating auth token from response", GetCaller()), "error", err, "data", response.Token)
 		return err
 	}
 	return nil
 }
 
+// serviceTokens returns the OAuth and Beam credentials of the response. The OAuth token is not always a
+// string, so anything else is kept as its JSON.
+func (response *AuthResponse) serviceTokens() ServiceTokens {
+	s := ServiceTokens{BeamClientAPIKey: response.BeamClientAPIKey, BeamToken: response.BeamToken}
+	switch v := response.OAuthToken.(type) {
+	case nil:
+	case string:
+		s.OAuthToken = v
+	default:
+		if j, err := json.Marshal(v); err == nil {
+			s.OAuthToken = string(j)
+		}
+	}
+	return s
+}
+
 func (response *BuildInfoResponse) parse(j json.RawMessage) error {
 	if err := json.Unmarshal(j, response); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error parsing raw build info response message", GetCaller()), "error", err, "data", string(j))
@@ -374,11 +405,10 @@ func (response *EntitlementCheckAPIResponse) parse(j json.RawMessage) error {
 // yeah, cyclomatic complexity and stuff...
 func parseRemoteResponseData(rd *remoteResponseData) (interface{}, error) {
 	switch rd.ResponseType {
-	case rrAuth, rrPreSave:
+	case rrAuth, rrPreSave, rrTokenCheck:
 		var r AuthResponse
-		if rd.ResponseType == rrPreSave {
-			r.isPreSaveVerification = true
-		}
+		r.isPreSaveVerification = rd.ResponseType == rrPreSave
+		r.isTokenCheck = rd.ResponseType == rrTokenCheck
 		err := r.parse(rd.Data)
 		if err != nil {
 			return nil, err
@@ -432,6 +462,7 @@ func parseRemoteResponseData(rd *remoteResponseData) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
+		r.lastKnownGood = rd.LastKnownGood
 		return r, nil
 	case rrUpdateLauncher:
 		var r UpdateLauncherResponse
@@ -452,3 +483,27 @@ func parseRemoteResponseData(rd *remoteResponseData) (interface{}, error) {
 		return nil, errors.New("Unknown response type")
 	}
 }
+
+// fpRejectionMarkers are looked for in the code, error and message of a forbidden response. Bethesda.net
+// does not document its error codes and no fingerprint rejection has been captured yet, so these are the
+// name of the header the fingerprint is sent in and the word for it, rather than a known code. Add the code
+// here once a rejection is seen in a debug log.
+var fpRejectionMarkers = []string{hkeyXSrcFp, "fingerprint"}
+
+// isFPRejection reports whether an error response says that the x-src-fp fingerprint was rejected. Other
+// forbidden responses, such as for an account without the game, are not fingerprint problems.
+func isFPRejection(body []byte) bool {
+	e := &apiErrorResponse{}
+	if err := json.Unmarshal(body, e); err != nil {
+		return false
+	}
+	for _, s := range []string{fmt.Sprint(e.Code), e.Error, e.Message} {
+		s = strings.ToLower(s)
+		for _, m := range fpRejectionMarkers {
+			if strings.Contains(s, m) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"testing"
+)
+
+func TestIsFPRejection(t *testing.T) {
+	// made up to cover each field and marker, as no real rejection has been captured (see fpRejectionMarkers)
+	rejections := []string{
+		`{"code":"invalid_x-src-fp","message":"Forbidden"}`,
+		`{"error":"Hardware fingerprint not recognized"}`,
+		`{"code":403,"message":"The x-src-fp header is not valid for this account"}`,
+	}
+	for _, body := range rejections {
+		if !isFPRejection([]byte(body)) {
+			t.Errorf("expected a fingerprint rejection: %s", body)
+		}
+	}
+	others := []string{
+		``,
+		`Forbidden`,
+		`{"code":403,"message":"Forbidden"}`,
+		`{"error":"Account does not own Quake Champions"}`,
+	}
+	for _, body := range others {
+		if isFPRejection([]byte(body)) {
+			t.Errorf("unexpected fingerprint rejection: %s", body)
+		}
+	}
+}
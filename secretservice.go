@@ -0,0 +1,275 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// secretServiceStore keeps the secrets in the freedesktop Secret Service (GNOME Keyring, KWallet) of the
+// Linux desktop that Wine runs on. Items are found by their application, id and name attributes.
+type secretServiceStore struct {
+	id string
+}
+
+type secretServiceConn struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+// secretServiceSecret is the Secret struct of the Secret Service API.
+type secretServiceSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+const (
+	secretServiceDest       = "org.freedesktop.secrets"
+	secretServicePath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretServiceCollection = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	secretServiceIface      = "org.freedesktop.Secret.Service"
+	secretCollectionIface   = "org.freedesktop.Secret.Collection"
+	secretItemIface         = "org.freedesktop.Secret.Item"
+	secretPromptIface       = "org.freedesktop.Secret.Prompt"
+	secretSessionIface      = "org.freedesktop.Secret.Session"
+	secretServicePromptWait = 2 * time.Minute
+	secretNoPrompt          = dbus.ObjectPath("/")
+)
+
+var runtimeDirUID = regexp.MustCompile(`^/run/user/(\d+)(/|$)`)
+
+func (s *secretServiceStore) attributes(name string) map[string]string {
+	return map[string]string{"application": secretServiceLabel, "id": s.id, "name": name}
+}
+
+func (s *secretServiceStore) Get(name string) (string, error) {
+	var value string
+	err := withSecretService(func(c *secretServiceConn) error {
+		items, err := c.search(s.attributes(name))
+		if err != nil || len(items) == 0 {
+			return err
+		}
+		var secret secretServiceSecret
+		if err = c.conn.Object(secretServiceDest, items[0]).Call(secretItemIface+".GetSecret", 0,
+			c.session).Store(&secret); err != nil {
+			return err
+		}
+		value = string(secret.Value)
+		return nil
+	})
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading from Secret Service", GetCaller()), "error", err)
+	}
+	return value, err
+}
+
+func (s *secretServiceStore) Set(name, value string) error {
+	err := withSecretService(func(c *secretServiceConn) error {
+		if err := c.unlock([]dbus.ObjectPath{secretServiceCollection}); err != nil {
+			return err
+		}
+		props := map[string]dbus.Variant{
+			secretItemIface + ".Label":      dbus.MakeVariant(fmt.Sprintf("%s %s", secretServiceLabel, name)),
+			secretItemIface + ".Attributes": dbus.MakeVariant(s.attributes(name)),
+		}
+		secret := secretServiceSecret{Session: c.session, Parameters: []byte{}, Value: []byte(value), ContentType: "text/plain"}
+		var item, prompt dbus.ObjectPath
+		if err := c.conn.Object(secretServiceDest, secretServiceCollection).Call(secretCollectionIface+".CreateItem", 0, props,
+			secret, true).Store(&item, &prompt); err != nil {
+			return err
+		}
+		return c.prompt(prompt)
+	})
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error writing to Secret Service", GetCaller()), "error", err)
+	}
+	return err
+}
+
+func (s *secretServiceStore) Delete(name string) error {
+	return withSecretService(func(c *secretServiceConn) error {
+		items, err := c.search(s.attributes(name))
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			var prompt dbus.ObjectPath
+			if err = c.conn.Object(secretServiceDest, item).Call(secretItemIface+".Delete", 0).Store(&prompt); err != nil {
+				return err
+			}
+			if err = c.prompt(prompt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// withSecretService connects to the session bus for the length of fn. Secrets are passed in the clear
+// ("plain" session), as the bus socket is only reachable by the signed-in user.
+func withSecretService(fn func(c *secretServiceConn) error) error {
+	conn, err := dialSessionBus()
+	if err != nil {
+		return fmt.Errorf("unable to connect to the D-Bus session bus: %s", err)
+	}
+	defer conn.Close()
+	c := &secretServiceConn{conn: conn}
+	var output dbus.Variant
+	if err = conn.Object(secretServiceDest, secretServicePath).Call(secretServiceIface+".OpenSession", 0, "plain",
+		dbus.MakeVariant("")).Store(&output, &c.session); err != nil {
+		return fmt.Errorf("unable to open a Secret Service session: %s", err)
+	}
+	defer conn.Object(secretServiceDest, c.session).Call(secretSessionIface+".Close", 0)
+	return fn(c)
+}
+
+// dialSessionBus connects to the address in DBUS_SESSION_BUS_ADDRESS, which Wine passes through from
+// Linux. A Unix socket path is reached through Wine's Z: drive.
+func dialSessionBus() (*dbus.Conn, error) {
+	address := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if address == "" {
+		return nil, errors.New("DBUS_SESSION_BUS_ADDRESS is not set")
+	}
+	var lastErr error
+	for _, a := range strings.Split(address, ";") {
+		i := strings.IndexRune(a, ':')
+		if i == -1 {
+			continue
+		}
+		transport, params := a[:i], busAddressParams(a[i+1:])
+		switch {
+		case transport == "unix" && params["path"] != "":
+			c, err := net.Dial("unix", winePath(params["path"]))
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			conn, err := dbus.NewConn(c)
+			if err != nil {
+				c.Close()
+				lastErr = err
+				continue
+			}
+			if err = conn.Auth([]dbus.Auth{dbus.AuthExternal(busUID(params["path"]))}); err == nil {
+				err = conn.Hello()
+			}
+			if err != nil {
+				conn.Close()
+				lastErr = err
+				continue
+			}
+			return conn, nil
+		case transport == "tcp" || transport == "nonce-tcp":
+			conn, err := dbus.Connect(a, dbus.WithAuth(dbus.AuthExternal(busUID(""))))
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			return conn, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no supported transport in %s", address)
+	}
+	return nil, lastErr
+}
+
+func busAddressParams(s string) map[string]string {
+	params := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		p := strings.SplitN(kv, "=", 2)
+		if len(p) != 2 {
+			continue
+		}
+		if v, err := dbus.UnescapeBusAddressValue(p[1]); err == nil {
+			params[p[0]] = v
+		}
+	}
+	return params
+}
+
+func winePath(unixPath string) string {
+	return `Z:` + strings.Replace(unixPath, "/", `\`, -1)
+}
+
+// busUID is the Linux user ID that the EXTERNAL mechanism claims. Windows has none, so it comes from the
+// bus or runtime directory path (/run/user/<uid>).
+func busUID(busPath string) string {
+	for _, p := range []string{busPath, os.Getenv("XDG_RUNTIME_DIR")} {
+		if m := runtimeDirUID.FindStringSubmatch(p); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+func (c *secretServiceConn) search(attrs map[string]string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	if err := c.conn.Object(secretServiceDest, secretServicePath).Call(secretServiceIface+".SearchItems", 0,
+		attrs).Store(&unlocked, &locked); err != nil {
+		return nil, err
+	}
+	if len(locked) == 0 {
+		return unlocked, nil
+	}
+	if err := c.unlock(locked); err != nil {
+		return nil, err
+	}
+	return append(unlocked, locked...), nil
+}
+
+func (c *secretServiceConn) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := c.conn.Object(secretServiceDest, secretServicePath).Call(secretServiceIface+".Unlock", 0,
+		objects).Store(&unlocked, &prompt); err != nil {
+		return err
+	}
+	return c.prompt(prompt)
+}
+
+// prompt shows a Secret Service prompt (e.g. to unlock the keyring) and waits for the user to answer it.
+func (c *secretServiceConn) prompt(prompt dbus.ObjectPath) error {
+	if prompt == "" || prompt == secretNoPrompt {
+		return nil
+	}
+	match := []dbus.MatchOption{dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface(secretPromptIface)}
+	if err := c.conn.AddMatchSignal(match...); err != nil {
+		return err
+	}
+	defer c.conn.RemoveMatchSignal(match...)
+	signals := make(chan *dbus.Signal, 1)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+	if err := c.conn.Object(secretServiceDest, prompt).Call(secretPromptIface+".Prompt", 0, "").Err; err != nil {
+		return err
+	}
+	timeout := time.After(secretServicePromptWait)
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != prompt || sig.Name != secretPromptIface+".Completed" {
+				continue
+			}
+			if len(sig.Body) > 0 {
+				if dismissed, ok := sig.Body[0].(bool); ok && dismissed {
+					return &authFailedError{emsg: "The Secret Service prompt was dismissed"}
+				}
+			}
+			return nil
+		case <-timeout:
+			return errors.New("timed out waiting for the Secret Service prompt")
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/danieljoos/wincred"
+	"github.com/google/uuid"
+)
+
+// SecretStore holds the username, password and auth token of the account in use. Get returns "" for a
+// secret that was never set.
+type SecretStore interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+}
+
+type SecretStoreOption struct {
+	Key  string
+	Name string
+}
+
+const (
+	SecretStoreDataFile      = "datafile"
+	SecretStoreWinCred       = "wincred"
+	SecretStoreSecretService = "secretservice"
+	secretUsername           = "username"
+	secretPassword           = "password"
+	secretToken              = "token"
+	secretServiceTokens      = "services"
+	secretServiceLabel       = "QCLauncher"
+)
+
+var (
+	SecretStores = []*SecretStoreOption{
+		{SecretStoreDataFile, "QCLauncher data file"},
+		{SecretStoreWinCred, "Windows Credential Manager"},
+		{SecretStoreSecretService, "Secret Service (Wine on Linux)"},
+	}
+	secretNames   = []string{secretUsername, secretPassword, secretToken, secretServiceTokens}
+	memorySecrets = &memorySecretValues{values: map[string]string{}}
+)
+
+// dataFileSecretStore keeps the secrets in the data file, encrypted with the credential key.
+type dataFileSecretStore struct {
+	tx DataTx
+}
+
+// winCredSecretStore keeps each secret as a generic credential named QCLauncher:<id>/<name>.
+type winCredSecretStore struct {
+	id string
+}
+
+// memorySecretStore stands in for the operating system's stores when the data store is not a file
+// (-store memory), so that nothing outlives the process.
+type memorySecretStore struct {
+	prefix string
+}
+
+type memorySecretValues struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func isSecretStore(kind string) bool {
+	for _, s := range SecretStores {
+		if s.Key == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// openSecretStore returns the secret store chosen in core, which is read within tx.
+func openSecretStore(tx DataTx, core *QCCoreSettings) (SecretStore, error) {
+	kind := core.SecretStore
+	if kind == "" || kind == SecretStoreDataFile {
+		return &dataFileSecretStore{tx: tx}, nil
+	}
+	if !isSecretStore(kind) {
+		return nil, fmt.Errorf("unknown secret store: %s", kind)
+	}
+	if core.SecretID == "" {
+		return nil, fmt.Errorf("no secret store ID was saved for %s", kind)
+	}
+	if !isFileStore() {
+		return &memorySecretStore{prefix: kind + "/" + core.SecretID + "/"}, nil
+	}
+	switch kind {
+	case SecretStoreWinCred:
+		return &winCredSecretStore{id: core.SecretID}, nil
+	default:
+		return &secretServiceStore{id: core.SecretID}, nil
+	}
+}
+
+// prepareSecretStore fills in the ID that an operating system store needs before it is first used.
+func (s *QCCoreSettings) prepareSecretStore() {
+	if s.SecretStore == "" {
+		s.SecretStore = SecretStoreDataFile
+	}
+	if s.SecretStore != SecretStoreDataFile && s.SecretID == "" {
+		s.SecretID = uuid.New().String()
+	}
+}
+
+func setSecret(ss SecretStore, name, value string) error {
+	if value == "" {
+		return ss.Delete(name)
+	}
+	return ss.Set(name, value)
+}
+
+// deleteSecrets removes everything QCLauncher saved in ss.
+func deleteSecrets(ss SecretStore) error {
+	for _, name := range secretNames {
+		if err := ss.Delete(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *dataFileSecretStore) Get(name string) (string, error) {
+	b := s.tx.Bucket([]byte(bucketSecrets))
+	if b == nil {
+		return "", nil
+	}
+	data := b.Get([]byte(name))
+	if data == nil {
+		return "", nil
+	}
+	key, err := credentialKey(s.tx)
+	if err != nil {
+		return "", err
+	}
+	return decrypt(string(data), &key)
+}
+
+func (s *dataFileSecretStore) Set(name, value string) error {
+	b, err := s.tx.CreateBucketIfNotExists([]byte(bucketSecrets))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating secrets bucket in datastore during save operation", GetCaller()),
+			"error", err)
+		return err
+	}
+	key, err := credentialKey(s.tx)
+	if err != nil {
+		return err
+	}
+	enc, err := encrypt(value, &key)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(name), []byte(enc))
+}
+
+func (s *dataFileSecretStore) Delete(name string) error {
+	b := s.tx.Bucket([]byte(bucketSecrets))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(name))
+}
+
+func (s *winCredSecretStore) target(name string) string {
+	return fmt.Sprintf("%s:%s/%s", secretServiceLabel, s.id, name)
+}
+
+func (s *winCredSecretStore) Get(name string) (string, error) {
+	cred, err := wincred.GetGenericCredential(s.target(name))
+	if err != nil {
+		if errors.Is(err, wincred.ErrElementNotFound) {
+			return "", nil
+		}
+		logger.Errorw(fmt.Sprintf("%s: error reading from Windows Credential Manager", GetCaller()), "error", err)
+		return "", err
+	}
+	return string(cred.CredentialBlob), nil
+}
+
+func (s *winCredSecretStore) Set(name, value string) error {
+	cred := wincred.NewGenericCredential(s.target(name))
+	cred.UserName = name
+	cred.CredentialBlob = []byte(value)
+	if err := cred.Write(); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error writing to Windows Credential Manager", GetCaller()), "error", err)
+		return err
+	}
+	return nil
+}
+
+func (s *winCredSecretStore) Delete(name string) error {
+	cred, err := wincred.GetGenericCredential(s.target(name))
+	if err != nil {
+		if errors.Is(err, wincred.ErrElementNotFound) {
+			return nil
+		}
+		return err
+	}
+	return cred.Delete()
+}
+
+func (s *memorySecretStore) Get(name string) (string, error) {
+	memorySecrets.mu.Lock()
+	defer memorySecrets.mu.Unlock()
+	return memorySecrets.values[s.prefix+name], nil
+}
+
+func (s *memorySecretStore) Set(name, value string) error {
+	memorySecrets.mu.Lock()
+	defer memorySecrets.mu.Unlock()
+	memorySecrets.values[s.prefix+name] = value
+	return nil
+}
+
+func (s *memorySecretStore) Delete(name string) error {
+	memorySecrets.mu.Lock()
+	defer memorySecrets.mu.Unlock()
+	delete(memorySecrets.values, s.prefix+name)
+	return nil
+}
+
+// readSecrets fills in the username and password of s from its secret store.
+func (s *QCCoreSettings) readSecrets(tx DataTx) error {
+	ss, err := openSecretStore(tx, s)
+	if err != nil {
+		return err
+	}
+	if s.Username, err = ss.Get(secretUsername); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading username credential", GetCaller()), "error", err)
+		return err
+	}
+	if s.Password, err = ss.Get(secretPassword); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading password credential", GetCaller()), "error", err)
+		return err
+	}
+	return nil
+}
+
+// writeSecrets saves the username, password and token of s to its secret store, and removes them from
+// prev's store if s uses another one. The operating system's stores are not part of the data file's
+// transaction, so they keep what was written even if the transaction is rolled back. For the same reason,
+// secrets in a previous operating system store are only removed by removeOldSecrets, once tx is committed.
+func (s *QCCoreSettings) writeSecrets(tx DataTx, prev *QCCoreSettings, password, token string) error {
+	s.oldSecrets = nil
+	ss, err := openSecretStore(tx, s)
+	if err != nil {
+		return err
+	}
+	for i, v := range []string{s.Username, password, token} {
+		name := secretNames[i]
+		if err = setSecret(ss, name, v); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error saving credential to secret store", GetCaller()), "store", s.SecretStore,
+				"secret", name, "error", err)
+			return err
+		}
+	}
+	if prev == nil || sameSecretStore(prev, s) {
+		return nil
+	}
+	old, err := openSecretStore(tx, prev)
+	if err == nil {
+		if _, ok := old.(*dataFileSecretStore); !ok {
+			s.oldSecrets = old
+			return nil
+		}
+		err = deleteSecrets(old)
+	}
+	if err != nil {
+		// the credentials are safe in the new store; don't fail the save over the leftovers
+		logger.Errorw(fmt.Sprintf("%s: error removing credentials from previous secret store", GetCaller()),
+			"store", prev.SecretStore, "error", err)
+	}
+	return nil
+}
+
+// removeOldSecrets removes the secrets that writeSecrets left in the previous operating system store. It
+// must only be called after the transaction that saved them in the new store was committed.
+func (s *QCCoreSettings) removeOldSecrets() {
+	old := s.oldSecrets
+	if old == nil {
+		return
+	}
+	s.oldSecrets = nil
+	if err := deleteSecrets(old); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error removing credentials from previous secret store", GetCaller()), "error", err)
+	}
+}
+
+func sameSecretStore(a, b *QCCoreSettings) bool {
+	kind := func(s *QCCoreSettings) string {
+		if s.SecretStore == "" || s.SecretStore == SecretStoreDataFile {
+			return SecretStoreDataFile
+		}
+		return s.SecretStore + "/" + s.SecretID
+	}
+	return kind(a) == kind(b)
+}
@@ -0,0 +1,170 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"testing"
+)
+
+// useMemorySecrets empties the memory secret store for the length of the test.
+func useMemorySecrets(t *testing.T) {
+	t.Helper()
+	memorySecrets.values = map[string]string{}
+	t.Cleanup(func() { memorySecrets.values = map[string]string{} })
+}
+
+// putCredentialKeyRaw stores a new credential key without a master passphrase.
+func putCredentialKeyRaw(t *testing.T, tx DataTx) {
+	t.Helper()
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Put([]byte(keyTokenKey), *genKey()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenSecretStore(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	ls.View(func(tx DataTx) error {
+		for _, core := range []*QCCoreSettings{{}, {SecretStore: SecretStoreDataFile}} {
+			ss, err := openSecretStore(tx, core)
+			if _, ok := ss.(*dataFileSecretStore); !ok || err != nil {
+				t.Errorf("%q: expected the data file store, got %T %v", core.SecretStore, ss, err)
+			}
+		}
+		// the memory data store never writes to the operating system's stores
+		for _, kind := range []string{SecretStoreWinCred, SecretStoreSecretService} {
+			ss, err := openSecretStore(tx, &QCCoreSettings{SecretStore: kind, SecretID: "id"})
+			if ms, ok := ss.(*memorySecretStore); !ok || err != nil || ms.prefix != kind+"/id/" {
+				t.Errorf("%s: expected the memory store, got %#v %v", kind, ss, err)
+			}
+		}
+		if _, err := openSecretStore(tx, &QCCoreSettings{SecretStore: "keychain", SecretID: "id"}); err == nil {
+			t.Error("expected an error for an unknown store")
+		}
+		if _, err := openSecretStore(tx, &QCCoreSettings{SecretStore: SecretStoreWinCred}); err == nil {
+			t.Error("expected an error for a store without an ID")
+		}
+		return nil
+	})
+}
+
+func TestSetSecretDeletesEmptyValues(t *testing.T) {
+	useMemorySecrets(t)
+	ss := &memorySecretStore{prefix: "test/"}
+	if err := setSecret(ss, secretPassword, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := ss.Get(secretPassword); v != "hunter2" {
+		t.Fatalf("expected the saved value, got %q", v)
+	}
+	if err := setSecret(ss, secretPassword, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := memorySecrets.values["test/"+secretPassword]; ok {
+		t.Error("an empty value was stored instead of deleting the secret")
+	}
+}
+
+func TestDeleteSecrets(t *testing.T) {
+	useMemorySecrets(t)
+	ss, other := &memorySecretStore{prefix: "a/"}, &memorySecretStore{prefix: "b/"}
+	for _, name := range secretNames {
+		ss.Set(name, "value")
+		other.Set(name, "value")
+	}
+	if err := deleteSecrets(ss); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range secretNames {
+		if v, _ := ss.Get(name); v != "" {
+			t.Errorf("secret %s was kept", name)
+		}
+		if v, _ := other.Get(name); v != "value" {
+			t.Errorf("secret %s of another store was deleted", name)
+		}
+	}
+}
+
+func TestWriteSecretsMovesBetweenStores(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	useMemorySecrets(t)
+	dataFile := &QCCoreSettings{Username: "user", SecretStore: SecretStoreDataFile}
+	osStore := &QCCoreSettings{Username: "user", SecretStore: SecretStoreWinCred, SecretID: "id"}
+	if err := ls.Update(func(tx DataTx) error {
+		putCredentialKeyRaw(t, tx)
+		return dataFile.writeSecrets(tx, nil, "pass", "token")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	read := func(core *QCCoreSettings) map[string]string {
+		values := map[string]string{}
+		if err := ls.View(func(tx DataTx) error {
+			ss, err := openSecretStore(tx, core)
+			if err != nil {
+				return err
+			}
+			for _, name := range secretNames {
+				if values[name], err = ss.Get(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return values
+	}
+	if v := read(dataFile); v[secretUsername] != "user" || v[secretPassword] != "pass" || v[secretToken] != "token" {
+		t.Fatalf("unexpected data file secrets: %v", v)
+	}
+	for _, move := range []struct{ from, to *QCCoreSettings }{{dataFile, osStore}, {osStore, dataFile}} {
+		if err := ls.Update(func(tx DataTx) error { return move.to.writeSecrets(tx, move.from, "pass", "token") }); err != nil {
+			t.Fatal(err)
+		}
+		move.to.removeOldSecrets()
+		if v := read(move.to); v[secretUsername] != "user" || v[secretPassword] != "pass" || v[secretToken] != "token" {
+			t.Errorf("%s: secrets were not moved: %v", move.to.SecretStore, v)
+		}
+		for name, v := range read(move.from) {
+			if v != "" {
+				t.Errorf("%s: secret %s was left behind", move.from.SecretStore, name)
+			}
+		}
+	}
+}
+
+func TestWriteSecretsRollbackKeepsOldStore(t *testing.T) {
+	ls := useMemoryStore(t, nil)
+	useMemorySecrets(t)
+	osStore := &QCCoreSettings{Username: "user", SecretStore: SecretStoreWinCred, SecretID: "id"}
+	dataFile := &QCCoreSettings{Username: "user", SecretStore: SecretStoreDataFile}
+	if err := ls.Update(func(tx DataTx) error {
+		putCredentialKeyRaw(t, tx)
+		return osStore.writeSecrets(tx, nil, "pass", "token")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// a later step of the save fails after the secrets were moved
+	err := ls.Update(func(tx DataTx) error {
+		if err := dataFile.writeSecrets(tx, osStore, "pass", "token"); err != nil {
+			return err
+		}
+		return errTestRollback
+	})
+	if err != errTestRollback {
+		t.Fatalf("expected the Update's error, got %v", err)
+	}
+	if v := memorySecrets.values[SecretStoreWinCred+"/id/"+secretPassword]; v != "pass" {
+		t.Errorf("the previous store lost its password before the save was committed: %q", v)
+	}
+	ls.View(func(tx DataTx) error {
+		if sb := tx.Bucket([]byte(bucketSecrets)); sb != nil && sb.Get([]byte(secretPassword)) != nil {
+			t.Error("the data file kept secrets from a rolled back save")
+		}
+		return nil
+	})
+}
@@ -14,53 +14,93 @@ type Configuration struct {
 	Experimental *QCExperimentalSettings
 	Launcher     *LauncherSettings
 	Auth         *TokenAuth
+	Profile      *Profile
 }
 
 var isCollectingSettings = false
 
+// GetConfiguration returns the stored settings with any overrides from the environment or qclauncher.toml applied.
 func GetConfiguration() (*Configuration, error) {
-	coreQCSettings := &QCCoreSettings{}
-	err := Get(coreQCSettings)
+	cfg, err := getStoredConfiguration()
 	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error retrieving core QC configuration settings", GetCaller()), "error", err)
 		return nil, err
 	}
-	expQCSettings := &QCExperimentalSettings{}
-	err = Get(expQCSettings)
+	applyConfigOverrides(cfg)
+	applyLogRotation(cfg.Launcher)
+	return cfg, nil
+}
+
+// getStoredConfiguration returns the settings as saved, for anything that saves them back. Everything is read
+// in one transaction.
+func getStoredConfiguration() (*Configuration, error) {
+	return getStoredProfileConfiguration(ConfProfile)
+}
+
+// getStoredProfileConfiguration is getStoredConfiguration with the named profile's settings, or the selected
+// profile's if profile is empty. It returns a usageError if the profile does not exist.
+func getStoredProfileConfiguration(profile string) (*Configuration, error) {
+	ls, err := newLauncherDataStore()
 	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error retrieving experimental QC configuration settings", GetCaller()), "error", err)
 		return nil, err
 	}
-	launcherSettings := &LauncherSettings{}
-	err = Get(launcherSettings)
-	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error retrieving launcher configuration settings", GetCaller()), "error", err)
+	defer ls.Close()
+	ls.checkDataFile(false)
+	if err = unlockCredentials(); err != nil {
 		return nil, err
 	}
-	authToken := &TokenAuth{}
-	err = Get(authToken)
-	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error retrieving auth token", GetCaller()), "error", err)
+	cfg := &Configuration{
+		Core:         &QCCoreSettings{},
+		Experimental: &QCExperimentalSettings{},
+		Launcher:     &LauncherSettings{},
+		Auth:         &TokenAuth{},
+	}
+	if err = ls.View(func(tx DataTx) error {
+		if err := cfg.Core.read(tx); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error retrieving core QC configuration settings", GetCaller()), "error", err)
+		}
+		if err := cfg.Experimental.read(tx); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error retrieving experimental QC configuration settings", GetCaller()), "error", err)
+			return err
+		}
+		if err := cfg.Launcher.read(tx); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error retrieving launcher configuration settings", GetCaller()), "error", err)
+			return err
+		}
+		if err := cfg.Auth.read(tx); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error retrieving auth token", GetCaller()), "error", err)
+			return err
+		}
+		name, err := readProfileName(tx, profile)
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error determining active profile", GetCaller()), "error", err)
+			return err
+		}
+		readProfile(tx, cfg, name)
+		return nil
+	}); err != nil {
 		return nil, err
 	}
-	return &Configuration{
-		Core:         coreQCSettings,
-		Experimental: expQCSettings,
-		Launcher:     launcherSettings,
-		Auth:         authToken,
-	}, nil
+	addLogSecrets(cfg.Core.Password, cfg.Core.FP, cfg.Auth.Token)
+	addLogSecrets(cfg.Auth.Services.secrets()...)
+	return cfg, nil
 }
 
 func GetEmptyConfiguration() *Configuration {
 	return &Configuration{
-		Core:         &QCCoreSettings{},
+		Core:         &QCCoreSettings{SecretStore: SecretStoreDataFile},
 		Experimental: &QCExperimentalSettings{},
 		Launcher:     &LauncherSettings{},
+		Profile:      &Profile{Name: DefaultProfile},
 	}
 }
 
 func DeleteConfiguration(removeLock bool) {
-	err := DeleteFile(GetDataFilePath())
+	if _, err := BackupDataFile(backupReasonReset); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error backing up %s before reset", GetCaller(), DataFile), "error", err)
+	}
+	closeDataStore()
+	ClearUnlockCache()
+	err := deleteDataStore()
 	if err != nil && !os.IsNotExist(err) {
 		logger.Error(fmt.Sprintf("%s: error deleting %s: %s", GetCaller(), DataFile, err))
 		Lock.Unlock()
@@ -80,8 +120,20 @@ func configureSettings() {
 	}
 	var err error
 	var cfg *Configuration
-	if FileExists(GetDataFilePath()) {
-		cfg, err = GetConfiguration()
+	if DataStoreExists() {
+		cfg, err = getStoredConfiguration()
+		// restore the newest good backup rather than resetting
+		if IsErrCorrupted(err) {
+			if !RecoverDataFile() {
+				return
+			}
+			cfg, err = getStoredConfiguration()
+		}
+		// -profile named a profile that does not exist, or the passphrase prompt was dismissed: nothing to reset
+		if IsErrUsage(err) || IsErrLocked(err) || IsErrAuthFailed(err) {
+			ShowErrorMsg("Error", err.Error(), nil)
+			return
+		}
 		if err != nil {
 			ShowErrorMsg("Error", "An error occurred when retrieving your settings. Resetting.", nil)
 			DeleteConfiguration(false)
@@ -100,26 +152,40 @@ func saveConfiguration(cfg *Configuration) error {
 		return err
 	}
 	checkLog := fmt.Sprintf("please check the %s file for more details.", LogFile)
-	if err := Save(cfg.Core); err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error saving QC core settings", GetCaller()), "error", err)
-		return fmt.Errorf("Unable to save QC core settings, %s", checkLog)
-	}
-	cfg.Experimental.resetBoolForZeroValues() // handle 0 values (no effect) and others
-	if err := Save(cfg.Experimental); err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error saving QC experimental settings", GetCaller()), "error", err)
-		return fmt.Errorf("Unable to save QC experimental settings, %s", checkLog)
+	if _, err := BackupDataFile(backupReasonSave); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error backing up %s before saving settings", GetCaller(), DataFile), "error", err)
 	}
 	// Steam launch should be a one-time event
 	launchSteam := cfg.Launcher.SetAsNonSteamGame
 	cfg.Launcher.SetAsNonSteamGame = false
-	if err := Save(cfg.Launcher); err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error saving launcher settings", GetCaller()), "error", err)
-		return fmt.Errorf("Unable to save launcher settings, %s", checkLog)
-	}
-	if err := updateLastCheckTime(UpdateAll, 0); err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error setting last update check time", GetCaller()), "error", err)
-		return err
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		cfg.Launcher.SetAsNonSteamGame = launchSteam
+		return fmt.Errorf("Unable to save settings, %s", checkLog)
+	}
+	defer ls.Close()
+	// one transaction so that a failure leaves the saved settings exactly as they were
+	if err = ls.Update(func(tx DataTx) error {
+		if err := cfg.Core.write(tx); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error saving QC core settings", GetCaller()), "error", err)
+			return err
+		}
+		if err := writeProfileSettings(tx, cfg, true, true); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error saving QC experimental and launcher settings", GetCaller()),
+				"profile", cfg.Profile.Name, "error", err)
+			return err
+		}
+		if err := putLastCheckTime(tx, UpdateAll, 0); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error setting last update check time", GetCaller()), "error", err)
+			return err
+		}
+		return nil
+	}); err != nil {
+		cfg.Launcher.SetAsNonSteamGame = launchSteam
+		return fmt.Errorf("Unable to save settings, %s", checkLog)
 	}
+	cfg.Core.removeOldSecrets()
+	applyLogRotation(cfg.Launcher)
 	if launchSteam {
 		ShowInfoMsg("Launching Steam",
 			"Now opening Steam to add Quake Champions. When Steam loads, browse to and select your qclauncher.exe file.",
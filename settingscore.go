@@ -4,13 +4,10 @@
 package qclauncher
 
 import (
-	"bytes"
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"strings"
-
-	bolt "github.com/coreos/bbolt"
+	"time"
 )
 
 type QCCoreSettings struct {
@@ -19,20 +16,21 @@ type QCCoreSettings struct {
 	FilePath string
 	Language string
 	FP       string
+	// TokenOnly discards the password once there is an auth token; it is asked for when the token goes stale.
+	TokenOnly bool
+	// SecretStore is where the username, password and token are kept (see SecretStores). SecretID tells
+	// this data file's entries apart in the operating system's stores.
+	SecretStore string
+	SecretID    string
+	oldSecrets  SecretStore // left for removeOldSecrets by writeSecrets
 }
 
 func (s *QCCoreSettings) get(ls *LauncherStore) error {
 	ls.checkDataFile(false)
-	if err := ls.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketSettings))
-		decerr := s.decode(b.Get([]byte(keyQCCoreSettings)), b.Get([]byte(keyTokenKey)))
-		if decerr != nil {
-			logger.Errorw(fmt.Sprintf("%s: error decoding QC core settings from datastore during get operation", GetCaller()),
-				"error", decerr)
-			return decerr
-		}
-		return nil
-	}); err != nil {
+	if err := unlockCredentials(); err != nil {
+		return err
+	}
+	if err := ls.View(s.read); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error getting QC core settings from datastore", GetCaller()), "error", err)
 		return nil
 	}
@@ -40,74 +38,109 @@ func (s *QCCoreSettings) get(ls *LauncherStore) error {
 }
 
 func (s *QCCoreSettings) save(ls *LauncherStore) error {
-	if err := ls.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error creating settings bucket in datastore during save operation",
-				GetCaller()), "error", err)
-			return err
-		}
-		s.FP = tmpFp
-		encoded, err := s.encode()
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error encoding QC core settings during datastore save operation", GetCaller()),
-				"error", err)
-			return err
-		}
-		if err = b.Put([]byte(keyQCCoreSettings), encoded); err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error saving encoded QC core settings to datastore", GetCaller()), "error", err)
-		}
-		if err = b.Put([]byte(keyTokenKey), *tmpKey); err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error saving credential key to datastore", GetCaller()), "error", err)
-			return err
-		}
-		return nil
-	}); err != nil {
+	if err := ls.Update(s.write); err != nil {
 		return err
 	}
-	t := &TokenAuth{Token: tmpToken}
-	return t.save(ls)
+	s.removeOldSecrets()
+	return nil
 }
 
-func (s *QCCoreSettings) decode(data, key []byte) error {
-	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&s); err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error decoding QC core settings data", GetCaller()), "error", err)
+func (s *QCCoreSettings) read(tx DataTx) error {
+	if err := s.decode(tx.Bucket([]byte(bucketSettings)).Get([]byte(keyQCCoreSettings))); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding QC core settings from datastore during get operation", GetCaller()),
+			"error", err)
 		return err
 	}
-	qcDecUser, err := decrypt(s.Username, &key)
+	if s.SecretStore == "" {
+		s.SecretStore = SecretStoreDataFile
+	}
+	return s.readSecrets(tx)
+}
+
+// write saves the core settings, the credential key and the credentials in the chosen secret store. The
+// settings themselves are left unencrypted so that they can be saved again if the transaction is rolled back.
+func (s *QCCoreSettings) write(tx DataTx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating settings bucket in datastore during save operation",
+			GetCaller()), "error", err)
+		return err
+	}
+	s.FP = tmpFp
+	s.prepareSecretStore()
+	prev, err := readCoreRecord(tx)
 	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error decrypting username credential", GetCaller()), "error", err)
 		return err
 	}
-	qcDecPass, err := decrypt(s.Password, &key)
+	oldKey, err := credentialKey(tx)
 	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error decrypting password credential", GetCaller()), "error", err)
 		return err
 	}
-	s.Username = qcDecUser
-	s.Password = qcDecPass
+	if err = reencryptAccounts(tx, oldKey, *tmpKey); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error re-encrypting stored accounts with new credential key", GetCaller()), "error", err)
+		return err
+	}
+	encoded, err := s.encode()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error encoding QC core settings during datastore save operation", GetCaller()),
+			"error", err)
+		return err
+	}
+	if err = b.Put([]byte(keyQCCoreSettings), encoded); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving encoded QC core settings to datastore", GetCaller()), "error", err)
+		return err
+	}
+	if err = putCredentialKey(tx, *tmpKey); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving credential key to datastore", GetCaller()), "error", err)
+		return err
+	}
+	password := s.Password
+	if s.TokenOnly && tmpToken != "" {
+		password = ""
+	}
+	// written after the new key so that the data file's copies are encrypted with it
+	if err = s.writeSecrets(tx, prev, password, tmpToken); err != nil {
+		return err
+	}
+	// a token that differs from the saved one comes from the pre-save login
+	if err = writeTokenInfoFor(tx, tmpToken, tmpSessionID, time.Now()); err != nil {
+		return err
+	}
+	// the account in use is never also kept in the vault
+	return deleteAccountRecord(tx, s.Username)
+}
+
+func (s *QCCoreSettings) decode(data []byte) error {
+	if err := decodeRecord(data, &s); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding QC core settings data", GetCaller()), "error", err)
+		return err
+	}
 	return nil
 }
 
+// encode leaves out the username and password, which are kept in the secret store.
 func (s *QCCoreSettings) encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	encUser, err := encrypt(s.Username, tmpKey)
-	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error encrypting username credential", GetCaller()), "error", err)
-		return nil, err
-	}
-	encPass, err := encrypt(s.Password, tmpKey)
+	rec := *s
+	rec.Username, rec.Password = "", ""
+	data, err := encodeRecord(&rec)
 	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error encrypting password credential", GetCaller()), "error", err)
+		logger.Errorw(fmt.Sprintf("%s: error encoding QC core settings data", GetCaller()), "error", err)
 		return nil, err
 	}
-	s.Username = encUser
-	s.Password = encPass
-	if err = gob.NewEncoder(buf).Encode(s); err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error encoding QC core settings data", GetCaller()), "error", err)
+	return data, nil
+}
+
+// readCoreRecord returns the saved core settings without their credentials, or nil if none were saved.
+func readCoreRecord(tx DataTx) (*QCCoreSettings, error) {
+	data := tx.Bucket([]byte(bucketSettings)).Get([]byte(keyQCCoreSettings))
+	if data == nil {
+		return nil, nil
+	}
+	s := &QCCoreSettings{}
+	if err := s.decode(data); err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return s, nil
 }
 
 func (s *QCCoreSettings) validate() error {
@@ -117,7 +150,7 @@ func (s *QCCoreSettings) validate() error {
 	if s.Username == "" {
 		return errors.New("QC username must be specified")
 	}
-	if s.Password == "" {
+	if s.Password == "" && !(s.TokenOnly && hasStoredToken(s.Username)) {
 		return errors.New("QC password must be specified")
 	}
 	if s.FilePath == "" {
@@ -129,49 +162,49 @@ func (s *QCCoreSettings) validate() error {
 	if s.Language == "" {
 		return errors.New("QC language must be specified")
 	}
+	if s.SecretStore != "" && !isSecretStore(s.SecretStore) {
+		return fmt.Errorf("Unknown credential store: %s", s.SecretStore)
+	}
 	if isFPOverride() {
 		s.FP = ConfXSrcFp
 	}
 	fp, err := validateAccount(s.Username, s.Password, s.FP)
+	if IsErrFPUnavailable(err) {
+		return err
+	}
 	if fp == "" {
 		return errors.New("Unable to get required hardware fingerprint from Bethesda Launcher. Please try again.")
 	}
 	return err
 }
 
+// hasStoredToken reports whether username is the saved account and has an auth token, which is all that
+// token-only mode keeps.
+func hasStoredToken(username string) bool {
+	if !DataStoreExists() {
+		return false
+	}
+	cfg, err := getStoredConfiguration()
+	return err == nil && cfg.Core.Username == username && cfg.Auth.Token != ""
+}
+
+// validateAccount checks the login with Bethesda.net unless it is the saved one, and returns the fingerprint
+// to save with it. fp is the fingerprint already known for the settings being saved, if any.
 func validateAccount(username, password, fp string) (string, error) {
-	var fpErr error
-	if !FileExists(GetDataFilePath()) {
-		if fp == "" {
-			fp, fpErr = getBNLFingerprint()
-			if fpErr != nil {
-				return "", fpErr
-			}
-			return fp, newLauncherClient(defTimeout).verifyCredentials(username, password)
-		} else {
-			tmpFp = fp
-		}
-	} else {
+	if fp != "" && tmpFp == "" && !isFPOverride() {
+		tmpFp = fp
+	}
+	fp, _, err := resolveFP()
+	if err != nil {
+		return "", err
+	}
+	if DataStoreExists() {
 		cfg, err := GetConfiguration()
 		if err != nil {
 			logger.Errorw(fmt.Sprintf("%s: error getting configuration during pre-save account validation",
 				GetCaller()), "error", err)
-			fp, fpErr = getBNLFingerprint()
-			if fpErr != nil {
-				return "", fpErr
-			}
 			return fp, newLauncherClient(defTimeout).verifyCredentials(username, password)
 		}
-		if isFPOverride() {
-			fp = ConfXSrcFp
-		} else if cfg.Core.FP != "" {
-			fp = cfg.Core.FP
-		} else {
-			fp, fpErr = getBNLFingerprint()
-			if fpErr != nil {
-				return "", fpErr
-			}
-		}
 		if cfg.Core.Username == username && cfg.Core.Password == password {
 			token := &TokenAuth{}
 			if err := Get(token); err != nil {
@@ -179,7 +212,9 @@ func validateAccount(username, password, fp string) (string, error) {
 			}
 			tmpKey = genKey()
 			tmpToken = token.Token
-			tmpFp = fp
+			if tmpFp == "" {
+				tmpFp = cfg.Core.FP
+			}
 			return fp, nil
 		}
 	}
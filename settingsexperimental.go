@@ -4,60 +4,57 @@
 package qclauncher
 
 import (
-	"bytes"
-	"encoding/gob"
 	"errors"
 	"fmt"
-
-	bolt "github.com/coreos/bbolt"
 )
 
+// QCExperimentalSettings holds the QC options (see OptionsCatalog) that are turned on, by option ID.
 type QCExperimentalSettings struct {
-	UseMaxFPSLimit          bool
-	UseMaxFPSLimitMinimized bool
-	UseFPSSmoothing         bool
-	MaxFPSLimit             int
-	MaxFPSLimitMinimized    int
+	Options map[string]string
 }
 
 func (s *QCExperimentalSettings) get(ls *LauncherStore) error {
 	ls.checkDataFile(false)
-	if err := ls.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketSettings))
-		decerr := s.decode(b.Get([]byte(keyQCExperimentalSettings)))
-		if decerr != nil {
-			logger.Errorw(fmt.Sprintf("%s: error decoding QC experimental settings from datastore during get operation", GetCaller()),
-				"error", decerr)
-			return decerr
-		}
-		return nil
-	}); err != nil {
+	if err := ls.View(s.read); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error getting QC experimental settings from datastore", GetCaller()), "error", err)
 		return err
 	}
 	return nil
 }
 
+func (s *QCExperimentalSettings) read(tx DataTx) error {
+	b := tx.Bucket([]byte(bucketSettings))
+	decerr := s.decode(b.Get([]byte(keyQCExperimentalSettings)))
+	if decerr != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding QC experimental settings from datastore during get operation", GetCaller()),
+			"error", decerr)
+		return decerr
+	}
+	return nil
+}
+
 func (s *QCExperimentalSettings) save(ls *LauncherStore) error {
-	return ls.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error creating settings bucket in datastore during save operation",
-				GetCaller()), "error", err)
-			return err
-		}
-		encoded, err := s.encode()
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error encoding QC experimental settings during datastore save operation", GetCaller()),
-				"error", err)
-			return err
-		}
-		return b.Put([]byte(keyQCExperimentalSettings), encoded)
-	})
+	return ls.Update(s.write)
+}
+
+func (s *QCExperimentalSettings) write(tx DataTx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating settings bucket in datastore during save operation",
+			GetCaller()), "error", err)
+		return err
+	}
+	encoded, err := s.encode()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error encoding QC experimental settings during datastore save operation", GetCaller()),
+			"error", err)
+		return err
+	}
+	return b.Put([]byte(keyQCExperimentalSettings), encoded)
 }
 
 func (s *QCExperimentalSettings) decode(data []byte) error {
-	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&s); err != nil {
+	if err := decodeRecord(data, &s); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error decoding QC experimental settings data", GetCaller()), "error", err)
 		return err
 	}
@@ -65,27 +62,55 @@ func (s *QCExperimentalSettings) decode(data []byte) error {
 }
 
 func (s *QCExperimentalSettings) encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	if err := gob.NewEncoder(buf).Encode(s); err != nil {
+	data, err := encodeRecord(s)
+	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error encoding QC experimental settings data", GetCaller()), "error", err)
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return data, nil
 }
 
 func (s *QCExperimentalSettings) validate() error {
 	if s == nil {
 		return errors.New("QC Experimental setting info was not entered")
 	}
+	catalog := getOptionsCatalog()
+	for id, v := range s.Options {
+		o := catalog.find(id)
+		if o == nil {
+			continue // from a newer catalog; kept, but not sent to QC
+		}
+		if err := o.validate(v); err != nil {
+			return fmt.Errorf("%s: %s", o.Label, err)
+		}
+	}
 	return nil
 }
 
-func (s *QCExperimentalSettings) resetBoolForZeroValues() {
-	// values of zero for the following have absolutely no effect, so reset the state prior to saving
-	if s.UseMaxFPSLimit && s.MaxFPSLimit == 0 {
-		s.UseMaxFPSLimit = false
+func (s *QCExperimentalSettings) copy() *QCExperimentalSettings {
+	c := &QCExperimentalSettings{Options: map[string]string{}}
+	if s == nil {
+		return c
 	}
-	if s.UseMaxFPSLimitMinimized && s.MaxFPSLimitMinimized == 0 {
-		s.UseMaxFPSLimitMinimized = false
+	for id, v := range s.Options {
+		c.Options[id] = v
+	}
+	return c
+}
+
+// args returns the launch arguments for the options that are turned on, in catalog order.
+func (s *QCExperimentalSettings) args() []string {
+	var args []string
+	for _, o := range getOptionsCatalog().Options {
+		v, ok := s.Options[o.ID]
+		if !ok {
+			continue
+		}
+		if o.Removed {
+			logger.Infow("skipping QC option that was removed from the game", "option", o.ID)
+			continue
+		}
+		args = append(args, o.arg(v))
 	}
+	return args
 }
@@ -0,0 +1,289 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	settingsExportFormat  = "qclauncher-settings"
+	settingsExportVersion = 2
+	exportKDF             = "argon2id"
+	exportKDFTime         = 3
+	exportKDFMemory       = 64 * 1024
+	exportKDFThreads      = 4
+	exportSaltLen         = 16
+	minExportPassphrase   = 8
+)
+
+// SettingsExport is the portable settings file. Settings are grouped by the section of their
+// setting key (see settingKeys), e.g. settings.core.language.
+type SettingsExport struct {
+	Format      string                       `json:"format" toml:"format"`
+	Version     int                          `json:"version" toml:"version"`
+	Exported    string                       `json:"exported" toml:"exported"`
+	Settings    map[string]map[string]string `json:"settings" toml:"settings"`
+	Credentials *ExportedCredentials         `json:"credentials,omitempty" toml:"credentials,omitempty"`
+}
+
+type ExportedCredentials struct {
+	KDF     string `json:"kdf" toml:"kdf"`
+	Time    uint32 `json:"time" toml:"time"`
+	Memory  uint32 `json:"memory" toml:"memory"`
+	Threads uint8  `json:"threads" toml:"threads"`
+	Salt    string `json:"salt" toml:"salt"`
+	Data    string `json:"data" toml:"data"`
+}
+
+type exportedAccount struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ExportSettings writes the saved settings to p as JSON, or TOML if p ends in .toml. The username and
+// password are only included when a passphrase is given.
+func ExportSettings(p, passphrase string) error {
+	if !DataStoreExists() {
+		return &notConfiguredError{emsg: "There are no saved settings to export"}
+	}
+	cfg, err := getStoredConfiguration()
+	if err != nil {
+		return err
+	}
+	exp := &SettingsExport{
+		Format:   settingsExportFormat,
+		Version:  settingsExportVersion,
+		Exported: time.Now().Format(time.RFC3339),
+		Settings: map[string]map[string]string{},
+	}
+	for _, k := range getSettingKeys() {
+		if k.readOnly {
+			continue
+		}
+		section, name := splitSettingKey(k.name)
+		if exp.Settings[section] == nil {
+			exp.Settings[section] = map[string]string{}
+		}
+		exp.Settings[section][name] = k.get(cfg)
+	}
+	if passphrase != "" {
+		if exp.Credentials, err = encryptExportedAccount(cfg.Core, passphrase); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error encrypting credentials for export", GetCaller()), "error", err)
+			return err
+		}
+	}
+	data, err := encodeSettingsExport(exp, isTOMLFile(p))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error encoding settings export", GetCaller()), "error", err)
+		return err
+	}
+	if err = ioutil.WriteFile(p, data, 0600); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error writing settings export", GetCaller()), "error", err)
+		return err
+	}
+	logger.Infow("settings exported", "file", p, "credentials", exp.Credentials != nil)
+	return nil
+}
+
+// ReadSettingsExport applies the settings in p to cfg without saving them. Credentials in the file are
+// only applied when a passphrase is given. cfg is left unchanged if anything in the file is invalid.
+func ReadSettingsExport(cfg *Configuration, p, passphrase string) error {
+	exp, err := readSettingsExportFile(p)
+	if err != nil {
+		return err
+	}
+	core, launcher, profile := *cfg.Core, *cfg.Launcher, *cfg.Profile
+	experimental := cfg.Experimental.copy()
+	imported := &Configuration{Core: &core, Experimental: experimental, Launcher: &launcher, Auth: cfg.Auth, Profile: &profile}
+	for section, values := range exp.Settings {
+		for name, v := range values {
+			k, err := getSettingKey(section + "." + name)
+			if err != nil {
+				return err
+			}
+			if k.readOnly {
+				return &usageError{emsg: fmt.Sprintf("%s cannot be imported", k.name)}
+			}
+			if err = k.set(imported, v); err != nil {
+				return fmt.Errorf("%s: %s", k.name, err)
+			}
+		}
+	}
+	if exp.Credentials != nil && passphrase != "" {
+		acct, err := decryptExportedAccount(exp.Credentials, passphrase)
+		if err != nil {
+			return err
+		}
+		core.Username = acct.Username
+		core.Password = acct.Password
+	}
+	*cfg.Core, *cfg.Experimental, *cfg.Launcher, *cfg.Profile = core, *experimental, launcher, profile
+	return nil
+}
+
+// ImportSettings applies the settings in p on top of the current settings and saves them after the
+// same validation as the settings window.
+func ImportSettings(p, passphrase string) (*Configuration, error) {
+	cfg := GetEmptyConfiguration()
+	if DataStoreExists() {
+		var err error
+		if cfg, err = getStoredConfiguration(); err != nil {
+			return nil, err
+		}
+	}
+	if err := ReadSettingsExport(cfg, p, passphrase); err != nil {
+		return nil, err
+	}
+	if err := saveConfiguration(cfg); err != nil {
+		return nil, err
+	}
+	logger.Infow("settings imported", "file", p)
+	return cfg, nil
+}
+
+func SettingsExportHasCredentials(p string) bool {
+	exp, err := readSettingsExportFile(p)
+	return err == nil && exp.Credentials != nil
+}
+
+func readSettingsExportFile(p string) (*SettingsExport, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	exp := &SettingsExport{}
+	if isTOMLFile(p) {
+		err = toml.Unmarshal(data, exp)
+	} else {
+		err = json.Unmarshal(data, exp)
+	}
+	if err != nil {
+		return nil, &usageError{emsg: fmt.Sprintf("%s is not a valid settings file: %s", filepath.Base(p), err)}
+	}
+	if exp.Format != settingsExportFormat {
+		return nil, &usageError{emsg: fmt.Sprintf("%s is not a QCLauncher settings file", filepath.Base(p))}
+	}
+	if exp.Version < 1 || exp.Version > settingsExportVersion {
+		return nil, &usageError{emsg: fmt.Sprintf("Settings file version %d is not supported by this version of QCLauncher", exp.Version)}
+	}
+	if exp.Version == 1 {
+		upgradeSettingsExportV1(exp)
+	}
+	return exp, nil
+}
+
+// Version 1 files have fixed experimental settings with separate on/off keys; from version 2 there is
+// one key per QC option and an empty value turns it off.
+func upgradeSettingsExportV1(exp *SettingsExport) {
+	old := exp.Settings["experimental"]
+	if old == nil {
+		return
+	}
+	options := map[string]string{}
+	for _, v := range []struct{ use, value, id string }{
+		{"usemaxfps", "maxfps", "maxfps"},
+		{"usemaxfpsminimized", "maxfpsminimized", "maxfpsminimized"},
+	} {
+		options[v.id] = ""
+		if on, _ := strconv.ParseBool(old[v.use]); on && old[v.value] != "0" {
+			options[v.id] = old[v.value]
+		}
+	}
+	options["fpssmoothing"] = ""
+	if on, _ := strconv.ParseBool(old["fpssmoothing"]); on {
+		options["fpssmoothing"] = "true"
+	}
+	exp.Settings["experimental"] = options
+}
+
+func encodeSettingsExport(exp *SettingsExport, asTOML bool) ([]byte, error) {
+	if !asTOML {
+		return json.MarshalIndent(exp, "", "  ")
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(exp); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encryptExportedAccount(core *QCCoreSettings, passphrase string) (*ExportedCredentials, error) {
+	if len(passphrase) < minExportPassphrase {
+		return nil, &usageError{emsg: fmt.Sprintf("The passphrase must be at least %d characters", minExportPassphrase)}
+	}
+	if core.Username == "" || core.Password == "" {
+		return nil, errors.New("No saved username and password to export")
+	}
+	salt := make([]byte, exportSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(&exportedAccount{Username: core.Username, Password: core.Password})
+	if err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(passphrase), salt, exportKDFTime, exportKDFMemory, exportKDFThreads, 32)
+	enc, err := encrypt(string(plain), &key)
+	if err != nil {
+		return nil, err
+	}
+	return &ExportedCredentials{
+		KDF:     exportKDF,
+		Time:    exportKDFTime,
+		Memory:  exportKDFMemory,
+		Threads: exportKDFThreads,
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		Data:    base64.StdEncoding.EncodeToString([]byte(enc)),
+	}, nil
+}
+
+func decryptExportedAccount(c *ExportedCredentials, passphrase string) (*exportedAccount, error) {
+	if c.KDF != exportKDF {
+		return nil, &usageError{emsg: fmt.Sprintf("Unsupported key derivation: %s", c.KDF)}
+	}
+	if c.Time == 0 || c.Time > 16 || c.Memory == 0 || c.Memory > 1024*1024 || c.Threads == 0 {
+		return nil, &usageError{emsg: "The credentials in the settings file use unsupported key derivation settings"}
+	}
+	salt, err := base64.StdEncoding.DecodeString(c.Salt)
+	if err != nil {
+		return nil, &usageError{emsg: "The credentials in the settings file are damaged"}
+	}
+	data, err := base64.StdEncoding.DecodeString(c.Data)
+	if err != nil {
+		return nil, &usageError{emsg: "The credentials in the settings file are damaged"}
+	}
+	key := argon2.IDKey([]byte(passphrase), salt, c.Time, c.Memory, c.Threads, 32)
+	plain, err := decrypt(string(data), &key)
+	if err != nil {
+		return nil, &authFailedError{emsg: "Wrong passphrase for the credentials in the settings file"}
+	}
+	acct := &exportedAccount{}
+	if err = json.Unmarshal([]byte(plain), acct); err != nil {
+		return nil, &usageError{emsg: "The credentials in the settings file are damaged"}
+	}
+	return acct, nil
+}
+
+func splitSettingKey(name string) (string, string) {
+	i := strings.Index(name, ".")
+	return name[:i], name[i+1:]
+}
+
+func isTOMLFile(p string) bool {
+	return strings.EqualFold(filepath.Ext(p), ".toml")
+}
@@ -0,0 +1,277 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/syncore/qclauncher/logrotate"
+)
+
+type settingKey struct {
+	name     string
+	desc     string
+	readOnly bool
+	get      func(cfg *Configuration) string
+	set      func(cfg *Configuration, v string) error
+	save     func(cfg *Configuration) error
+}
+
+var settingKeys = []*settingKey{
+	{
+		name:     "profile.name",
+		desc:     "Profile in use (change it with the profiles command or -profile)",
+		readOnly: true,
+		get:      func(cfg *Configuration) string { return cfg.Profile.Name },
+	},
+	{
+		name: "profile.customargs",
+		desc: "Extra QC start-up options for this profile",
+		get:  func(cfg *Configuration) string { return cfg.Profile.CustomArgs },
+		set: func(cfg *Configuration, v string) error {
+			cfg.Profile.CustomArgs = strings.TrimSpace(v)
+			return nil
+		},
+		save: func(cfg *Configuration) error { return Save(cfg.Profile) },
+	},
+	{
+		name:     "core.username",
+		desc:     "Bethesda.net username (change it from the settings window)",
+		readOnly: true,
+		get:      func(cfg *Configuration) string { return cfg.Core.Username },
+	},
+	{
+		name: "core.filepath",
+		desc: "Location of QuakeChampions.exe",
+		get:  func(cfg *Configuration) string { return cfg.Core.FilePath },
+		set: func(cfg *Configuration, v string) error {
+			if !strings.Contains(strings.ToUpper(v), strings.ToUpper(QCExe)) {
+				return errors.New("Invalid QC EXE was specified")
+			}
+			cfg.Core.FilePath = v
+			return nil
+		},
+		save: saveCoreSettingsOnly,
+	},
+	{
+		name: "core.language",
+		desc: "Language code for the in-game QC interface",
+		get:  func(cfg *Configuration) string { return cfg.Core.Language },
+		set: func(cfg *Configuration, v string) error {
+			if v == "" {
+				return errors.New("QC language must be specified")
+			}
+			cfg.Core.Language = v
+			return nil
+		},
+		save: saveCoreSettingsOnly,
+	},
+	{
+		name: "core.tokenonly",
+		desc: "Keep only the auth token and ask for the password when it expires",
+		get:  func(cfg *Configuration) string { return strconv.FormatBool(cfg.Core.TokenOnly) },
+		set: func(cfg *Configuration, v string) error {
+			if err := setBool(&cfg.Core.TokenOnly, v); err != nil {
+				return err
+			}
+			if !cfg.Core.TokenOnly && cfg.Core.Password == "" {
+				return &usageError{emsg: "Enter your password in the settings window to stop using token-only mode"}
+			}
+			return nil
+		},
+		save: saveCoreSettingsOnly,
+	},
+	{
+		name: "core.secretstore",
+		desc: fmt.Sprintf("Where the username, password and token are kept: %s, %s or %s", SecretStoreDataFile,
+			SecretStoreWinCred, SecretStoreSecretService),
+		get: func(cfg *Configuration) string { return cfg.Core.SecretStore },
+		set: func(cfg *Configuration, v string) error {
+			v = strings.ToLower(v)
+			if !isSecretStore(v) {
+				return &usageError{emsg: fmt.Sprintf("Unknown credential store: %s", v)}
+			}
+			cfg.Core.SecretStore = v
+			return nil
+		},
+		save: saveCoreSettingsOnly,
+	},
+	{
+		name: "launcher.autostart",
+		desc: "Skip the QCLauncher UI and start QC immediately",
+		get:  func(cfg *Configuration) string { return strconv.FormatBool(cfg.Launcher.AutoStartQC) },
+		set:  func(cfg *Configuration, v string) error { return setBool(&cfg.Launcher.AutoStartQC, v) },
+		save: saveLauncherSettingsOnly,
+	},
+	{
+		name: "launcher.exitonlaunch",
+		desc: "Exit QCLauncher after launching QC",
+		get:  func(cfg *Configuration) string { return strconv.FormatBool(cfg.Launcher.ExitOnLaunch) },
+		set:  func(cfg *Configuration, v string) error { return setBool(&cfg.Launcher.ExitOnLaunch, v) },
+		save: saveLauncherSettingsOnly,
+	},
+	{
+		name: "launcher.minimizeonlaunch",
+		desc: "Minimize QCLauncher after launching QC",
+		get:  func(cfg *Configuration) string { return strconv.FormatBool(cfg.Launcher.MinimizeOnLaunch) },
+		set:  func(cfg *Configuration, v string) error { return setBool(&cfg.Launcher.MinimizeOnLaunch, v) },
+		save: saveLauncherSettingsOnly,
+	},
+	{
+		name: "launcher.minimizetotray",
+		desc: "Minimize QCLauncher to the system tray instead of the taskbar",
+		get:  func(cfg *Configuration) string { return strconv.FormatBool(cfg.Launcher.MinimizeToTray) },
+		set:  func(cfg *Configuration, v string) error { return setBool(&cfg.Launcher.MinimizeToTray, v) },
+		save: saveLauncherSettingsOnly,
+	},
+	{
+		name: "launcher.logmaxsize",
+		desc: "Size in MB at which qclauncher.log is rotated (0 uses the default)",
+		get:  func(cfg *Configuration) string { return strconv.Itoa(cfg.Launcher.LogMaxSizeMB) },
+		set: func(cfg *Configuration, v string) error {
+			return setInt(&cfg.Launcher.LogMaxSizeMB, v, 0, logrotate.LimitMaxSizeMB)
+		},
+		save: saveLauncherSettingsOnly,
+	},
+	{
+		name: "launcher.logmaxage",
+		desc: "Days to keep rotated log files (0 uses the default)",
+		get:  func(cfg *Configuration) string { return strconv.Itoa(cfg.Launcher.LogMaxAgeDays) },
+		set: func(cfg *Configuration, v string) error {
+			return setInt(&cfg.Launcher.LogMaxAgeDays, v, 0, logrotate.LimitMaxAgeDays)
+		},
+		save: saveLauncherSettingsOnly,
+	},
+	{
+		name: "launcher.logmaxbackups",
+		desc: "Number of rotated log files to keep (0 uses the default)",
+		get:  func(cfg *Configuration) string { return strconv.Itoa(cfg.Launcher.LogMaxBackups) },
+		set: func(cfg *Configuration, v string) error {
+			return setInt(&cfg.Launcher.LogMaxBackups, v, 0, logrotate.LimitMaxBackups)
+		},
+		save: saveLauncherSettingsOnly,
+	},
+	{
+		name: "launcher.logcompress",
+		desc: "Compress rotated log files with gzip",
+		get:  func(cfg *Configuration) string { return strconv.FormatBool(cfg.Launcher.LogCompress) },
+		set:  func(cfg *Configuration, v string) error { return setBool(&cfg.Launcher.LogCompress, v) },
+		save: saveLauncherSettingsOnly,
+	},
+}
+
+var (
+	allSettingKeys     []*settingKey
+	allSettingKeysOnce sync.Once
+)
+
+// getSettingKeys returns settingKeys with a key for each option in the QC options catalog, e.g.
+// experimental.maxfps. An empty value turns the option off.
+func getSettingKeys() []*settingKey {
+	allSettingKeysOnce.Do(func() {
+		for _, k := range settingKeys {
+			if strings.HasPrefix(k.name, "launcher.") && len(allSettingKeys) > 0 &&
+				!strings.HasPrefix(allSettingKeys[len(allSettingKeys)-1].name, "launcher.") {
+				allSettingKeys = append(allSettingKeys, newOptionSettingKeys()...)
+			}
+			allSettingKeys = append(allSettingKeys, k)
+		}
+	})
+	return allSettingKeys
+}
+
+func newOptionSettingKeys() []*settingKey {
+	var keys []*settingKey
+	for _, opt := range getOptionsCatalog().Options {
+		o := opt
+		desc := o.Description
+		if o.Removed {
+			desc += " (removed from the game)"
+		}
+		keys = append(keys, &settingKey{
+			name: "experimental." + o.ID,
+			desc: desc,
+			get:  func(cfg *Configuration) string { return cfg.Experimental.Options[o.ID] },
+			set: func(cfg *Configuration, v string) error {
+				if v == "" {
+					delete(cfg.Experimental.Options, o.ID)
+					return nil
+				}
+				if err := o.validate(v); err != nil {
+					return &usageError{emsg: err.Error()}
+				}
+				if cfg.Experimental.Options == nil {
+					cfg.Experimental.Options = map[string]string{}
+				}
+				cfg.Experimental.Options[o.ID] = v
+				return nil
+			},
+			save: saveExperimentalSettingsOnly,
+		})
+	}
+	return keys
+}
+
+func getSettingKey(name string) (*settingKey, error) {
+	for _, k := range getSettingKeys() {
+		if strings.EqualFold(k.name, name) {
+			return k, nil
+		}
+	}
+	return nil, &usageError{emsg: fmt.Sprintf("Unknown setting: %s", name)}
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return &usageError{emsg: fmt.Sprintf("Expected true or false, got: %s", v)}
+	}
+	*dst = b
+	return nil
+}
+
+func setInt(dst *int, v string, min, max int) error {
+	i, err := strconv.Atoi(v)
+	if err != nil || i < min || i > max {
+		return &usageError{emsg: fmt.Sprintf("Expected a number between %d and %d, got: %s", min, max, v)}
+	}
+	*dst = i
+	return nil
+}
+
+func saveCoreSettingsOnly(cfg *Configuration) error {
+	// credentials are unchanged, so skip account validation and keep the existing token & FP (see validateAccount)
+	tmpKey = genKey()
+	tmpToken = cfg.Auth.Token
+	tmpFp = cfg.Core.FP
+	return Save(cfg.Core)
+}
+
+func saveExperimentalSettingsOnly(cfg *Configuration) error {
+	if err := cfg.Experimental.validate(); err != nil {
+		return err
+	}
+	return saveProfileSettings(cfg, true, false)
+}
+
+func saveLauncherSettingsOnly(cfg *Configuration) error {
+	if err := cfg.Launcher.validate(); err != nil {
+		return err
+	}
+	if cfg.Launcher.AutoStartQC && (cfg.Launcher.ExitOnLaunch || cfg.Launcher.MinimizeOnLaunch) {
+		return errors.New("Auto-start cannot be combined with exit or minimize on launch")
+	}
+	if cfg.Launcher.ExitOnLaunch && cfg.Launcher.MinimizeOnLaunch {
+		return errors.New("Exit on launch cannot be combined with minimize on launch")
+	}
+	if err := saveProfileSettings(cfg, false, true); err != nil {
+		return err
+	}
+	applyLogRotation(cfg.Launcher)
+	return nil
+}
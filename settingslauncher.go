@@ -4,13 +4,10 @@
 package qclauncher
 
 import (
-	"bytes"
-	"encoding/binary"
-	"encoding/gob"
 	"errors"
 	"fmt"
 
-	bolt "github.com/coreos/bbolt"
+	"github.com/syncore/qclauncher/logrotate"
 )
 
 type LauncherSettings struct {
@@ -19,61 +16,60 @@ type LauncherSettings struct {
 	MinimizeOnLaunch  bool
 	MinimizeToTray    bool
 	SetAsNonSteamGame bool
+	LogMaxSizeMB      int
+	LogMaxAgeDays     int
+	LogMaxBackups     int
+	LogCompress       bool
 }
 
 func (s *LauncherSettings) get(ls *LauncherStore) error {
 	ls.checkDataFile(false)
-	if err := ls.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketSettings))
-		decerr := s.decode(b.Get([]byte(keyLauncherSettings)))
-		if decerr != nil {
-			logger.Errorw(fmt.Sprintf("%s: error decoding launcher settings from datastore during get operation", GetCaller()),
-				"error", decerr)
-		}
-		return nil
-	}); err != nil {
+	if err := ls.View(s.read); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error getting launcher settings from datastore", GetCaller()), "error", err)
 		return err
 	}
 	return nil
 }
 
+func (s *LauncherSettings) read(tx DataTx) error {
+	data := tx.Bucket([]byte(bucketSettings)).Get([]byte(keyLauncherSettings))
+	if data == nil {
+		return nil // not saved yet; the defaults apply
+	}
+	if err := s.decode(data); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding launcher settings from datastore during get operation", GetCaller()),
+			"error", err)
+		return err
+	}
+	return nil
+}
+
 func (s *LauncherSettings) save(ls *LauncherStore) error {
-	return ls.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error creating settings bucket in datastore during save operation",
-				GetCaller()), "error", err)
-			return err
-		}
-		encoded, err := s.encode()
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error encoding launcher settings during datastore save operation", GetCaller()),
-				"error", err)
-			return err
-		}
-		if err = b.Put([]byte(keyLauncherSettings), encoded); err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error saving encoded launcher settings to datastore", GetCaller()), "error", err)
-			return err
-		}
-		b, err = tx.CreateBucketIfNotExists([]byte(bucketLastUpdate))
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error creating update bucket for saving data file version to datastore", GetCaller()),
-				"error", err)
-			return err
-		}
-		dfv := make([]byte, 8)
-		binary.LittleEndian.PutUint64(dfv, uint64(dataFileVersion))
-		if err = b.Put([]byte(keyDfVer), dfv); err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error saving data file version to datastore", GetCaller()), "error", err)
-			return err
-		}
-		return nil
-	})
+	return ls.Update(s.write)
+}
+
+func (s *LauncherSettings) write(tx DataTx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating settings bucket in datastore during save operation",
+			GetCaller()), "error", err)
+		return err
+	}
+	encoded, err := s.encode()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error encoding launcher settings during datastore save operation", GetCaller()),
+			"error", err)
+		return err
+	}
+	if err = b.Put([]byte(keyLauncherSettings), encoded); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving encoded launcher settings to datastore", GetCaller()), "error", err)
+		return err
+	}
+	return putDataFileVersion(tx)
 }
 
 func (s *LauncherSettings) decode(data []byte) error {
-	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&s); err != nil {
+	if err := decodeRecord(data, &s); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error decoding launcher settings data", GetCaller()), "error", err)
 		return err
 	}
@@ -81,17 +77,28 @@ func (s *LauncherSettings) decode(data []byte) error {
 }
 
 func (s *LauncherSettings) encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	if err := gob.NewEncoder(buf).Encode(s); err != nil {
+	data, err := encodeRecord(s)
+	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error encoding launcher settings data", GetCaller()), "error", err)
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return data, nil
 }
 
 func (s *LauncherSettings) validate() error {
 	if s == nil {
 		return errors.New("Launcher setting info was not entered")
 	}
-	return nil
+	return s.logRotation().Validate()
+}
+
+func (s *LauncherSettings) logRotation() *logrotate.Rotation {
+	return &logrotate.Rotation{MaxSizeMB: s.LogMaxSizeMB, MaxAgeDays: s.LogMaxAgeDays, MaxBackups: s.LogMaxBackups, Compress: s.LogCompress}
+}
+
+func applyLogRotation(s *LauncherSettings) {
+	if s == nil {
+		return
+	}
+	logrotate.Configure(getLogFilePath(), s.logRotation())
 }
@@ -0,0 +1,148 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	SignatureExt      = ".sig"
+	maxSignatureBytes = 1024
+)
+
+// remotePublicKey verifies the documents served from qc.syncore.org. They are signed with cmd/qclsign.
+var remotePublicKey = "gazJXC4gLF2/UHZoHgrOxAhqvPYVRm6LofjMkCH5+BE="
+
+// signedPayload is a remote document that passed signature verification, kept as the last known good copy.
+type signedPayload struct {
+	Data      []byte
+	Signature []byte
+}
+
+var signedResponses = map[remoteResponseType]string{
+	rrUpdateQC:            "rqc",
+	rrUpdateLauncher:      "rlch",
+	rrEntitlementCheckAPI: "rent",
+}
+
+func isSignedResponse(rt remoteResponseType) bool {
+	_, ok := signedResponses[rt]
+	return ok
+}
+
+// verifySignature checks a detached signature file's contents (base64 on one line) against data.
+func verifySignature(data, sigFile []byte) ([]byte, error) {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigFile)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, &signatureError{emsg: "Malformed signature"}
+	}
+	pub, err := base64.StdEncoding.DecodeString(remotePublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		panic(fmt.Errorf("Built-in signing key is invalid"))
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), data, sig) {
+		return nil, &signatureError{emsg: "Signature does not match"}
+	}
+	return sig, nil
+}
+
+// verifyRemote downloads the signature published next to addr and checks data against it.
+func (lc *launcherClient) verifyRemote(addr string, data []byte) ([]byte, error) {
+	res, err := lc.Get(addr + SignatureExt)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error requesting signature", GetCaller()), "error", err, "url", addr+SignatureExt)
+		return nil, &signatureError{emsg: fmt.Sprintf("Unable to get signature: %s", err)}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, &signatureError{emsg: fmt.Sprintf("Unsigned response (signature status code: %d)", res.StatusCode)}
+	}
+	sig, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSignatureBytes))
+	if err != nil {
+		return nil, &signatureError{emsg: fmt.Sprintf("Unable to read signature: %s", err)}
+	}
+	return verifySignature(data, sig)
+}
+
+// checkSignedResponse returns the body to parse for a signed response type: body itself when its signature
+// is valid, otherwise the last known good copy.
+func (lc *launcherClient) checkSignedResponse(rt remoteResponseType, addr string, body []byte) ([]byte, bool, error) {
+	sig, err := lc.verifyRemote(addr, body)
+	if err == nil {
+		if serr := saveLastKnownGood(rt, &signedPayload{Data: body, Signature: sig}); serr != nil {
+			logger.Errorw(fmt.Sprintf("%s: error saving last known good response", GetCaller()), "error", serr)
+		}
+		return body, false, nil
+	}
+	logger.Errorw(fmt.Sprintf("%s: rejected response with missing or invalid signature", GetCaller()), "error", err,
+		"url", addr)
+	lkg, lerr := getLastKnownGood(rt)
+	if lerr != nil || lkg == nil {
+		return nil, false, err
+	}
+	logger.Infow("using last known good response", "url", addr)
+	return lkg.Data, true, nil
+}
+
+func saveLastKnownGood(rt remoteResponseType, p *signedPayload) error {
+	if !DataStoreExists() {
+		return nil // nothing configured yet
+	}
+	data, err := encodeRecord(p)
+	if err != nil {
+		return err
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return err
+	}
+	defer ls.Close()
+	return ls.Update(func(tx DataTx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketRemote))
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error creating remote response bucket", GetCaller()), "error", err)
+			return err
+		}
+		return b.Put([]byte(signedResponses[rt]), data)
+	})
+}
+
+// getLastKnownGood returns nil if there is no stored copy. Stored copies are verified again when read.
+func getLastKnownGood(rt remoteResponseType) (*signedPayload, error) {
+	if !DataStoreExists() {
+		return nil, nil
+	}
+	ls, err := newLauncherDataStore()
+	if err != nil {
+		return nil, err
+	}
+	defer ls.Close()
+	var data []byte
+	if err = ls.View(func(tx DataTx) error {
+		if b := tx.Bucket([]byte(bucketRemote)); b != nil {
+			data = append([]byte(nil), b.Get([]byte(signedResponses[rt]))...)
+		}
+		return nil
+	}); err != nil || len(data) == 0 {
+		return nil, err
+	}
+	p := &signedPayload{}
+	if err = decodeRecord(data, p); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding last known good response", GetCaller()), "error", err)
+		return nil, err
+	}
+	if _, err = verifySignature(p.Data, []byte(base64.StdEncoding.EncodeToString(p.Signature))); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: stored last known good response failed verification", GetCaller()), "error", err)
+		return nil, err
+	}
+	return p, nil
+}
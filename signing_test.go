@@ -0,0 +1,133 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// useSigningKey replaces the built-in public key with a new one for the length of the test and returns the
+// matching private key.
+func useSigningKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := remotePublicKey
+	remotePublicKey = base64.StdEncoding.EncodeToString(pub)
+	t.Cleanup(func() { remotePublicKey = prev })
+	return priv
+}
+
+func signTest(priv ed25519.PrivateKey, data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data)) + "\n"
+}
+
+// serveSignature serves sig as the signature of every document, or a 404 if sig is empty.
+func serveSignature(t *testing.T, sig string) (*launcherClient, string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sig == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(sig))
+	}))
+	t.Cleanup(srv.Close)
+	return &launcherClient{srv.Client()}, srv.URL + "/qcl_latest_version.json"
+}
+
+// useSigningStore gives the test an empty data file in memory to keep last known good copies in.
+func useSigningStore(t *testing.T) {
+	t.Helper()
+	useMemoryStore(t, nil)
+	t.Cleanup(func() { closeDataStore() })
+	if err := createBuckets(&memoryStore{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	priv := useSigningKey(t)
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"version":"1.0"}`)
+	if _, err := verifySignature(data, []byte(signTest(priv, data))); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	tests := map[string]string{
+		"wrong key":    signTest(other, data),
+		"other data":   signTest(priv, []byte(`{"version":"9.9"}`)),
+		"not base64":   "not a signature",
+		"wrong length": base64.StdEncoding.EncodeToString([]byte("short")),
+		"empty":        "",
+	}
+	for name, sig := range tests {
+		if _, err := verifySignature(data, []byte(sig)); !IsErrSignature(err) {
+			t.Errorf("%s: expected a signature error, got %v", name, err)
+		}
+	}
+}
+
+func TestCheckSignedResponse(t *testing.T) {
+	priv := useSigningKey(t)
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := []byte(`{"version":"1.0"}`)
+	forged := []byte(`{"version":"6.6"}`)
+
+	t.Run("unsigned without copy", func(t *testing.T) {
+		useSigningStore(t)
+		lc, addr := serveSignature(t, "")
+		if _, _, err := lc.checkSignedResponse(rrUpdateQC, addr, forged); !IsErrSignature(err) {
+			t.Fatalf("expected an unsigned response to be rejected, got %v", err)
+		}
+	})
+	t.Run("wrongly signed without copy", func(t *testing.T) {
+		useSigningStore(t)
+		lc, addr := serveSignature(t, signTest(other, forged))
+		if _, _, err := lc.checkSignedResponse(rrUpdateQC, addr, forged); !IsErrSignature(err) {
+			t.Fatalf("expected a wrongly signed response to be rejected, got %v", err)
+		}
+	})
+	t.Run("last known good", func(t *testing.T) {
+		useSigningStore(t)
+		lc, addr := serveSignature(t, signTest(priv, good))
+		body, lkg, err := lc.checkSignedResponse(rrUpdateQC, addr, good)
+		if err != nil || lkg || string(body) != string(good) {
+			t.Fatalf("signed response: got %q %v %v", body, lkg, err)
+		}
+		for name, sig := range map[string]string{"unsigned": "", "wrongly signed": signTest(other, forged)} {
+			lc, addr := serveSignature(t, sig)
+			body, lkg, err := lc.checkSignedResponse(rrUpdateQC, addr, forged)
+			if err != nil || !lkg || string(body) != string(good) {
+				t.Errorf("%s: expected the last known good copy, got %q %v %v", name, body, lkg, err)
+			}
+		}
+		lc, addr = serveSignature(t, "")
+		if _, _, err := lc.checkSignedResponse(rrUpdateLauncher, addr, forged); !IsErrSignature(err) {
+			t.Errorf("another document's copy was used: %v", err)
+		}
+	})
+	t.Run("tampered copy", func(t *testing.T) {
+		useSigningStore(t)
+		putRaw(t, bucketRemote, signedResponses[rrUpdateQC], &signedPayload{Data: forged,
+			Signature: ed25519.Sign(other, forged)})
+		lc, addr := serveSignature(t, "")
+		if _, _, err := lc.checkSignedResponse(rrUpdateQC, addr, forged); !IsErrSignature(err) {
+			t.Fatalf("expected a stored copy that fails verification to be ignored, got %v", err)
+		}
+	})
+}
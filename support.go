@@ -0,0 +1,231 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	DefSupportLogLines = 500
+	supportFpPrefixLen = 6
+)
+
+type supportConfigDump struct {
+	UsernameSHA256 string                  `json:"usernameSha256"`
+	PasswordSet    bool                    `json:"passwordSet"`
+	TokenSet       bool                    `json:"tokenSet"`
+	FP             string                  `json:"fp"`
+	FilePath       string                  `json:"filePath"`
+	Language       string                  `json:"language"`
+	Profile        string                  `json:"profile"`
+	CustomArgs     string                  `json:"customArgs,omitempty"`
+	Accounts       int                     `json:"accounts"`
+	Experimental   *QCExperimentalSettings `json:"experimental"`
+	Launcher       *LauncherSettings       `json:"launcher"`
+	Error          string                  `json:"error,omitempty"`
+}
+
+type supportFile struct {
+	name string
+	data func() ([]byte, error)
+}
+
+type supportVersionInfo struct {
+	Version            string `json:"version"`
+	XAppVer            string `json:"xAppVer"`
+	XLibVer            string `json:"xLibVer"`
+	DataFileVersion    int64  `json:"dataFileVersion"`
+	GoVersion          string `json:"goVersion"`
+	Debug              bool   `json:"debug"`
+	Local              bool   `json:"local"`
+	UseEntitlementAPI  bool   `json:"useEntitlementAPI"`
+	FPOverride         bool   `json:"fpOverride"`
+	CustomArgsAppended bool   `json:"customArgsAppended"`
+}
+
+// CreateSupportBundle writes a zip file that can be attached to a GitHub issue. Credentials are never included.
+func CreateSupportBundle(dest string, logLines int) (string, error) {
+	return createSupportBundle(dest, logLines, nil)
+}
+
+func createSupportBundle(dest string, logLines int, report *DoctorReport) (string, error) {
+	if dest == "" {
+		dest = filepath.Join(getExecutingPath(), fmt.Sprintf("qclauncher-support-%s.zip", time.Now().Format("20060102-150405")))
+	}
+	if logLines <= 0 {
+		logLines = DefSupportLogLines
+	}
+	// read before running the doctor, whose own requests would otherwise replace the saved transcript
+	requests, terr := GetRequestTranscript()
+	if terr != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading request transcript", GetCaller()), "error", terr)
+	}
+	if report == nil {
+		report = RunDoctor()
+	}
+	var cfg *Configuration
+	if DataStoreExists() && !report.dataFileFailed() {
+		var err error
+		if cfg, err = GetConfiguration(); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error reading configuration for support bundle", GetCaller()), "error", err)
+		}
+	}
+	secrets := getSecretValues(cfg)
+	f, err := os.Create(dest)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating support bundle file", GetCaller()), "error", err)
+		return "", err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	files := []supportFile{
+		{"doctor.txt", func() ([]byte, error) { return []byte(report.String()), nil }},
+		{"doctor.json", func() ([]byte, error) { return json.MarshalIndent(report, "", "  ") }},
+		{"config.json", func() ([]byte, error) { return json.MarshalIndent(newSupportConfigDump(cfg), "", "  ") }},
+		{"version.json", func() ([]byte, error) { return json.MarshalIndent(newSupportVersionInfo(), "", "  ") }},
+		{LogFile, func() ([]byte, error) { return tailLogFile(logLines, secrets) }},
+	}
+	if len(requests) != 0 {
+		files = append(files, supportFile{TranscriptFile, func() ([]byte, error) {
+			j, err := json.MarshalIndent(requests, "", "  ")
+			return []byte(redactSecretValues(string(j), secrets)), err
+		}})
+	}
+	for _, sf := range files {
+		data, err := sf.data()
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error collecting support bundle file", GetCaller()), "file", sf.name, "error", err)
+			data = []byte(fmt.Sprintf("Unable to collect %s: %s", sf.name, err))
+		}
+		w, err := zw.Create(sf.name)
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error adding file to support bundle", GetCaller()), "file", sf.name, "error", err)
+			return "", err
+		}
+		if _, err = w.Write(data); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error writing file to support bundle", GetCaller()), "file", sf.name, "error", err)
+			return "", err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error finalizing support bundle", GetCaller()), "error", err)
+		return "", err
+	}
+	return dest, nil
+}
+
+func (r *DoctorReport) dataFileFailed() bool {
+	for _, c := range r.Checks {
+		if c.Name == doctorCheckDataFile {
+			return c.Result != doctorPass
+		}
+	}
+	return true
+}
+
+func newSupportConfigDump(cfg *Configuration) *supportConfigDump {
+	if cfg == nil {
+		return &supportConfigDump{Error: "Settings are not available"}
+	}
+	d := &supportConfigDump{
+		PasswordSet:  cfg.Core.Password != "",
+		TokenSet:     cfg.Auth != nil && cfg.Auth.Token != "",
+		FP:           truncateSecret(cfg.Core.FP, supportFpPrefixLen),
+		FilePath:     cfg.Core.FilePath,
+		Language:     cfg.Core.Language,
+		Experimental: cfg.Experimental,
+		Launcher:     cfg.Launcher,
+	}
+	if cfg.Profile != nil {
+		d.Profile, d.CustomArgs = cfg.Profile.Name, cfg.Profile.CustomArgs
+	}
+	if cfg.Core.Username != "" {
+		d.UsernameSHA256 = fmt.Sprintf("%x", sha256.Sum256([]byte(strings.ToLower(cfg.Core.Username))))
+	}
+	if names, _, err := GetAccounts(); err == nil {
+		d.Accounts = len(names)
+	}
+	return d
+}
+
+func newSupportVersionInfo() *supportVersionInfo {
+	return &supportVersionInfo{
+		Version:            fmt.Sprintf("%.2f", version),
+		XAppVer:            ConfXAppVer,
+		XLibVer:            ConfXLibVer,
+		DataFileVersion:    dataFileVersion,
+		GoVersion:          runtime.Version(),
+		Debug:              ConfDebug,
+		Local:              ConfLocal,
+		UseEntitlementAPI:  UseEntitlementAPI,
+		FPOverride:         isFPOverride(),
+		CustomArgsAppended: ConfAppendCustomArgs != "",
+	}
+}
+
+func getSecretValues(cfg *Configuration) []string {
+	var secrets []string
+	if isFPOverride() {
+		secrets = append(secrets, ConfXSrcFp)
+	}
+	if cfg == nil {
+		return secrets
+	}
+	secrets = append(secrets, cfg.Core.Username, cfg.Core.Password, cfg.Core.FP)
+	if cfg.Auth != nil {
+		secrets = append(secrets, cfg.Auth.Token)
+	}
+	return secrets
+}
+
+func redactSecretValues(s string, secrets []string) string {
+	for _, v := range secrets {
+		if len(v) < 3 { // too short to be distinguishable from ordinary text
+			continue
+		}
+		s = strings.Replace(s, v, redactedValue, -1)
+	}
+	return s
+}
+
+func truncateSecret(s string, n int) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) <= n {
+		return redactedValue
+	}
+	return s[:n] + "..."
+}
+
+func tailLogFile(n int, secrets []string) ([]byte, error) {
+	f, err := os.Open(getLogFilePath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines := make([]string, 0, n)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if len(lines) == n {
+			lines = lines[1:]
+		}
+		lines = append(lines, sc.Text())
+	}
+	if err = sc.Err(); err != nil {
+		return nil, err
+	}
+	return []byte(redactSecretValues(strings.Join(lines, "\n"), secrets)), nil
+}
@@ -4,15 +4,45 @@
 package qclauncher
 
 import (
-	"bytes"
-	"encoding/gob"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-
-	bolt "github.com/coreos/bbolt"
+	"time"
 )
 
+// TokenAuth is the auth token, which is kept in the secret store, and what is known about it, which is kept
+// in the data file. Data files before version 7 saved the token encrypted under keyTokenAuth.
 type TokenAuth struct {
-	Token string
+	Token      string
+	IssuedAt   time.Time // zero if unknown, e.g. for a token that was stored before these were tracked
+	VerifiedAt time.Time // last time Bethesda.net accepted the token
+	SessionID  string
+	Services   ServiceTokens
+}
+
+// ServiceTokens are the other credentials Bethesda.net returns alongside the auth token, for the endpoints
+// that need them; launcherClient.serviceTokens returns them. Bethesda.net has no endpoint that refreshes them
+// on their own: each auth and verify response replaces them.
+type ServiceTokens struct {
+	OAuthToken       string
+	BeamClientAPIKey string
+	BeamToken        []string
+}
+
+// serviceTokensSecret is how ServiceTokens are kept in the secret store. TokenHash ties them to the auth
+// token they came with, so that they are dropped along with it.
+type serviceTokensSecret struct {
+	TokenHash string
+	ServiceTokens
+}
+
+// tokenInfo is the data file record of a TokenAuth. TokenHash ties it to the token in the secret store.
+type tokenInfo struct {
+	TokenHash  string
+	IssuedAt   time.Time
+	VerifiedAt time.Time
+	SessionID  string
 }
 
 type TokenKey struct {
@@ -21,72 +51,158 @@ type TokenKey struct {
 
 func (t *TokenAuth) get(ls *LauncherStore) error {
 	ls.checkDataFile(false)
-	if err := ls.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketSettings))
-		decerr := t.decode(b.Get([]byte(keyTokenAuth)), b.Get([]byte(keyTokenKey)))
-		if decerr != nil {
-			logger.Errorw(fmt.Sprintf("%s: error decoding auth token from datastore during get operation", GetCaller()),
-				"error", decerr)
-			return decerr
-		}
-		return nil
-	}); err != nil {
+	if err := unlockCredentials(); err != nil {
+		return err
+	}
+	if err := ls.View(t.read); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error getting auth token from datastore", GetCaller()), "error", err)
 		return err
 	}
 	return nil
 }
 
+func (t *TokenAuth) read(tx DataTx) error {
+	ss, err := tokenSecretStore(tx)
+	if err != nil {
+		return err
+	}
+	if t.Token, err = ss.Get(secretToken); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading auth token from secret store during get operation", GetCaller()),
+			"error", err)
+		return err
+	}
+	info, err := readTokenInfo(tx)
+	if err != nil {
+		return err
+	}
+	if info != nil && t.Token != "" && info.TokenHash == tokenHash(t.Token) {
+		t.IssuedAt, t.VerifiedAt, t.SessionID = info.IssuedAt, info.VerifiedAt, info.SessionID
+	}
+	return t.readServices(ss)
+}
+
+func (t *TokenAuth) readServices(ss SecretStore) error {
+	t.Services = ServiceTokens{}
+	data, err := ss.Get(secretServiceTokens)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading service tokens from secret store", GetCaller()), "error", err)
+		return err
+	}
+	if data == "" || t.Token == "" {
+		return nil
+	}
+	saved := &serviceTokensSecret{}
+	if err = json.Unmarshal([]byte(data), saved); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding service tokens", GetCaller()), "error", err)
+		return err
+	}
+	if saved.TokenHash == tokenHash(t.Token) {
+		t.Services = saved.ServiceTokens
+	}
+	return nil
+}
+
 func (t *TokenAuth) save(ls *LauncherStore) error {
-	return ls.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error creating settings bucket in datastore during save operation",
-				GetCaller()), "error", err)
-			return err
-		}
-		key := b.Get([]byte(keyTokenKey))
-		encoded, err := t.encode(key)
-		if err != nil {
-			logger.Errorw(fmt.Sprintf("%s: error encoding auth token during datastore save operation", GetCaller()),
-				"error", err)
+	return ls.Update(t.write)
+}
+
+func (t *TokenAuth) write(tx DataTx) error {
+	ss, err := tokenSecretStore(tx)
+	if err != nil {
+		return err
+	}
+	if err = setSecret(ss, secretToken, t.Token); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving auth token to secret store", GetCaller()), "error", err)
+		return err
+	}
+	var services []byte
+	if t.Token != "" && !t.Services.empty() {
+		if services, err = json.Marshal(&serviceTokensSecret{TokenHash: tokenHash(t.Token), ServiceTokens: t.Services}); err != nil {
 			return err
 		}
-		return b.Put([]byte(keyTokenAuth), encoded)
-	})
+	}
+	if err = setSecret(ss, secretServiceTokens, string(services)); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving service tokens to secret store", GetCaller()), "error", err)
+		return err
+	}
+	return t.writeInfo(tx)
+}
+
+func (s *ServiceTokens) empty() bool {
+	return s.OAuthToken == "" && s.BeamClientAPIKey == "" && len(s.BeamToken) == 0
+}
+
+func (s *ServiceTokens) secrets() []string {
+	return append([]string{s.OAuthToken, s.BeamClientAPIKey}, s.BeamToken...)
 }
 
-func (t *TokenAuth) decode(data, key []byte) error {
-	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&t); err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error decoding auth token data", GetCaller()), "error", err)
+func (t *TokenAuth) writeInfo(tx DataTx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
+	if err != nil {
 		return err
 	}
-	qcDecToken, err := decrypt(t.Token, &key)
+	if t.Token == "" {
+		return b.Delete([]byte(keyTokenInfo))
+	}
+	encoded, err := encodeRecord(&tokenInfo{TokenHash: tokenHash(t.Token), IssuedAt: t.IssuedAt, VerifiedAt: t.VerifiedAt,
+		SessionID: t.SessionID})
 	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error decrypting auth token credential", GetCaller()), "error", err)
+		logger.Errorw(fmt.Sprintf("%s: error encoding auth token info", GetCaller()), "error", err)
 		return err
 	}
-	t.Token = qcDecToken
-	return nil
+	return b.Put([]byte(keyTokenInfo), encoded)
 }
 
-func (t *TokenAuth) encode(existingKey []byte) ([]byte, error) {
-	buf := new(bytes.Buffer)
-	encToken, err := encrypt(t.Token, &existingKey)
-	if err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error encrypting auth token credential", GetCaller()), "error", err)
+func readTokenInfo(tx DataTx) (*tokenInfo, error) {
+	b := tx.Bucket([]byte(bucketSettings))
+	if b == nil {
+		return nil, nil
+	}
+	data := b.Get([]byte(keyTokenInfo))
+	if data == nil {
+		return nil, nil
+	}
+	info := &tokenInfo{}
+	if err := decodeRecord(data, info); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error decoding auth token info", GetCaller()), "error", err)
 		return nil, err
 	}
-	t.Token = encToken
-	if err = gob.NewEncoder(buf).Encode(t); err != nil {
-		logger.Errorw(fmt.Sprintf("%s: error encoding auth token data", GetCaller()), "error", err)
+	return info, nil
+}
+
+// writeTokenInfoFor saves the record for a token that was just written to the secret store. What is known
+// about the token is kept if it is the one that was already saved; otherwise it counts as issued at issued.
+func writeTokenInfoFor(tx DataTx, token, sessionID string, issued time.Time) error {
+	t := &TokenAuth{Token: token, IssuedAt: issued, VerifiedAt: issued, SessionID: sessionID}
+	info, err := readTokenInfo(tx)
+	if err != nil {
+		return err
+	}
+	if info != nil && token != "" && info.TokenHash == tokenHash(token) {
+		t.IssuedAt, t.VerifiedAt, t.SessionID = info.IssuedAt, info.VerifiedAt, info.SessionID
+	}
+	return t.writeInfo(tx)
+}
+
+func tokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:16])
+}
+
+// tokenSecretStore returns the secret store chosen in the saved core settings.
+func tokenSecretStore(tx DataTx) (SecretStore, error) {
+	core, err := readCoreRecord(tx)
+	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	if core == nil {
+		core = &QCCoreSettings{}
+	}
+	return openSecretStore(tx, core)
 }
 
 func (t *TokenKey) get(ls *LauncherStore) error {
-	if err := ls.View(func(tx *bolt.Tx) error {
+	if err := ls.View(func(tx DataTx) error {
 		b := tx.Bucket([]byte(bucketSettings))
 		decerr := t.decode(b.Get([]byte(keyTokenKey)))
 		if decerr != nil {
@@ -103,7 +219,7 @@ func (t *TokenKey) get(ls *LauncherStore) error {
 }
 
 func (t *TokenKey) save(ls *LauncherStore) error {
-	return ls.Update(func(tx *bolt.Tx) error {
+	return ls.Update(func(tx DataTx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(bucketSettings))
 		if err != nil {
 			logger.Errorw(fmt.Sprintf("%s: error creating settings bucket in datastore during save operation",
@@ -121,8 +237,7 @@ func (t *TokenKey) save(ls *LauncherStore) error {
 }
 
 func (t *TokenKey) decode(data []byte) error {
-	dec := gob.NewDecoder(bytes.NewBuffer(data))
-	if err := dec.Decode(&t); err != nil {
+	if err := decodeRecord(data, &t); err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error decoding credential key data", GetCaller()), "error", err)
 		return err
 	}
@@ -130,26 +245,45 @@ func (t *TokenKey) decode(data []byte) error {
 }
 
 func (t *TokenKey) encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	enc := gob.NewEncoder(buf)
-	err := enc.Encode(t)
+	data, err := encodeRecord(t)
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error encoding credential key data", GetCaller()), "error", err)
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return data, nil
 }
 
-func updateAuthToken(isPreSaveVerification bool, token string) error {
-	if isPreSaveVerification {
+// updateAuthToken saves the tokens from an auth or verify response. A verify response returns the token
+// that was sent, which only marks it as verified and refreshes the service tokens.
+func updateAuthToken(response *AuthResponse) error {
+	token, sessionID := response.Token, response.SessionID
+	services := response.serviceTokens()
+	addLogSecrets(token)
+	addLogSecrets(services.secrets()...)
+	if response.isPreSaveVerification {
 		// Data file won't exist on first-run credential verification; which is the entry point into
 		// the data store, so save token & key in temp vars so they will be applied when the core
-		// settings are saved.
+		// settings are saved. The service tokens are fetched again by the first verify.
 		tmpToken = token
+		tmpSessionID = sessionID
 		tmpKey = genKey()
 		return nil
 	}
-	return Save(&TokenAuth{Token: token})
+	now := time.Now()
+	t := &TokenAuth{Token: token, IssuedAt: now, VerifiedAt: now, SessionID: sessionID, Services: services}
+	prev := &TokenAuth{}
+	if err := Get(prev); err == nil && prev.Token == token {
+		if !prev.IssuedAt.IsZero() {
+			t.IssuedAt = prev.IssuedAt
+		}
+		if sessionID == "" {
+			t.SessionID = prev.SessionID
+		}
+		if services.empty() {
+			t.Services = prev.Services
+		}
+	}
+	return Save(t)
 }
 
 func clearAuthToken() error {
@@ -0,0 +1,102 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TranscriptFile        = "qcl.requests.json"
+	maxTranscriptRequests = 50
+	redactedValue         = "[REDACTED]"
+)
+
+type RequestTranscriptEntry struct {
+	Time          time.Time         `json:"time"`
+	Method        string            `json:"method"`
+	URL           string            `json:"url"`
+	Headers       map[string]string `json:"headers"`
+	StatusCode    int               `json:"statusCode"`
+	Duration      string            `json:"duration"`
+	ResponseBytes int               `json:"responseBytes"`
+	Error         string            `json:"error,omitempty"`
+}
+
+var (
+	transcriptMu sync.Mutex
+	transcript   []*RequestTranscriptEntry
+	// header values that identify the user or the machine are never written to the transcript
+	sensitiveHeaders = map[string]bool{
+		strings.ToLower(hkeyAuthorization): true,
+		strings.ToLower(hkeyXSrcFp):        true,
+	}
+)
+
+func newRequestTranscriptEntry(hr *http.Request) *RequestTranscriptEntry {
+	e := &RequestTranscriptEntry{Time: time.Now(), Method: hr.Method, URL: hr.URL.String(), Headers: map[string]string{}}
+	for k, v := range hr.Header {
+		if sensitiveHeaders[strings.ToLower(k)] {
+			e.Headers[k] = redactedValue
+			continue
+		}
+		e.Headers[k] = strings.Join(v, ", ")
+	}
+	return e
+}
+
+func recordRequest(e *RequestTranscriptEntry, err error) {
+	e.Duration = time.Since(e.Time).Round(time.Millisecond).String()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	transcript = append(transcript, e)
+	if len(transcript) > maxTranscriptRequests {
+		transcript = transcript[len(transcript)-maxTranscriptRequests:]
+	}
+	j, jerr := json.MarshalIndent(transcript, "", "  ")
+	if jerr != nil {
+		logger.Errorw(fmt.Sprintf("%s: error encoding request transcript", GetCaller()), "error", jerr)
+		return
+	}
+	if werr := ioutil.WriteFile(getTranscriptFilePath(), j, 0644); werr != nil {
+		logger.Errorw(fmt.Sprintf("%s: error writing request transcript", GetCaller()), "error", werr)
+	}
+}
+
+// GetRequestTranscript returns the requests made by the most recent QCLauncher run that sent any, oldest first.
+func GetRequestTranscript() ([]*RequestTranscriptEntry, error) {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	if len(transcript) != 0 {
+		return transcript, nil
+	}
+	if !FileExists(getTranscriptFilePath()) {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(getTranscriptFilePath())
+	if err != nil {
+		return nil, err
+	}
+	var saved []*RequestTranscriptEntry
+	if err = json.Unmarshal(b, &saved); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(saved, func(i, j int) bool { return saved[i].Time.Before(saved[j].Time) })
+	return saved, nil
+}
+
+func getTranscriptFilePath() string {
+	return filepath.Join(getExecutingPath(), TranscriptFile)
+}
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"fmt"
 	"image/png"
+	"os"
 	"os/exec"
 	"strconv"
 
@@ -22,23 +23,48 @@ var (
 )
 
 func ShowErrorMsg(title, message string, owner walk.Form) {
+	if ConfHeadless {
+		showHeadlessMsg(title, message)
+		return
+	}
 	walk.MsgBox(owner, title, message, walk.MsgBoxIconError)
 }
 
 func ShowFatalErrorMsg(title, message string, owner walk.Form) {
+	if ConfHeadless {
+		showHeadlessMsg(title, message)
+		Exit(ExitError)
+	}
 	walk.MsgBox(owner, title, message, walk.MsgBoxIconError)
 	Exit(1)
 }
 
 func ShowWarningMsg(title, message string, owner walk.Form) {
+	if ConfHeadless {
+		showHeadlessMsg(title, message)
+		return
+	}
 	walk.MsgBox(owner, title, message, walk.MsgBoxIconWarning)
 }
 
 func ShowInfoMsg(title, message string, owner walk.Form) {
+	if ConfHeadless {
+		showHeadlessMsg(title, message)
+		return
+	}
 	walk.MsgBox(owner, title, message, walk.MsgBoxIconInformation)
 }
 
+func showHeadlessMsg(title, message string) {
+	// headless commands never block on a message box; scripts get the text on stderr instead
+	logger.Infow("headless message", "title", title, "message", message)
+	fmt.Fprintf(os.Stderr, "%s: %s\n", title, message)
+}
+
 func ShowQCRunningMsg(pid int) bool {
+	if ConfHeadless {
+		return false // never kill a running game from a script
+	}
 	result := walk.MsgBox(nil, "Already Running",
 		"Quake Champions is already running. Should QCLauncher exit Quake Champions for you?", walk.MsgBoxYesNo)
 	if result == win.IDYES {
@@ -0,0 +1,159 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+
+	"github.com/lxn/walk"
+	wd "github.com/lxn/walk/declarative"
+	"github.com/syncore/qclauncher/logrotate"
+)
+
+const tabAdvancedTitle = "Advanced"
+
+func newAdvancedSettingsTab(launcherSettings *LauncherSettings) *QCLSettingsTab {
+	advancedSettingsTab := &QCLSettingsTab{}
+	height, width := 20, 77
+	var logLevelCombo *walk.ComboBox
+	tabPage := wd.TabPage{
+		Title:  tabAdvancedTitle,
+		Layout: wd.VBox{},
+		DataBinder: wd.DataBinder{
+			AssignTo:       &advancedSettingsTab.DataBinder,
+			DataSource:     launcherSettings,
+			ErrorPresenter: wd.ToolTipErrorPresenter{},
+		},
+		Children: []wd.Widget{
+			wd.GroupBox{
+				Title:  fmt.Sprintf("Log File (%s)", LogFile),
+				Layout: wd.Grid{Columns: 2},
+				Children: []wd.Widget{
+					wd.Label{Text: "Leave a value at 0 to use the default.", ColumnSpan: 2},
+					wd.Label{Text: "Start a new log file after:"},
+					wd.NumberEdit{
+						Value:       wd.Bind("LogMaxSizeMB"),
+						MinValue:    0,
+						MaxValue:    logrotate.LimitMaxSizeMB,
+						MinSize:     wd.Size{Height: height, Width: width},
+						MaxSize:     wd.Size{Height: height, Width: width},
+						Suffix:      " MB",
+						ToolTipText: fmt.Sprintf("Size at which the log file is rotated (default: %d MB)", logrotate.DefaultMaxSizeMB),
+					},
+					wd.Label{Text: "Delete old log files after:"},
+					wd.NumberEdit{
+						Value:       wd.Bind("LogMaxAgeDays"),
+						MinValue:    0,
+						MaxValue:    logrotate.LimitMaxAgeDays,
+						MinSize:     wd.Size{Height: height, Width: width},
+						MaxSize:     wd.Size{Height: height, Width: width},
+						Suffix:      " days",
+						ToolTipText: fmt.Sprintf("Age at which old log files are deleted (default: %d days)", logrotate.DefaultMaxAgeDays),
+					},
+					wd.Label{Text: "Old log files to keep:"},
+					wd.NumberEdit{
+						Value:       wd.Bind("LogMaxBackups"),
+						MinValue:    0,
+						MaxValue:    logrotate.LimitMaxBackups,
+						MinSize:     wd.Size{Height: height, Width: width},
+						MaxSize:     wd.Size{Height: height, Width: width},
+						ToolTipText: fmt.Sprintf("Maximum number of old log files to keep (default: %d)", logrotate.DefaultMaxBackups),
+					},
+					wd.CheckBox{
+						ColumnSpan:  2,
+						Text:        "Compress old log files",
+						ToolTipText: "Compress old log files with gzip",
+						Checked:     wd.Bind("LogCompress"),
+					},
+				},
+			},
+			wd.GroupBox{
+				Title:  "Logging",
+				Layout: wd.Grid{Columns: 3},
+				Children: []wd.Widget{
+					wd.Label{Text: "Log level:"},
+					wd.ComboBox{
+						AssignTo:     &logLevelCombo,
+						Model:        LogLevels,
+						CurrentIndex: logLevelIndex(GetLogLevel()),
+						MinSize:      wd.Size{Height: height, Width: width},
+						MaxSize:      wd.Size{Height: height, Width: width},
+						ToolTipText:  "Takes effect immediately and lasts until QCLauncher is closed",
+						OnCurrentIndexChanged: func() {
+							i := logLevelCombo.CurrentIndex()
+							if i < 0 || i >= len(LogLevels) {
+								return
+							}
+							if err := SetLogLevel(LogLevels[i]); err != nil {
+								logger.Errorw(fmt.Sprintf("%s: error changing log level", GetCaller()), "error", err)
+							}
+							if qclauncherMainWindow != nil {
+								qclauncherMainWindow.setLogLevelChecked(GetLogLevel())
+							}
+						},
+					},
+					wd.PushButton{
+						Text:        "View Log",
+						ToolTipText: fmt.Sprintf("Open the %s viewer", LogFile),
+						OnClicked:   func() { showLogWindow() },
+					},
+				},
+			},
+			wd.GroupBox{
+				Title:  "Saved Settings",
+				Layout: wd.Grid{Columns: 3},
+				Children: []wd.Widget{
+					wd.Label{
+						Text:       fmt.Sprintf("The last %d copies of %s are kept in the %s folder.", maxDataFileBackups, DataFile, BackupDir),
+						ColumnSpan: 3,
+					},
+					wd.PushButton{
+						Text:        "Restore...",
+						ToolTipText: "Replace your settings with an earlier backup",
+						OnClicked: func() {
+							if showRestoreDialog(qclauncherSettingsWindow) {
+								qclauncherSettingsWindow.close()
+								handlePostRestore()
+							}
+						},
+					},
+					wd.PushButton{
+						Text:        "Export...",
+						ToolTipText: "Save your settings to a JSON or TOML file, e.g. to move them to another PC",
+						OnClicked:   func() { exportSettingsFromUI(qclauncherSettingsWindow) },
+					},
+					wd.PushButton{
+						Text:        "Import...",
+						ToolTipText: "Load settings from an exported JSON or TOML file",
+						OnClicked:   func() { qclauncherSettingsWindow.importSettings() },
+					},
+				},
+			},
+			wd.GroupBox{
+				Title:  masterPassphraseTitle,
+				Layout: wd.Grid{Columns: 3},
+				Children: []wd.Widget{
+					wd.Label{
+						Text:       "Protect your saved username, password and token with a passphrase asked for at launch.",
+						ColumnSpan: 3,
+					},
+					wd.PushButton{
+						Text:        "Set or Change...",
+						ToolTipText: "Set a master passphrase, or change the one in use",
+						OnClicked:   func() { changeMasterPassphraseFromUI(qclauncherSettingsWindow, false) },
+					},
+					wd.PushButton{
+						Text:        "Remove...",
+						ToolTipText: "Stop asking for a master passphrase",
+						OnClicked:   func() { changeMasterPassphraseFromUI(qclauncherSettingsWindow, true) },
+					},
+					wd.HSpacer{},
+				},
+			},
+			wd.VSpacer{},
+		},
+	}
+	advancedSettingsTab.TabPage = tabPage
+	return advancedSettingsTab
+}
@@ -52,6 +52,25 @@ func newQCCoreSettingsTab(qcCoreSettings *QCCoreSettings) *QCLSettingsTab {
 						ToolTipText:  `Enter your Bethesda.net password`,
 						PasswordMode: true,
 					},
+					wd.CheckBox{
+						ColumnSpan:  2,
+						Text:        "Don't save my password",
+						ToolTipText: "Only keep the login token. You will be asked for your password when the token expires.",
+						Checked:     wd.Bind("TokenOnly"),
+					},
+					wd.Label{
+						ColumnSpan: 2,
+						Text:       "Save credentials in:",
+					},
+					wd.ComboBox{
+						ColumnSpan:    2,
+						Editable:      false,
+						Value:         wd.Bind("SecretStore"),
+						ToolTipText:   "Where your username, password and login token are kept",
+						BindingMember: "Key",
+						DisplayMember: "Name",
+						Model:         SecretStores,
+					},
 					wd.Label{
 						ColumnSpan: 2,
 						Text:       "QC Language:",
@@ -4,6 +4,9 @@
 package qclauncher
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/lxn/walk"
 	wd "github.com/lxn/walk/declarative"
 )
@@ -13,46 +16,135 @@ const tabExpTitle = "QC Experimental Settings"
 type QCLSettingsTab struct {
 	wd.TabPage
 	DataBinder *walk.DataBinder
+	submit     func() error // for tabs with values the DataBinder can't hold
+	reset      func()
+}
+
+// optionWidgets are the widgets for one QC option; the check box turns the option on.
+type optionWidgets struct {
+	opt   *QCOption
+	cb    *walk.CheckBox
+	ne    *walk.NumberEdit
+	combo *walk.ComboBox
+	le    *walk.LineEdit
 }
 
 func newQCExperimentalSettingsTab(expSettings *QCExperimentalSettings) *QCLSettingsTab {
 	qcExperimentalSettingsTab := &QCLSettingsTab{}
-	var neMaxFPS, neMaxFPSMinimized *walk.NumberEdit
-	ttMaxFPS, ttMaxFPSMinimized := "Experimental: Limit or 'cap' the maximum FPS during the game",
-		"Experimental: Limit or 'cap' the maximum FPS when QC is minimized"
-	height, width, fmin, fmax := 20, 77, 0, 2000
-	maxFPSCmp, maxFPSMinCmp := wd.Composite{
-		Layout:     wd.Grid{Columns: 2, MarginsZero: true},
-		ColumnSpan: 2,
-		Children: []wd.Widget{
-			wd.NumberEdit{
-				AssignTo:    &neMaxFPS,
-				Enabled:     wd.Bind("cbUseMaxFPSLimit.Checked"),
-				Value:       wd.Bind("MaxFPSLimit"),
-				MinValue:    float64(fmin),
-				MaxValue:    float64(fmax),
-				MinSize:     wd.Size{Height: height, Width: width},
-				MaxSize:     wd.Size{Height: height, Width: width},
-				Suffix:      " FPS",
-				ToolTipText: ttMaxFPS,
-			},
-		},
-	}, wd.Composite{
-		Layout:     wd.Grid{Columns: 2, MarginsZero: true},
-		ColumnSpan: 2,
-		Children: []wd.Widget{
-			wd.NumberEdit{
-				AssignTo:    &neMaxFPSMinimized,
-				Enabled:     wd.Bind("cbUseMaxFPSLimitMinimized.Checked"),
-				Value:       wd.Bind("MaxFPSLimitMinimized"),
-				MinValue:    float64(fmin),
-				MaxValue:    float64(fmax),
+	height, width := 20, 77
+	children := []wd.Widget{
+		wd.Label{Text: "These experimental settings may be removed from the game at any time!",
+			TextColor: walk.RGB(210, 0, 0), ColumnSpan: 2},
+		wd.Label{Text: "Use at your own risk, these are undocumented and may have zero/unpredictable effects!",
+			TextColor: walk.RGB(210, 0, 0), ColumnSpan: 2},
+		wd.VSpacer{Size: 1, ColumnSpan: 2},
+	}
+	var widgets []*optionWidgets
+	for _, opt := range getOptionsCatalog().Options {
+		value, set := expSettings.Options[opt.ID]
+		if opt.Removed && !set {
+			continue
+		}
+		ow := &optionWidgets{opt: opt}
+		widgets = append(widgets, ow)
+		label, tip := opt.Label, "Experimental: "+opt.Description
+		if opt.Removed {
+			label += " (removed from the game)"
+		}
+		if !set {
+			value = opt.Default
+		}
+		if opt.Type == optionTypeBool {
+			on, _ := strconv.ParseBool(value)
+			children = append(children, wd.CheckBox{
+				AssignTo:    &ow.cb,
+				ColumnSpan:  2,
+				Text:        label,
+				ToolTipText: tip,
+				Checked:     set && on,
+			})
+			continue
+		}
+		name := "cbOpt_" + opt.ID
+		children = append(children, wd.CheckBox{
+			AssignTo:    &ow.cb,
+			Name:        name,
+			Text:        label,
+			ToolTipText: tip,
+			Checked:     set,
+		})
+		var editor wd.Widget
+		switch opt.Type {
+		case optionTypeInt, optionTypeFloat:
+			f, _ := strconv.ParseFloat(value, 64)
+			ne := wd.NumberEdit{
+				AssignTo:    &ow.ne,
+				Enabled:     wd.Bind(name + ".Checked"),
+				Value:       f,
+				MinValue:    -1e9,
+				MaxValue:    1e9,
 				MinSize:     wd.Size{Height: height, Width: width},
 				MaxSize:     wd.Size{Height: height, Width: width},
-				Suffix:      " FPS",
-				ToolTipText: ttMaxFPSMinimized,
-			},
-		},
+				Suffix:      opt.Suffix,
+				ToolTipText: tip,
+			}
+			if opt.Min != nil {
+				ne.MinValue = *opt.Min
+			}
+			if opt.Max != nil {
+				ne.MaxValue = *opt.Max
+			}
+			if opt.Type == optionTypeFloat {
+				ne.Decimals = 2
+			}
+			editor = ne
+		case optionTypeEnum:
+			editor = wd.ComboBox{
+				AssignTo:     &ow.combo,
+				Enabled:      wd.Bind(name + ".Checked"),
+				Model:        opt.Values,
+				CurrentIndex: indexOf(opt.Values, value),
+				ToolTipText:  tip,
+			}
+		default:
+			editor = wd.LineEdit{
+				AssignTo:    &ow.le,
+				Enabled:     wd.Bind(name + ".Checked"),
+				Text:        value,
+				ToolTipText: tip,
+			}
+		}
+		children = append(children, wd.Composite{
+			Layout:     wd.Grid{Columns: 2, MarginsZero: true},
+			ColumnSpan: 2,
+			Children:   []wd.Widget{editor},
+		})
+	}
+	children = append(children, wd.VSpacer{ColumnSpan: 2})
+	qcExperimentalSettingsTab.submit = func() error {
+		options := map[string]string{}
+		for k, v := range expSettings.Options {
+			if getOptionsCatalog().find(k) == nil {
+				options[k] = v // not in this catalog; keep it for a newer one
+			}
+		}
+		for _, ow := range widgets {
+			if !ow.cb.Checked() {
+				continue
+			}
+			v := ow.value()
+			if err := ow.opt.validate(v); err != nil {
+				return fmt.Errorf("%s: %s", ow.opt.Label, err)
+			}
+			options[ow.opt.ID] = v
+		}
+		expSettings.Options = options
+		return nil
+	}
+	qcExperimentalSettingsTab.reset = func() {
+		for _, ow := range widgets {
+			ow.set(expSettings.Options)
+		}
 	}
 	tabPage := wd.TabPage{
 		Title:  tabExpTitle,
@@ -65,35 +157,11 @@ func newQCExperimentalSettingsTab(expSettings *QCExperimentalSettings) *QCLSetti
 		Children: []wd.Widget{
 			wd.GroupBox{
 				Title:  tabExpTitle,
-				Layout: wd.Grid{Columns: 2},
+				Layout: wd.VBox{},
 				Children: []wd.Widget{
-					wd.Label{Text: "These experimental settings may be removed from the game at any time!",
-						TextColor: walk.RGB(210, 0, 0), ColumnSpan: 2},
-					wd.Label{Text: "Use at your own risk, these are undocumented and may have zero/unpredictable effects!",
-						TextColor: walk.RGB(210, 0, 0), ColumnSpan: 2},
-					wd.VSpacer{Size: 1, ColumnSpan: 2},
-					wd.CheckBox{
-						Name:        "cbUseMaxFPSLimit",
-						ToolTipText: ttMaxFPS,
-						Text:        `Set Max FPS Limit`,
-						Checked:     wd.Bind("UseMaxFPSLimit"),
-					},
-					maxFPSCmp,
-					wd.CheckBox{
-						Text:        `Set Max FPS Limit (when QC is minimized)`,
-						Name:        "cbUseMaxFPSLimitMinimized",
-						ToolTipText: ttMaxFPSMinimized,
-						Checked:     wd.Bind("UseMaxFPSLimitMinimized"),
-					},
-					maxFPSMinCmp,
-					wd.CheckBox{
-						ColumnSpan:  2,
-						Text:        `Use FPS smoothing`,
-						ToolTipText: "Experimental: use FPS smoothing (may have no effect)",
-						Checked:     wd.Bind("UseFPSSmoothing"),
-					},
-					wd.VSpacer{
-						ColumnSpan: 2,
+					wd.ScrollView{
+						Layout:   wd.Grid{Columns: 2},
+						Children: children,
 					},
 				},
 			},
@@ -102,3 +170,54 @@ func newQCExperimentalSettingsTab(expSettings *QCExperimentalSettings) *QCLSetti
 	qcExperimentalSettingsTab.TabPage = tabPage
 	return qcExperimentalSettingsTab
 }
+
+func (ow *optionWidgets) value() string {
+	switch {
+	case ow.opt.Type == optionTypeBool:
+		return "true"
+	case ow.ne != nil:
+		return strconv.FormatFloat(ow.ne.Value(), 'f', -1, 64)
+	case ow.combo != nil:
+		if i := ow.combo.CurrentIndex(); i >= 0 && i < len(ow.opt.Values) {
+			return ow.opt.Values[i]
+		}
+		return ""
+	default:
+		return ow.le.Text()
+	}
+}
+
+func (ow *optionWidgets) set(options map[string]string) {
+	value, set := options[ow.opt.ID]
+	if !set {
+		value = ow.opt.Default
+	}
+	if ow.opt.Type == optionTypeBool {
+		on, _ := strconv.ParseBool(value)
+		ow.cb.SetChecked(set && on)
+		return
+	}
+	ow.cb.SetChecked(set)
+	var err error
+	switch {
+	case ow.ne != nil:
+		f, _ := strconv.ParseFloat(value, 64)
+		err = ow.ne.SetValue(f)
+	case ow.combo != nil:
+		err = ow.combo.SetCurrentIndex(indexOf(ow.opt.Values, value))
+	case ow.le != nil:
+		err = ow.le.SetText(value)
+	}
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error refreshing experimental setting", GetCaller()), "option", ow.opt.ID, "error", err)
+	}
+}
+
+func indexOf(values []string, v string) int {
+	for i, s := range values {
+		if s == v {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,63 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+
+	wd "github.com/lxn/walk/declarative"
+)
+
+const tabProfileTitle = "Profile"
+
+func newProfileSettingsTab(profile *Profile) *QCLSettingsTab {
+	profileSettingsTab := &QCLSettingsTab{}
+	note := "The QC Experimental and QCLauncher settings tabs are saved to this profile. Your account is shared by all profiles."
+	if profile.isDefault() {
+		note = "This is the default profile. Your account is shared by all profiles."
+	}
+	tabPage := wd.TabPage{
+		Title:  tabProfileTitle,
+		Layout: wd.VBox{},
+		DataBinder: wd.DataBinder{
+			AssignTo:       &profileSettingsTab.DataBinder,
+			DataSource:     profile,
+			ErrorPresenter: wd.ToolTipErrorPresenter{},
+		},
+		Children: []wd.Widget{
+			wd.GroupBox{
+				Title:  fmt.Sprintf("Profile: %s", profile.Name),
+				Layout: wd.Grid{Columns: 1},
+				Children: []wd.Widget{
+					wd.Label{Text: note},
+					wd.Label{Text: "Custom QC start-up options:"},
+					wd.LineEdit{
+						Text:        wd.Bind("CustomArgs"),
+						ToolTipText: "Added to the QC launch arguments when this profile is used (in addition to -customargs)",
+					},
+				},
+			},
+			wd.Composite{
+				Layout: wd.HBox{MarginsZero: true},
+				Children: []wd.Widget{
+					wd.HSpacer{},
+					wd.PushButton{
+						Text:        "New Profile...",
+						ToolTipText: "Create a profile from a copy of this one",
+						OnClicked:   func() { newProfileFromUI(qclauncherSettingsWindow) },
+					},
+					wd.PushButton{
+						Text:        "Delete Profile",
+						ToolTipText: "Delete this profile and switch to the default profile",
+						Enabled:     !profile.isDefault(),
+						OnClicked:   func() { deleteProfileFromUI(qclauncherSettingsWindow) },
+					},
+				},
+			},
+			wd.VSpacer{},
+		},
+	}
+	profileSettingsTab.TabPage = tabPage
+	return profileSettingsTab
+}
@@ -0,0 +1,263 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+
+	"github.com/lxn/walk"
+	wd "github.com/lxn/walk/declarative"
+	"github.com/lxn/win"
+)
+
+const (
+	accountsWindowWidth  = 350
+	accountsWindowHeight = 250
+)
+
+func getAccountNames() ([]string, string) {
+	if !DataStoreExists() {
+		return nil, ""
+	}
+	names, active, err := GetAccounts()
+	if err != nil {
+		return nil, ""
+	}
+	return names, active
+}
+
+func (qm *QCLMainWindow) newAccountMenuAction() *walk.Action {
+	menu, err := walk.NewMenu()
+	if err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error creating account menu", GetCaller()), "error", err)
+	}
+	qm.accountMenu = menu
+	action := walk.NewMenuAction(menu)
+	if err := action.SetText("A&ccount"); err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error setting account menu action", GetCaller()), "error", err)
+	}
+	return action
+}
+
+// refreshAccounts updates the main window's account list and the tray menu from the data file.
+func (qm *QCLMainWindow) refreshAccounts() {
+	if qm == nil || qm.accountCombo == nil || qm.accountMenu == nil {
+		return
+	}
+	qm.accounts, qm.account = getAccountNames()
+	if err := qm.accountCombo.SetModel(qm.accounts); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error updating account list", GetCaller()), "error", err)
+	}
+	if err := qm.accountMenu.Actions().Clear(); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error clearing account menu", GetCaller()), "error", err)
+	}
+	for i, n := range qm.accounts {
+		name := n
+		if name == qm.account {
+			if err := qm.accountCombo.SetCurrentIndex(i); err != nil {
+				logger.Errorw(fmt.Sprintf("%s: error selecting account in list", GetCaller()), "error", err)
+			}
+		}
+		a := walk.NewAction()
+		if err := a.SetText(name); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error setting account action", GetCaller()), "error", err)
+		}
+		if err := a.SetCheckable(true); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error setting account action", GetCaller()), "error", err)
+		}
+		if err := a.SetChecked(name == qm.account); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error setting account action", GetCaller()), "error", err)
+		}
+		a.Triggered().Attach(func() { qm.selectAccount(name) })
+		if err := qm.accountMenu.Actions().Add(a); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error adding account action", GetCaller()), "error", err)
+		}
+	}
+	if len(qm.accounts) > 0 {
+		if err := qm.accountMenu.Actions().Add(walk.NewSeparatorAction()); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error adding account menu separator", GetCaller()), "error", err)
+		}
+	}
+	manage := walk.NewAction()
+	if err := manage.SetText("&Manage Accounts..."); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error setting manage accounts action", GetCaller()), "error", err)
+	}
+	manage.Triggered().Attach(func() { showAccountsDialog(nil) })
+	if err := qm.accountMenu.Actions().Add(manage); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error adding manage accounts action", GetCaller()), "error", err)
+	}
+}
+
+func (qm *QCLMainWindow) selectAccount(name string) {
+	if name == qm.account || !DataStoreExists() {
+		return
+	}
+	if isCollectingSettings {
+		ShowInfoMsg("Account", "Close the settings window before changing accounts.", qm)
+		qm.refreshAccounts()
+		return
+	}
+	if err := SwitchAccount(name); err != nil {
+		ShowErrorMsg("Account", fmt.Sprintf("Unable to change account: %s", err), qm)
+		qm.refreshAccounts()
+		return
+	}
+	qm.setSignedInName(name)
+	qm.refreshAccounts()
+}
+
+func showAccountsDialog(owner walk.Form) {
+	if !DataStoreExists() {
+		ShowInfoMsg("Accounts", "Save your settings before adding accounts.", owner)
+		return
+	}
+	if isCollectingSettings {
+		ShowInfoMsg("Accounts", "Close the settings window before changing accounts.", owner)
+		return
+	}
+	var dlg *walk.Dialog
+	var list *walk.ListBox
+	var useBtn, closeBtn *walk.PushButton
+	names, active := getAccountNames()
+	reload := func() {
+		names, active = getAccountNames()
+		if err := list.SetModel(names); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error updating account list", GetCaller()), "error", err)
+		}
+		for i, n := range names {
+			if n == active {
+				if err := list.SetCurrentIndex(i); err != nil {
+					logger.Errorw(fmt.Sprintf("%s: error selecting account in list", GetCaller()), "error", err)
+				}
+			}
+		}
+		qclauncherMainWindow.refreshAccounts()
+	}
+	selected := func() string {
+		i := list.CurrentIndex()
+		if i < 0 || i >= len(names) {
+			return ""
+		}
+		return names[i]
+	}
+	use := func() {
+		if name := selected(); name != "" {
+			qclauncherMainWindow.selectAccount(name)
+			reload()
+		}
+	}
+	if err := (wd.Dialog{
+		AssignTo:      &dlg,
+		Title:         "Accounts",
+		Icon:          getAppIcon(),
+		DefaultButton: &useBtn,
+		CancelButton:  &closeBtn,
+		MinSize:       wd.Size{Width: accountsWindowWidth, Height: accountsWindowHeight},
+		Size:          wd.Size{Width: accountsWindowWidth, Height: accountsWindowHeight},
+		Layout:        wd.VBox{},
+		Children: []wd.Widget{
+			wd.Label{Text: "Bethesda.net accounts (the first is in use):"},
+			wd.ListBox{
+				AssignTo:        &list,
+				Model:           names,
+				OnItemActivated: use,
+			},
+			wd.Composite{
+				Layout: wd.HBox{MarginsZero: true},
+				Children: []wd.Widget{
+					wd.PushButton{
+						AssignTo:    &useBtn,
+						Text:        "Use",
+						ToolTipText: "Log in with the selected account",
+						OnClicked:   use,
+					},
+					wd.PushButton{
+						Text:        "Add...",
+						ToolTipText: "Store another account",
+						OnClicked: func() {
+							if addAccountFromUI(dlg) {
+								reload()
+							}
+						},
+					},
+					wd.PushButton{
+						Text:        "Remove",
+						ToolTipText: "Remove the selected account",
+						OnClicked: func() {
+							name := selected()
+							if name == "" {
+								return
+							}
+							if walk.MsgBox(dlg, "Remove Account", fmt.Sprintf("Remove the account \"%s\" from QCLauncher?", name),
+								walk.MsgBoxYesNo) != win.IDYES {
+								return
+							}
+							if err := RemoveAccount(name); err != nil {
+								ShowErrorMsg("Remove Account", err.Error(), dlg)
+								return
+							}
+							reload()
+						},
+					},
+					wd.HSpacer{},
+					wd.PushButton{
+						AssignTo:  &closeBtn,
+						Text:      "Close",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Create(owner); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating accounts window", GetCaller()), "error", err)
+		return
+	}
+	reload()
+	dlg.Run()
+}
+
+// addAccountFromUI returns true if an account was added.
+func addAccountFromUI(owner walk.Form) bool {
+	var dlg *walk.Dialog
+	var userEdit, passEdit *walk.LineEdit
+	var okBtn, cancelBtn *walk.PushButton
+	result, err := (wd.Dialog{
+		AssignTo:      &dlg,
+		Title:         "Add Account",
+		Icon:          getAppIcon(),
+		DefaultButton: &okBtn,
+		CancelButton:  &cancelBtn,
+		MinSize:       wd.Size{Width: 300},
+		Layout:        wd.VBox{},
+		Children: []wd.Widget{
+			wd.Label{Text: "QC Username:"},
+			wd.LineEdit{AssignTo: &userEdit},
+			wd.Label{Text: "QC Password:"},
+			wd.LineEdit{AssignTo: &passEdit, PasswordMode: true},
+			wd.Composite{
+				Layout: wd.HBox{MarginsZero: true},
+				Children: []wd.Widget{
+					wd.HSpacer{},
+					wd.PushButton{
+						AssignTo: &okBtn,
+						Text:     "OK",
+						OnClicked: func() {
+							if err := AddAccount(userEdit.Text(), passEdit.Text()); err != nil {
+								ShowErrorMsg("Add Account", err.Error(), dlg)
+								return
+							}
+							dlg.Accept()
+						},
+					},
+					wd.PushButton{AssignTo: &cancelBtn, Text: "Cancel", OnClicked: func() { dlg.Cancel() }},
+				},
+			},
+		},
+	}).Run(owner)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating add account window", GetCaller()), "error", err)
+		return false
+	}
+	return result == walk.DlgCmdOK
+}
@@ -0,0 +1,114 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+
+	"github.com/lxn/walk"
+	wd "github.com/lxn/walk/declarative"
+	"github.com/lxn/win"
+)
+
+const (
+	backupsWindowWidth  = 450
+	backupsWindowHeight = 300
+)
+
+// showRestoreDialog returns true if a backup was restored.
+func showRestoreDialog(owner walk.Form) bool {
+	backups, err := ListDataFileBackups()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error listing backups", GetCaller()), "error", err)
+		ShowErrorMsg("Error", fmt.Sprintf("Unable to read the %s folder: %s", BackupDir, err), owner)
+		return false
+	}
+	if len(backups) == 0 {
+		ShowInfoMsg("Restore", fmt.Sprintf("There are no backups of %s yet.", DataFile), owner)
+		return false
+	}
+	var items []string
+	for _, b := range backups {
+		items = append(items, fmt.Sprintf("%s  (before %s, %d KB)", b.Time.Format("2006-01-02 15:04:05"), b.Reason, (b.Size+1023)/1024))
+	}
+	var dlg *walk.Dialog
+	var list *walk.ListBox
+	var restoreBtn, cancelBtn *walk.PushButton
+	restored := false
+	restore := func() {
+		i := list.CurrentIndex()
+		if i < 0 || i >= len(backups) {
+			return
+		}
+		if walk.MsgBox(dlg, "Restore Backup", fmt.Sprintf("Replace your current settings with the backup from %s?\n\nA backup of your current settings is made first.",
+			backups[i].Time.Format("2006-01-02 15:04:05")), walk.MsgBoxYesNo) != win.IDYES {
+			return
+		}
+		if err := RestoreDataFile(backups[i].Name); err != nil {
+			ShowErrorMsg("Restore Error", err.Error(), dlg)
+			return
+		}
+		restored = true
+		dlg.Accept()
+	}
+	if err := (wd.Dialog{
+		AssignTo:      &dlg,
+		Title:         "Restore Settings",
+		Icon:          getAppIcon(),
+		DefaultButton: &restoreBtn,
+		CancelButton:  &cancelBtn,
+		MinSize:       wd.Size{Width: backupsWindowWidth, Height: backupsWindowHeight},
+		Size:          wd.Size{Width: backupsWindowWidth, Height: backupsWindowHeight},
+		Layout:        wd.VBox{},
+		Children: []wd.Widget{
+			wd.Label{Text: fmt.Sprintf("Backups of %s, newest first:", DataFile)},
+			wd.ListBox{
+				AssignTo:        &list,
+				Model:           items,
+				OnItemActivated: restore,
+			},
+			wd.Composite{
+				Layout: wd.HBox{},
+				Children: []wd.Widget{
+					wd.HSpacer{},
+					wd.PushButton{
+						AssignTo:  &restoreBtn,
+						Text:      "Restore",
+						OnClicked: restore,
+					},
+					wd.PushButton{
+						AssignTo:  &cancelBtn,
+						Text:      "Cancel",
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}).Create(owner); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating restore window", GetCaller()), "error", err)
+		return false
+	}
+	if err := list.SetCurrentIndex(0); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error selecting newest backup", GetCaller()), "error", err)
+	}
+	dlg.Run()
+	return restored
+}
+
+func handlePostRestore() {
+	cfg, err := GetConfiguration()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading restored configuration", GetCaller()), "error", err)
+		ShowErrorMsg("Error", "Your settings were restored but could not be read.", nil)
+		return
+	}
+	configured := cfg.Core.Username != ""
+	qclauncherMainWindow.setSignedInName(cfg.Core.Username)
+	qclauncherMainWindow.enableLaunchButton(configured)
+	qclauncherMainWindow.enableLaunchTrayAction(configured)
+	qclauncherMainWindow.updateMinimizeSettings(cfg.Launcher.MinimizeToTray)
+	qclauncherMainWindow.refreshProfiles()
+	qclauncherMainWindow.refreshAccounts()
+	ShowInfoMsg("Success", "Your settings were restored.", qclauncherMainWindow)
+}
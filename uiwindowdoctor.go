@@ -0,0 +1,112 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lxn/walk"
+	wd "github.com/lxn/walk/declarative"
+)
+
+const (
+	doctorWindowWidth  = 600
+	doctorWindowHeight = 450
+)
+
+func runDoctorFromUI(owner *walk.MainWindow, done func()) {
+	go func() {
+		report := RunDoctor()
+		owner.Synchronize(func() {
+			done()
+			showDoctorReport(owner, report)
+		})
+	}()
+}
+
+func showDoctorReport(owner walk.Form, report *DoctorReport) {
+	var dlg *walk.Dialog
+	var closeBtn *walk.PushButton
+	text := report.String()
+	summary := "All checks passed."
+	if report.Failed() {
+		summary = "One or more checks failed. See the suggested fixes below."
+	}
+	if _, err := (wd.Dialog{
+		AssignTo:      &dlg,
+		Title:         "Diagnostics",
+		Icon:          getAppIcon(),
+		DefaultButton: &closeBtn,
+		CancelButton:  &closeBtn,
+		MinSize:       wd.Size{Width: doctorWindowWidth, Height: doctorWindowHeight},
+		Size:          wd.Size{Width: doctorWindowWidth, Height: doctorWindowHeight},
+		Layout:        wd.VBox{},
+		Children: []wd.Widget{
+			wd.Label{Text: summary},
+			wd.TextEdit{
+				ReadOnly: true,
+				VScroll:  true,
+				Text:     strings.Replace(text, "\n", "\r\n", -1), // edit controls need CRLF line breaks
+			},
+			wd.Composite{
+				Layout: wd.HBox{},
+				Children: []wd.Widget{
+					wd.PushButton{
+						Text:        "Create Support Bundle...",
+						ToolTipText: "Save a zip file with this report and a redacted log to attach to a GitHub issue",
+						OnClicked: func() {
+							saveSupportBundleFromUI(dlg, report)
+						},
+					},
+					wd.HSpacer{},
+					wd.PushButton{
+						Text:        "Copy",
+						ToolTipText: "Copy the report to the clipboard",
+						OnClicked: func() {
+							if err := walk.Clipboard().SetText(text); err != nil {
+								logger.Errorw(fmt.Sprintf("%s: error copying diagnostics report to clipboard", GetCaller()), "error", err)
+							}
+						},
+					},
+					wd.PushButton{
+						AssignTo: &closeBtn,
+						Text:     "Close",
+						OnClicked: func() {
+							dlg.Accept()
+						},
+					},
+				},
+			},
+		},
+	}).Run(owner); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating diagnostics window", GetCaller()), "error", err)
+		ShowErrorMsg("Diagnostics", text, owner)
+	}
+}
+
+func saveSupportBundleFromUI(owner walk.Form, report *DoctorReport) {
+	fd := &walk.FileDialog{
+		Title:    "Save support bundle",
+		Filter:   "Zip files (*.zip)|*.zip",
+		FilePath: fmt.Sprintf("qclauncher-support-%s.zip", time.Now().Format("20060102-150405")),
+	}
+	if accepted, err := fd.ShowSave(owner); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error showing support bundle save dialog", GetCaller()), "error", err)
+		return
+	} else if !accepted {
+		return
+	}
+	p := fd.FilePath
+	if !strings.HasSuffix(strings.ToLower(p), ".zip") {
+		p += ".zip"
+	}
+	p, err := createSupportBundle(p, DefSupportLogLines, report)
+	if err != nil {
+		ShowErrorMsg("Error", fmt.Sprintf("Unable to create support bundle: %s", err), owner)
+		return
+	}
+	ShowInfoMsg("Support Bundle", fmt.Sprintf("Saved to %s. Your password and token are not included.\n\nAttach it to your issue at https://github.com/syncore/qclauncher/issues", p), owner)
+}
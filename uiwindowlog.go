@@ -0,0 +1,166 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lxn/walk"
+	wd "github.com/lxn/walk/declarative"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	logWindowWidth     = 750
+	logWindowHeight    = 500
+	logRefreshInterval = 2 * time.Second
+)
+
+type QCLLogWindow struct {
+	*walk.MainWindow
+	levelFilter *walk.ComboBox
+	textFilter  *walk.LineEdit
+	logText     *walk.TextEdit
+	text        string
+	lastMod     time.Time
+	stop        chan struct{}
+}
+
+var (
+	qclauncherLogWindow *QCLLogWindow
+	logViewLevels       = []zapcore.Level{zapcore.DebugLevel, zapcore.InfoLevel, zapcore.WarnLevel, zapcore.ErrorLevel}
+)
+
+func showLogWindow() {
+	if qclauncherLogWindow != nil {
+		qclauncherLogWindow.Show()
+		return
+	}
+	lw := &QCLLogWindow{stop: make(chan struct{})}
+	var levels []string
+	for _, l := range logViewLevels {
+		levels = append(levels, fmt.Sprintf("%s and above", strings.ToUpper(l.String())))
+	}
+	if err := (wd.MainWindow{
+		AssignTo: &lw.MainWindow,
+		Title:    fmt.Sprintf("Log Viewer - %s", LogFile),
+		Icon:     getAppIcon(),
+		MinSize:  wd.Size{Width: logWindowWidth / 2, Height: logWindowHeight / 2},
+		Size:     wd.Size{Width: logWindowWidth, Height: logWindowHeight},
+		Layout:   wd.VBox{},
+		Children: []wd.Widget{
+			wd.Composite{
+				Layout: wd.HBox{MarginsZero: true},
+				Children: []wd.Widget{
+					wd.Label{Text: "Show:"},
+					wd.ComboBox{
+						AssignTo:              &lw.levelFilter,
+						Model:                 levels,
+						CurrentIndex:          0,
+						OnCurrentIndexChanged: func() { lw.refresh(true) },
+					},
+					wd.Label{Text: "Containing:"},
+					wd.LineEdit{
+						AssignTo:      &lw.textFilter,
+						OnTextChanged: func() { lw.refresh(true) },
+					},
+				},
+			},
+			wd.TextEdit{
+				AssignTo: &lw.logText,
+				ReadOnly: true,
+				VScroll:  true,
+				HScroll:  true,
+				Font:     wd.Font{Family: "Consolas", PointSize: 9},
+			},
+			wd.Composite{
+				Layout: wd.HBox{MarginsZero: true},
+				Children: []wd.Widget{
+					wd.Label{Text: fmt.Sprintf("Showing up to the last %d log entries.", maxLogViewLines)},
+					wd.HSpacer{},
+					wd.PushButton{
+						Text:        "Copy Redacted",
+						ToolTipText: "Copy the shown entries with your credentials, token and fingerprint removed",
+						OnClicked:   func() { lw.copyRedacted() },
+					},
+					wd.PushButton{
+						Text:      "Refresh",
+						OnClicked: func() { lw.refresh(true) },
+					},
+					wd.PushButton{
+						Text:      "Close",
+						OnClicked: func() { lw.Close() },
+					},
+				},
+			},
+		},
+	}).Create(); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating log viewer window", GetCaller()), "error", err)
+		ShowErrorMsg("Error", "Unable to open the log viewer", nil)
+		return
+	}
+	lw.Closing().Attach(func(canceled *bool, reason walk.CloseReason) {
+		close(lw.stop)
+		qclauncherLogWindow = nil
+	})
+	qclauncherLogWindow = lw
+	lw.refresh(true)
+	go lw.watch()
+	lw.Show()
+}
+
+func (lw *QCLLogWindow) watch() {
+	t := time.NewTicker(logRefreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			lw.Synchronize(func() { lw.refresh(false) })
+		case <-lw.stop:
+			return
+		}
+	}
+}
+
+func (lw *QCLLogWindow) refresh(force bool) {
+	if lw.logText == nil || lw.levelFilter == nil || lw.textFilter == nil {
+		return // still being created
+	}
+	fi, err := os.Stat(getLogFilePath())
+	if err == nil && !force && !fi.ModTime().After(lw.lastMod) {
+		return
+	}
+	if err == nil {
+		lw.lastMod = fi.ModTime()
+	}
+	filter := &logViewFilter{minLevel: zapcore.DebugLevel, text: strings.TrimSpace(lw.textFilter.Text())}
+	if i := lw.levelFilter.CurrentIndex(); i >= 0 && i < len(logViewLevels) {
+		filter.minLevel = logViewLevels[i]
+	}
+	text, err := readLogView(filter)
+	if err != nil {
+		text = fmt.Sprintf("Unable to read %s: %s", LogFile, err)
+	}
+	lw.text = text
+	text = strings.Replace(text, "\n", "\r\n", -1) // edit controls need CRLF line breaks
+	if err = lw.logText.SetText(text); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error updating log viewer", GetCaller()), "error", err)
+	}
+	lw.logText.SetTextSelection(len(text), len(text)) // scroll to the newest entry
+}
+
+func (lw *QCLLogWindow) copyRedacted() {
+	var cfg *Configuration
+	if DataStoreExists() {
+		cfg, _ = GetConfiguration()
+	}
+	text := redactSecretValues(redactLogString(lw.text), getSecretValues(cfg))
+	if err := walk.Clipboard().SetText(text); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error copying log to clipboard", GetCaller()), "error", err)
+		ShowErrorMsg("Error", "Unable to copy to the clipboard", lw)
+	}
+}
@@ -5,6 +5,7 @@ package qclauncher
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/lxn/walk"
 	wd "github.com/lxn/walk/declarative"
@@ -15,8 +16,9 @@ import (
 const (
 	embeddedLogoPath = "../../resources/img/qclauncher.png"
 	mainWindowWidth  = 300
-	mainWindowHeight = 160
+	mainWindowHeight = 200
 	loggedInAs       = "Logged in as"
+	serverStatusFmt  = "QC servers: %s"
 )
 
 type QCLMainWindow struct {
@@ -24,12 +26,26 @@ type QCLMainWindow struct {
 	TrayIcon *walk.NotifyIcon
 	Options  *QCLMainWindowOptions
 	Binder   *walk.DataBinder
+	monitor  *serverStatusMonitor
+	logLevel map[string]*walk.Action
+	stop     chan struct{}
+	// profiles
+	profiles     []string
+	profile      string
+	profileCombo *walk.ComboBox
+	profileMenu  *walk.Menu
+	// accounts
+	accounts     []string
+	account      string
+	accountCombo *walk.ComboBox
+	accountMenu  *walk.Menu
 }
 
 type QCLMainWindowOptions struct {
 	MinimizeToTray bool
 	CanLaunch      bool
 	SignedInName   string
+	ServerStatus   string
 }
 
 var qclauncherMainWindow *QCLMainWindow
@@ -39,11 +55,17 @@ func LoadUI(cfg *Configuration) {
 	m := newMainWindow(cfg, &QCLMainWindowOptions{
 		MinimizeToTray: cfg.Launcher.MinimizeToTray,
 		SignedInName:   signedInName,
-		CanLaunch:      FileExists(GetDataFilePath())})
+		CanLaunch:      DataStoreExists(),
+		ServerStatus:   fmt.Sprintf(serverStatusFmt, "checking...")})
 
 	if qclauncherMainWindow == nil {
 		qclauncherMainWindow = m
 	}
+	m.startServerStatusMonitor()
+	m.startLogLevelWatcher()
+	if DataStoreExists() {
+		go checkAuthToken()
+	}
 	m.Run()
 }
 
@@ -76,7 +98,7 @@ func newMainWindow(cfg *Configuration, opts *QCLMainWindowOptions) *QCLMainWindo
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error loading logo image", GetCaller()), "error", err)
 	}
-	mainWindow := &QCLMainWindow{}
+	mainWindow := &QCLMainWindow{stop: make(chan struct{})}
 	mainWindow.Options = opts
 	binder := wd.DataBinder{
 		AssignTo:       &mwBinder,
@@ -129,6 +151,16 @@ func newMainWindow(cfg *Configuration, opts *QCLMainWindowOptions) *QCLMainWindo
 						},
 						Enabled: wd.Bind("CanLaunch"),
 					},
+					wd.ComboBox{
+						AssignTo:    &mainWindow.profileCombo,
+						ToolTipText: "Settings profile",
+						OnCurrentIndexChanged: func() {
+							i := mainWindow.profileCombo.CurrentIndex()
+							if i >= 0 && i < len(mainWindow.profiles) {
+								mainWindow.selectProfile(mainWindow.profiles[i])
+							}
+						},
+					},
 					wd.PushButton{
 						Text:        "Configure",
 						ToolTipText: "Configure your settings and account information",
@@ -143,6 +175,27 @@ func newMainWindow(cfg *Configuration, opts *QCLMainWindowOptions) *QCLMainWindo
 					},
 				},
 			},
+			wd.Composite{
+				Layout: wd.HBox{MarginsZero: true},
+				Children: []wd.Widget{
+					wd.Label{Text: "Account:"},
+					wd.ComboBox{
+						AssignTo:    &mainWindow.accountCombo,
+						ToolTipText: "Bethesda.net account to log in with",
+						OnCurrentIndexChanged: func() {
+							i := mainWindow.accountCombo.CurrentIndex()
+							if i >= 0 && i < len(mainWindow.accounts) {
+								mainWindow.selectAccount(mainWindow.accounts[i])
+							}
+						},
+					},
+					wd.PushButton{
+						Text:        "Accounts...",
+						ToolTipText: "Add, remove or switch Bethesda.net accounts",
+						OnClicked:   func() { showAccountsDialog(mainWindow) },
+					},
+				},
+			},
 			wd.VSpacer{},
 			wd.Composite{
 				Layout: wd.Grid{MarginsZero: true},
@@ -150,6 +203,7 @@ func newMainWindow(cfg *Configuration, opts *QCLMainWindowOptions) *QCLMainWindo
 					wd.Label{Text: wd.Bind("SignedInName"), Row: 0, Column: 0},
 					wd.HSpacer{Row: 0, Column: 1},
 					wd.Label{Text: fmt.Sprintf("v%.2f", version), Row: 0, Column: 2},
+					wd.Label{Text: wd.Bind("ServerStatus"), Row: 1, Column: 0, ColumnSpan: 3},
 				},
 			},
 		},
@@ -161,6 +215,8 @@ func newMainWindow(cfg *Configuration, opts *QCLMainWindowOptions) *QCLMainWindo
 		logger.FatalUIw(fmt.Sprintf("%s: Fatal error during creation of configuration UI wrapper window", GetCaller()), "error", err)
 	}
 	mainWindow.setTrayIcon(icon, cfg)
+	mainWindow.refreshProfiles()
+	mainWindow.refreshAccounts()
 	mainWindow.setMainWindowSize()
 	mainWindow.Binder = mwBinder
 	return mainWindow
@@ -213,6 +269,23 @@ func (qm *QCLMainWindow) setTrayIcon(icon *walk.Icon, cfg *Configuration) {
 	if err := trayIcon.ContextMenu().Actions().Add(actionConfigure); err != nil {
 		logger.FatalUIw(fmt.Sprintf("%s: Fatal error adding configure action", GetCaller()), "error", err)
 	}
+	if err := trayIcon.ContextMenu().Actions().Add(qm.newProfileMenuAction()); err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error adding profile action", GetCaller()), "error", err)
+	}
+	if err := trayIcon.ContextMenu().Actions().Add(qm.newAccountMenuAction()); err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error adding account action", GetCaller()), "error", err)
+	}
+	if err := trayIcon.ContextMenu().Actions().Add(qm.newLogLevelMenuAction()); err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error adding log level action", GetCaller()), "error", err)
+	}
+	actionViewLog := walk.NewAction()
+	if err := actionViewLog.SetText("View &Log"); err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error setting view log action", GetCaller()), "error", err)
+	}
+	actionViewLog.Triggered().Attach(func() { showLogWindow() })
+	if err := trayIcon.ContextMenu().Actions().Add(actionViewLog); err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error adding view log action", GetCaller()), "error", err)
+	}
 	actionExit := walk.NewAction()
 	if err := actionExit.SetText("E&xit"); err != nil {
 		logger.FatalUIw(fmt.Sprintf("%s: Fatal error setting exit action", GetCaller()), "error", err)
@@ -224,6 +297,100 @@ func (qm *QCLMainWindow) setTrayIcon(icon *walk.Icon, cfg *Configuration) {
 	qm.TrayIcon = trayIcon
 }
 
+func (qm *QCLMainWindow) newLogLevelMenuAction() *walk.Action {
+	menu, err := walk.NewMenu()
+	if err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error creating log level menu", GetCaller()), "error", err)
+	}
+	qm.logLevel = map[string]*walk.Action{}
+	for _, l := range LogLevels {
+		level := l
+		a := walk.NewAction()
+		if err := a.SetText(strings.Title(level)); err != nil {
+			logger.FatalUIw(fmt.Sprintf("%s: Fatal error setting log level action", GetCaller()), "error", err)
+		}
+		if err := a.SetCheckable(true); err != nil {
+			logger.FatalUIw(fmt.Sprintf("%s: Fatal error setting log level action", GetCaller()), "error", err)
+		}
+		a.Triggered().Attach(func() {
+			if err := SetLogLevel(level); err != nil {
+				logger.Errorw(fmt.Sprintf("%s: error changing log level", GetCaller()), "error", err)
+			}
+			qm.setLogLevelChecked(GetLogLevel())
+		})
+		if err := menu.Actions().Add(a); err != nil {
+			logger.FatalUIw(fmt.Sprintf("%s: Fatal error adding log level action", GetCaller()), "error", err)
+		}
+		qm.logLevel[level] = a
+	}
+	qm.setLogLevelChecked(GetLogLevel())
+	action := walk.NewMenuAction(menu)
+	if err := action.SetText("Log Le&vel"); err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error setting log level menu action", GetCaller()), "error", err)
+	}
+	return action
+}
+
+func (qm *QCLMainWindow) setLogLevelChecked(level string) {
+	for l, a := range qm.logLevel {
+		if err := a.SetChecked(l == level); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error updating log level menu", GetCaller()), "error", err)
+		}
+	}
+}
+
+func (qm *QCLMainWindow) startLogLevelWatcher() {
+	go watchLogLevelFile(func(level string) {
+		qm.Synchronize(func() {
+			qm.setLogLevelChecked(level)
+		})
+	}, qm.stop)
+}
+
+func (qm *QCLMainWindow) startServerStatusMonitor() {
+	qm.monitor = newServerStatusMonitor(ConfStatusInterval, func(prev, cur *ServerStatusRecord) {
+		qm.Synchronize(func() {
+			qm.setServerStatus(prev, cur)
+		})
+	})
+	qm.monitor.start()
+}
+
+func (qm *QCLMainWindow) setServerStatus(prev, cur *ServerStatusRecord) {
+	if qm == nil || qm.Options == nil {
+		return
+	}
+	status := fmt.Sprintf(serverStatusFmt, cur)
+	qm.Options.ServerStatus = status
+	if err := qm.refreshBoundSettings(); err != nil {
+		logger.Error(fmt.Sprintf("%s: %s", GetCaller(), err))
+	}
+	if qm.TrayIcon == nil {
+		return
+	}
+	if err := qm.TrayIcon.SetToolTip(fmt.Sprintf("%s\n%s", title, status)); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error setting system tray icon tooltip", GetCaller()), "error", err)
+	}
+	// don't notify for the initial poll or when the status endpoint itself can't be reached
+	if prev == nil || cur.Status == serverStatusUnknown || !qm.TrayIcon.Visible() {
+		return
+	}
+	msg := fmt.Sprintf("QC servers are now %s (previously %s).", cur.Status, prev.Status)
+	if cur.Message != "" && !strings.EqualFold(cur.Message, "success") {
+		msg = fmt.Sprintf("%s %s", msg, cur.Message)
+	}
+	if cur.Status == serverStatusUp {
+		err := qm.TrayIcon.ShowInfo("QC Server Status", msg)
+		if err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error showing server status notification", GetCaller()), "error", err)
+		}
+		return
+	}
+	if err := qm.TrayIcon.ShowWarning("QC Server Status", msg); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error showing server status notification", GetCaller()), "error", err)
+	}
+}
+
 func (qm *QCLMainWindow) cleanupTrayIcon() {
 	if qm == nil || qm.TrayIcon == nil {
 		return
@@ -330,6 +497,8 @@ func (qm *QCLMainWindow) refreshBoundSettings() error {
 }
 
 func (qm *QCLMainWindow) exitFromMainWindow() {
+	qm.monitor.shutdown()
+	close(qm.stop)
 	qm.cleanupTrayIcon()
 	qm.MainWindow.Dispose()
 	exitFromUI()
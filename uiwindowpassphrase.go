@@ -0,0 +1,86 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+
+	"github.com/lxn/walk"
+	wd "github.com/lxn/walk/declarative"
+)
+
+const masterPassphraseTitle = "Master Passphrase"
+
+func askUnlockPassphrase(owner walk.Form) (string, bool, bool) {
+	var dlg *walk.Dialog
+	var pass *walk.LineEdit
+	var rememberCB *walk.CheckBox
+	var okBtn, cancelBtn *walk.PushButton
+	result, err := (wd.Dialog{
+		AssignTo:      &dlg,
+		Title:         "Unlock QCLauncher",
+		Icon:          getAppIcon(),
+		DefaultButton: &okBtn,
+		CancelButton:  &cancelBtn,
+		MinSize:       wd.Size{Width: 350},
+		Layout:        wd.VBox{},
+		Children: []wd.Widget{
+			wd.Label{Text: "Enter your master passphrase to unlock your saved credentials:"},
+			wd.LineEdit{AssignTo: &pass, PasswordMode: true},
+			wd.CheckBox{AssignTo: &rememberCB, Text: "Stay unlocked until I sign out of Windows"},
+			wd.Composite{
+				Layout: wd.HBox{MarginsZero: true},
+				Children: []wd.Widget{
+					wd.HSpacer{},
+					wd.PushButton{AssignTo: &okBtn, Text: "OK", OnClicked: func() { dlg.Accept() }},
+					wd.PushButton{AssignTo: &cancelBtn, Text: "Cancel", OnClicked: func() { dlg.Cancel() }},
+				},
+			},
+		},
+	}).Run(owner)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating unlock window", GetCaller()), "error", err)
+		return "", false, false
+	}
+	if result != walk.DlgCmdOK {
+		return "", false, false
+	}
+	return pass.Text(), rememberCB.Checked(), true
+}
+
+// changeMasterPassphraseFromUI sets or changes the master passphrase, or removes it if remove is true.
+func changeMasterPassphraseFromUI(owner walk.Form, remove bool) {
+	set, err := HasMasterPassphrase()
+	if err != nil {
+		ShowErrorMsg(masterPassphraseTitle, fmt.Sprintf("Unable to read your settings: %s", err), owner)
+		return
+	}
+	if remove && !set {
+		ShowInfoMsg(masterPassphraseTitle, "No master passphrase is set.", owner)
+		return
+	}
+	var current, passphrase string
+	var ok bool
+	if set {
+		if current, ok = askPassphrase(owner, masterPassphraseTitle, "Current master passphrase:", false); !ok {
+			return
+		}
+	}
+	if !remove {
+		if passphrase, ok = askPassphrase(owner, masterPassphraseTitle,
+			"New master passphrase. You will need it each time QCLauncher starts, and it cannot be recovered:", true); !ok {
+			return
+		}
+	}
+	if err = SetMasterPassphrase(current, passphrase); err != nil {
+		ShowErrorMsg(masterPassphraseTitle, fmt.Sprintf("Unable to change the master passphrase: %s", err), owner)
+		return
+	}
+	if remove {
+		ShowInfoMsg(masterPassphraseTitle, "The master passphrase was removed.", owner)
+		return
+	}
+	ShowInfoMsg(masterPassphraseTitle, fmt.Sprintf("The master passphrase was set. Backups made before now in the %s folder are not protected by it; delete them if you no longer need them.",
+		BackupDir), owner)
+}
@@ -0,0 +1,172 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+
+	"github.com/lxn/walk"
+	wd "github.com/lxn/walk/declarative"
+	"github.com/lxn/win"
+)
+
+func getProfileNames() ([]string, string) {
+	if !DataStoreExists() {
+		return []string{DefaultProfile}, DefaultProfile // don't create the data file before the first save
+	}
+	names, active, err := GetProfiles()
+	if err != nil {
+		return []string{DefaultProfile}, DefaultProfile
+	}
+	return names, active
+}
+
+func (qm *QCLMainWindow) newProfileMenuAction() *walk.Action {
+	menu, err := walk.NewMenu()
+	if err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error creating profile menu", GetCaller()), "error", err)
+	}
+	qm.profileMenu = menu
+	action := walk.NewMenuAction(menu)
+	if err := action.SetText("P&rofile"); err != nil {
+		logger.FatalUIw(fmt.Sprintf("%s: Fatal error setting profile menu action", GetCaller()), "error", err)
+	}
+	return action
+}
+
+// refreshProfiles updates the main window's profile list and the tray menu from the data file.
+func (qm *QCLMainWindow) refreshProfiles() {
+	if qm == nil || qm.profileCombo == nil || qm.profileMenu == nil {
+		return
+	}
+	qm.profiles, qm.profile = getProfileNames()
+	if err := qm.profileCombo.SetModel(qm.profiles); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error updating profile list", GetCaller()), "error", err)
+	}
+	if err := qm.profileMenu.Actions().Clear(); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error clearing profile menu", GetCaller()), "error", err)
+	}
+	for i, n := range qm.profiles {
+		name := n
+		if name == qm.profile {
+			if err := qm.profileCombo.SetCurrentIndex(i); err != nil {
+				logger.Errorw(fmt.Sprintf("%s: error selecting profile in list", GetCaller()), "error", err)
+			}
+		}
+		a := walk.NewAction()
+		if err := a.SetText(name); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error setting profile action", GetCaller()), "error", err)
+		}
+		if err := a.SetCheckable(true); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error setting profile action", GetCaller()), "error", err)
+		}
+		if err := a.SetChecked(name == qm.profile); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error setting profile action", GetCaller()), "error", err)
+		}
+		a.Triggered().Attach(func() { qm.selectProfile(name) })
+		if err := qm.profileMenu.Actions().Add(a); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error adding profile action", GetCaller()), "error", err)
+		}
+	}
+}
+
+func (qm *QCLMainWindow) selectProfile(name string) {
+	if name == qm.profile || !DataStoreExists() {
+		return
+	}
+	if isCollectingSettings {
+		ShowInfoMsg("Profile", "Close the settings window before changing profiles.", qm)
+		qm.refreshProfiles()
+		return
+	}
+	if err := SetActiveProfile(name); err != nil {
+		ShowErrorMsg("Profile", fmt.Sprintf("Unable to change profile: %s", err), qm)
+		qm.refreshProfiles()
+		return
+	}
+	cfg, err := GetConfiguration()
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error reading configuration after changing profile", GetCaller()), "error", err)
+	} else {
+		qm.updateMinimizeSettings(cfg.Launcher.MinimizeToTray)
+	}
+	qm.refreshProfiles()
+}
+
+func newProfileFromUI(owner walk.Form) {
+	if !DataStoreExists() {
+		ShowInfoMsg("New Profile", "Save your settings before creating a profile.", owner)
+		return
+	}
+	_, active := getProfileNames()
+	var dlg *walk.Dialog
+	var nameEdit *walk.LineEdit
+	var okBtn, cancelBtn *walk.PushButton
+	result, err := (wd.Dialog{
+		AssignTo:      &dlg,
+		Title:         "New Profile",
+		Icon:          getAppIcon(),
+		DefaultButton: &okBtn,
+		CancelButton:  &cancelBtn,
+		MinSize:       wd.Size{Width: 300},
+		Layout:        wd.VBox{},
+		Children: []wd.Widget{
+			wd.Label{Text: fmt.Sprintf("Name of the new profile (starts as a copy of \"%s\"):", active)},
+			wd.LineEdit{AssignTo: &nameEdit, MaxLength: maxProfileNameLen},
+			wd.Composite{
+				Layout: wd.HBox{MarginsZero: true},
+				Children: []wd.Widget{
+					wd.HSpacer{},
+					wd.PushButton{AssignTo: &okBtn, Text: "OK", OnClicked: func() { dlg.Accept() }},
+					wd.PushButton{AssignTo: &cancelBtn, Text: "Cancel", OnClicked: func() { dlg.Cancel() }},
+				},
+			},
+		},
+	}).Run(owner)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating new profile window", GetCaller()), "error", err)
+		return
+	}
+	if result != walk.DlgCmdOK {
+		return
+	}
+	name := nameEdit.Text()
+	if err = CreateProfile(name, active); err != nil {
+		ShowErrorMsg("New Profile", err.Error(), owner)
+		return
+	}
+	if err = SetActiveProfile(name); err != nil {
+		ShowErrorMsg("New Profile", err.Error(), owner)
+		return
+	}
+	qclauncherSettingsWindow.close()
+	qclauncherMainWindow.refreshProfiles()
+	ShowInfoMsg("New Profile", fmt.Sprintf("Profile \"%s\" was created and selected. Click \"Configure\" to change its settings.", name),
+		qclauncherMainWindow)
+}
+
+func deleteProfileFromUI(owner walk.Form) {
+	_, active := getProfileNames()
+	if active == DefaultProfile {
+		ShowInfoMsg("Delete Profile", "The default profile cannot be deleted.", owner)
+		return
+	}
+	if walk.MsgBox(owner, "Delete Profile", fmt.Sprintf("Delete the profile \"%s\" and its settings?", active),
+		walk.MsgBoxYesNo) != win.IDYES {
+		return
+	}
+	if err := DeleteProfile(active); err != nil {
+		ShowErrorMsg("Delete Profile", err.Error(), owner)
+		return
+	}
+	if err := SetActiveProfile(DefaultProfile); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error selecting default profile", GetCaller()), "error", err)
+	}
+	qclauncherSettingsWindow.close()
+	qclauncherMainWindow.refreshProfiles()
+	if cfg, err := GetConfiguration(); err == nil {
+		qclauncherMainWindow.updateMinimizeSettings(cfg.Launcher.MinimizeToTray)
+	}
+	ShowInfoMsg("Delete Profile", fmt.Sprintf("Profile \"%s\" was deleted. The default profile is now in use.", active), qclauncherMainWindow)
+}
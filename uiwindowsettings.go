@@ -20,6 +20,8 @@ type QCLSettingsWindow struct {
 	*walk.MainWindow
 	Options *QCLSettingsWindowOptions
 	Binder  *walk.DataBinder
+	cfg     *Configuration
+	tabs    []*QCLSettingsTab
 }
 
 type QCLSettingsWindowOptions struct {
@@ -37,11 +39,13 @@ func (sw *QCLSettingsWindow) WndProc(hwnd win.HWND, msg uint32, wParam, lParam u
 }
 
 func newSettingsWindow(cfg *Configuration, opts *QCLSettingsWindowOptions) *QCLSettingsWindow {
-	settingsWindow := &QCLSettingsWindow{}
+	settingsWindow := &QCLSettingsWindow{cfg: cfg}
 	settingsWindow.Options = opts
 	settingsTabs := getSettingsTabs(cfg)
+	settingsWindow.tabs = settingsTabs
 	settingsTabPages := getSettingsTabPages(settingsTabs)
 	var swBinder *walk.DataBinder
+	var diagnoseBtn *walk.PushButton
 	icon := getAppIcon()
 	binder := wd.DataBinder{
 		AssignTo:       &swBinder,
@@ -50,7 +54,7 @@ func newSettingsWindow(cfg *Configuration, opts *QCLSettingsWindowOptions) *QCLS
 	}
 	if err := (wd.MainWindow{
 		AssignTo:             &settingsWindow.MainWindow,
-		Title:                "Configuration",
+		Title:                fmt.Sprintf("Configuration - %s profile", cfg.Profile.Name),
 		Icon:                 icon,
 		UseCustomWindowStyle: true,
 		CustomWindowStyle:    win.WS_DLGFRAME,
@@ -132,6 +136,20 @@ func newSettingsWindow(cfg *Configuration, opts *QCLSettingsWindowOptions) *QCLS
 							}
 						},
 					},
+					wd.PushButton{
+						AssignTo:    &diagnoseBtn,
+						Text:        "Diagnose",
+						ToolTipText: "Check the data file, connection, account and QC install for problems",
+						Enabled:     wd.Bind("CanSaveSettings"),
+						OnClicked: func() {
+							diagnoseBtn.SetEnabled(false)
+							diagnoseBtn.SetText("Checking...")
+							runDoctorFromUI(settingsWindow.MainWindow, func() {
+								diagnoseBtn.SetText("Diagnose")
+								diagnoseBtn.SetEnabled(true)
+							})
+						},
+					},
 				},
 			},
 		},
@@ -156,10 +174,14 @@ func getSettingsTabs(cfg *Configuration) []*QCLSettingsTab {
 	qcCoreSettingsTab := newQCCoreSettingsTab(cfg.Core)
 	qcExperimentalSettingsTab := newQCExperimentalSettingsTab(cfg.Experimental)
 	launcherSettingsTab := newLauncherSettingsTab(cfg.Launcher)
+	advancedSettingsTab := newAdvancedSettingsTab(cfg.Launcher)
+	profileSettingsTab := newProfileSettingsTab(cfg.Profile)
 	return []*QCLSettingsTab{
 		qcCoreSettingsTab,
 		qcExperimentalSettingsTab,
 		launcherSettingsTab,
+		advancedSettingsTab,
+		profileSettingsTab,
 	}
 }
 
@@ -177,6 +199,12 @@ func settingsTabsBinderSubmit(tabs []*QCLSettingsTab) error {
 			logger.Errorw(fmt.Sprintf("%s: error submitting data to binder when saving settings", GetCaller()), "error", err)
 			return err
 		}
+		if t.submit != nil {
+			if err := t.submit(); err != nil {
+				logger.Errorw(fmt.Sprintf("%s: error submitting tab settings when saving settings", GetCaller()), "error", err)
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -191,6 +219,7 @@ func handlePostSave(cfg *Configuration) error {
 			return err
 		}
 		qclauncherMainWindow.setSignedInName(qcs.Username)
+		qclauncherMainWindow.refreshAccounts()
 	}
 	qclauncherMainWindow.enableLaunchButton(true)
 	qclauncherMainWindow.enableLaunchTrayAction(true)
@@ -215,6 +244,8 @@ func handlePostReset() {
 		qclauncherMainWindow.showTrayIcon(false)
 		qclauncherMainWindow.restore(true)
 	}
+	qclauncherMainWindow.refreshProfiles()
+	qclauncherMainWindow.refreshAccounts()
 	ShowInfoMsg("Success", "All settings were reset. Click \"Configure\" to set up.", qclauncherSettingsWindow)
 }
 
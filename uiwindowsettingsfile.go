@@ -0,0 +1,136 @@
+// QCLauncher by syncore <syncore@syncore.org> 2017
+// https://github.com/syncore/qclauncher
+
+package qclauncher
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/lxn/walk"
+	wd "github.com/lxn/walk/declarative"
+	"github.com/lxn/win"
+)
+
+const settingsFileFilter = "JSON files (*.json)|*.json|TOML files (*.toml)|*.toml"
+
+func exportSettingsFromUI(owner walk.Form) {
+	var passphrase string
+	switch walk.MsgBox(owner, "Export Settings", "Include your username and password?\n\n"+
+		"They will be encrypted with a passphrase that you will need when importing.", walk.MsgBoxYesNoCancel|walk.MsgBoxIconQuestion) {
+	case win.IDYES:
+		var ok bool
+		if passphrase, ok = askPassphrase(owner, "Export Settings", "Choose a passphrase for your username and password:", true); !ok {
+			return
+		}
+	case win.IDNO:
+	default:
+		return
+	}
+	fd := &walk.FileDialog{
+		Title:    "Export settings",
+		Filter:   settingsFileFilter,
+		FilePath: fmt.Sprintf("qclauncher-settings-%s.json", time.Now().Format("20060102")),
+	}
+	if accepted, err := fd.ShowSave(owner); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error showing settings export dialog", GetCaller()), "error", err)
+		return
+	} else if !accepted {
+		return
+	}
+	p := fd.FilePath
+	if filepath.Ext(p) == "" {
+		p += ".json"
+	}
+	if err := ExportSettings(p, passphrase); err != nil {
+		ShowErrorMsg("Export Error", fmt.Sprintf("Unable to export settings: %s", err), owner)
+		return
+	}
+	ShowInfoMsg("Export Settings", fmt.Sprintf("Settings were exported to %s", p), owner)
+}
+
+func (sw *QCLSettingsWindow) importSettings() {
+	fd := &walk.FileDialog{Title: "Import settings", Filter: settingsFileFilter}
+	if accepted, err := fd.ShowOpen(sw); err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error showing settings import dialog", GetCaller()), "error", err)
+		return
+	} else if !accepted {
+		return
+	}
+	var passphrase string
+	if SettingsExportHasCredentials(fd.FilePath) {
+		passphrase, _ = askPassphrase(sw, "Import Settings",
+			"This file contains a username and password. Enter its passphrase, or leave it blank to skip them:", false)
+	}
+	if err := ReadSettingsExport(sw.cfg, fd.FilePath, passphrase); err != nil {
+		ShowErrorMsg("Import Error", fmt.Sprintf("Unable to import settings: %s", err), sw)
+		return
+	}
+	for _, t := range sw.tabs {
+		if err := t.DataBinder.Reset(); err != nil {
+			logger.Errorw(fmt.Sprintf("%s: error refreshing settings tab after import", GetCaller()), "error", err)
+		}
+		if t.reset != nil {
+			t.reset()
+		}
+	}
+	ShowInfoMsg("Import Settings", "Settings were imported. Review them and click \"Save All\" to save.", sw)
+}
+
+func askPassphrase(owner walk.Form, title, text string, confirm bool) (string, bool) {
+	var dlg *walk.Dialog
+	var pass, pass2 *walk.LineEdit
+	var okBtn, cancelBtn *walk.PushButton
+	children := []wd.Widget{
+		wd.Label{Text: text},
+		wd.LineEdit{AssignTo: &pass, PasswordMode: true},
+	}
+	if confirm {
+		children = append(children, wd.Label{Text: "Confirm passphrase:"}, wd.LineEdit{AssignTo: &pass2, PasswordMode: true})
+	}
+	children = append(children, wd.Composite{
+		Layout: wd.HBox{MarginsZero: true},
+		Children: []wd.Widget{
+			wd.HSpacer{},
+			wd.PushButton{
+				AssignTo: &okBtn,
+				Text:     "OK",
+				OnClicked: func() {
+					if confirm && len(pass.Text()) < minExportPassphrase {
+						ShowErrorMsg(title, fmt.Sprintf("The passphrase must be at least %d characters", minExportPassphrase), dlg)
+						return
+					}
+					if confirm && pass.Text() != pass2.Text() {
+						ShowErrorMsg(title, "The passphrases do not match", dlg)
+						return
+					}
+					dlg.Accept()
+				},
+			},
+			wd.PushButton{
+				AssignTo:  &cancelBtn,
+				Text:      "Cancel",
+				OnClicked: func() { dlg.Cancel() },
+			},
+		},
+	})
+	result, err := (wd.Dialog{
+		AssignTo:      &dlg,
+		Title:         title,
+		Icon:          getAppIcon(),
+		DefaultButton: &okBtn,
+		CancelButton:  &cancelBtn,
+		MinSize:       wd.Size{Width: 350},
+		Layout:        wd.VBox{},
+		Children:      children,
+	}).Run(owner)
+	if err != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating passphrase window", GetCaller()), "error", err)
+		return "", false
+	}
+	if result != walk.DlgCmdOK {
+		return "", false
+	}
+	return pass.Text(), true
+}
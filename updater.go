@@ -12,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	bolt "github.com/coreos/bbolt"
 	"github.com/lxn/walk"
 	"github.com/lxn/win"
 	"github.com/skratchdot/open-golang/open"
@@ -52,6 +51,7 @@ func CheckUpdate(enforceHashIntegrity bool, ut UpdateType) error {
 	}
 	l := newLauncherClient(defTimeout)
 	if ut == UpdateAll || (ut == UpdateLauncher && isUpdateDue(updateData.LastLauncherUpdateTime)) {
+		l.updateOptionsCatalog()
 		if continueRunning := l.checkForLauncherUpdate(); !continueRunning {
 			exitFromUI()
 			return nil
@@ -71,6 +71,10 @@ func CheckUpdate(enforceHashIntegrity bool, ut UpdateType) error {
 }
 
 func promptForLauncherUpdate(updateInfo *LauncherUpdateInfo) bool {
+	if ConfHeadless {
+		logger.Infow("launcher update available", "latest", updateInfo.LatestVersion, "url", updateInfo.URL)
+		return true
+	}
 	msg := fmt.Sprintf("An update is available for QCLauncher!\nYour version: %.2f\nLatest version: %.2f\nDate: %s\nClick \"Yes\" to exit and go to the download site or \"No\" to continue.",
 		version, updateInfo.LatestVersion, updateInfo.Date.Format("Mon Jan 2 15:04:05 MST 2006"))
 	result := walk.MsgBox(nil, "QCLauncher Update", msg, walk.MsgBoxYesNo)
@@ -111,7 +115,10 @@ func (lc *launcherClient) checkForQCUpdate(enforceHashIntegrity bool) error {
 	if _, ok := cherr.(*hashMismatchError); ok {
 		t = 0 // try next time
 		// Only allow launching with the latest version of QC (default) unless enforcement is specifically disabled
-		if !enforceHashIntegrity {
+		if qcUpdateInfo.lastKnownGood {
+			// the stored hashes may predate the current QC version, so they can't be used to block launching
+			logger.Warnw("QC files did not match the last known good hashes, not enforcing", "error", cherr)
+		} else if !enforceHashIntegrity {
 			ShowWarningMsg("Warning",
 				"Your QC files did not match the newest versions from Bethesda. Please run the Bethesda Launcher to update Quake Champions! Launching anyway, but it will probably be unsuccessful.", nil)
 		} else {
@@ -205,7 +212,7 @@ func (ls *LauncherStore) getLastUpdateTime() (*UpdateTime, error) {
 	ls.checkDataFile(false)
 	defer ls.Close()
 	var lqut, llut []byte
-	if err := ls.View(func(tx *bolt.Tx) error {
+	if err := ls.View(func(tx DataTx) error {
 		b := tx.Bucket([]byte(bucketLastUpdate))
 		lqut = b.Get([]byte(keyLastUpdateQC))
 		llut = b.Get([]byte(keyLastUpdateLauncher))
@@ -219,51 +226,54 @@ func (ls *LauncherStore) getLastUpdateTime() (*UpdateTime, error) {
 }
 
 func updateLastCheckTime(ut UpdateType, unixTime int64) error {
-	db, err := bolt.Open(GetDataFilePath(), 0600, nil)
+	ls, err := newLauncherDataStore()
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("%s: error opening data file", GetCaller()), "error", err)
 		return err
 	}
-	defer db.Close()
+	defer ls.Close()
+	return ls.Update(func(tx DataTx) error {
+		return putLastCheckTime(tx, ut, unixTime)
+	})
+}
+
+func putLastCheckTime(tx DataTx, ut UpdateType, unixTime int64) error {
 	lastQCUpdateTime, lastLauncherUpdateTime := make([]byte, 8), make([]byte, 8)
 	binary.LittleEndian.PutUint64(lastQCUpdateTime, uint64(unixTime))
 	binary.LittleEndian.PutUint64(lastLauncherUpdateTime, uint64(unixTime))
-
-	return db.Update(func(tx *bolt.Tx) error {
-		b, dberr := tx.CreateBucketIfNotExists([]byte(bucketLastUpdate))
-		if dberr != nil {
-			logger.Errorw(fmt.Sprintf("%s: error creating update time info bucket", GetCaller()), "error", dberr)
-			return dberr
-		}
-		var uperr, lqerr, llerr error
-		switch ut {
-		case UpdateQC:
-			uperr = b.Put([]byte(keyLastUpdateQC), lastQCUpdateTime)
-		case UpdateLauncher:
-			uperr = b.Put([]byte(keyLastUpdateLauncher), lastLauncherUpdateTime)
-		case UpdateAll:
-			lqerr = b.Put([]byte(keyLastUpdateQC), lastQCUpdateTime)
-			// do not reset the existing launcher last update time when saving new settings
-			if existingll := b.Get([]byte(keyLastUpdateLauncher)); len(existingll) != 0 {
-				llerr = b.Put([]byte(keyLastUpdateLauncher), existingll)
-			} else {
-				llerr = b.Put([]byte(keyLastUpdateLauncher), lastLauncherUpdateTime)
-			}
-		default:
-			logger.Errorw(fmt.Sprintf("%s: got unknown update type", GetCaller()), "updateType", ut)
-		}
-		if uperr != nil {
-			logger.Errorw(fmt.Sprintf("%s: error saving update time info to datastore", GetCaller()), "error", uperr)
-			return uperr
-		}
-		if lqerr != nil {
-			logger.Errorw(fmt.Sprintf("%s: error saving last qc update (all) time info to datastore", GetCaller()), "error", lqerr)
-			return lqerr
-		}
-		if llerr != nil {
-			logger.Errorw(fmt.Sprintf("%s: error saving last launcher update (all) time info to datastore", GetCaller()), "error", llerr)
-			return llerr
+	b, dberr := tx.CreateBucketIfNotExists([]byte(bucketLastUpdate))
+	if dberr != nil {
+		logger.Errorw(fmt.Sprintf("%s: error creating update time info bucket", GetCaller()), "error", dberr)
+		return dberr
+	}
+	var uperr, lqerr, llerr error
+	switch ut {
+	case UpdateQC:
+		uperr = b.Put([]byte(keyLastUpdateQC), lastQCUpdateTime)
+	case UpdateLauncher:
+		uperr = b.Put([]byte(keyLastUpdateLauncher), lastLauncherUpdateTime)
+	case UpdateAll:
+		lqerr = b.Put([]byte(keyLastUpdateQC), lastQCUpdateTime)
+		// do not reset the existing launcher last update time when saving new settings
+		if existingll := b.Get([]byte(keyLastUpdateLauncher)); len(existingll) != 0 {
+			llerr = b.Put([]byte(keyLastUpdateLauncher), existingll)
+		} else {
+			llerr = b.Put([]byte(keyLastUpdateLauncher), lastLauncherUpdateTime)
 		}
-		return nil
-	})
+	default:
+		logger.Errorw(fmt.Sprintf("%s: got unknown update type", GetCaller()), "updateType", ut)
+	}
+	if uperr != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving update time info to datastore", GetCaller()), "error", uperr)
+		return uperr
+	}
+	if lqerr != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving last qc update (all) time info to datastore", GetCaller()), "error", lqerr)
+		return lqerr
+	}
+	if llerr != nil {
+		logger.Errorw(fmt.Sprintf("%s: error saving last launcher update (all) time info to datastore", GetCaller()), "error", llerr)
+		return llerr
+	}
+	return nil
 }
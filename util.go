@@ -10,12 +10,15 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gtank/cryptopasta"
 	ps "github.com/keybase/go-ps"
 )
 
+const attachParentProcess = ^uint32(0) // ATTACH_PARENT_PROCESS
+
 // Single provides a mechanism to ensure that only one instance of a program is running
 // https://github.com/WeltN24/single
 type Single struct {
@@ -194,3 +197,17 @@ func decrypt(encrypted string, key *[]byte) (decrypted string, err error) {
 	dec, err := cryptopasta.Decrypt([]byte(encrypted), &k)
 	return string(dec), err
 }
+
+func AttachParentConsole() {
+	// the release exe is built with -H windowsgui, so it has no console of its own
+	if h, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE); err == nil && h != 0 && h != syscall.InvalidHandle {
+		return // output is already redirected
+	}
+	attachConsole := syscall.NewLazyDLL("kernel32.dll").NewProc("AttachConsole")
+	if r, _, _ := attachConsole.Call(uintptr(attachParentProcess)); r == 0 {
+		return
+	}
+	if out, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0); err == nil {
+		os.Stdout, os.Stderr = out, out
+	}
+}